@@ -0,0 +1,782 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"go.starlark.net/starlark"
+)
+
+// The arena is the place of tournaments between user-submitted strategies. The strategy is the Starlark script that
+// defines the function move(mine, theirs): it receives the lists of previous moves of the strategy and of its rival
+// in the match and returns "stone", "scissors" or "paper". The scripts are executed in-process without any access
+// to the outside world: there are no modules to load and print is discarded. Every execution is limited by the number
+// of interpreter steps, by the time and by the size of values made during it (see sandbox.go). The size of values
+// kept by the loaded script is limited too.
+
+const (
+	maxArenaScript      = 16 << 10               // maximal size of script source
+	maxArenaName        = 64                     // maximal length of strategy name
+	maxArenaScripts     = 64                     // maximal number of strategies in the arena
+	maxArenaSteps       = 100000                 // maximal number of interpreter steps for one execution
+	maxArenaValues      = 64 << 10               // maximal size of global values of script (string bytes and items)
+	arenaMoveTimeout    = 100 * time.Millisecond // maximal time of one execution
+	arenaLockTTL        = time.Minute            // the lock of running tournament is extended by this time
+	arenaMatchRounds    = 10                     // number of rounds in the match of two strategies
+	defaultArenaLimit   = 10                     // default number of strategies in the leaderboard
+	maxArenaLimit       = 100                    // maximal number of strategies in the leaderboard
+	arenaHashID         = "arena"                // id used for the hashes of strategy tokens and authors
+	arenaScriptFunction = "move"                 // name of the strategy function
+)
+
+const (
+	// states of uploaded strategy
+	arenaPending  = "pending"  // the strategy isn't checked yet
+	arenaAccepted = "accepted" // the strategy is loaded and made the first move
+	arenaRejected = "rejected" // the strategy failed the check
+)
+
+// ArenaScript is the user-submitted strategy
+type ArenaScript struct {
+	ID      string `json:"id"`              // strategy id
+	Name    string `json:"name"`            // strategy name
+	Owner   string `json:"owner"`           // hash of the author's identification
+	Source  string `json:"source"`          // Starlark script
+	Created int64  `json:"created"`         // upload time (Unix time in milliseconds)
+	Status  string `json:"status"`          // state of the check, empty for strategies checked before the upload
+	Error   string `json:"error,omitempty"` // the reason of rejection
+}
+
+// ArenaEntry is the standing of strategy in the leaderboard
+type ArenaEntry struct {
+	Script string `json:"script"` // strategy id
+	Name   string `json:"name"`   // strategy name
+	Points int    `json:"points"` // points accumulated in tournaments
+	Place  int    `json:"place"`  // place in the leaderboard starting from 1
+}
+
+// ArenaStore is an interface of the storage of arena strategies and leaderboard
+type ArenaStore interface {
+	// AddScript stores the new strategy. It returns false when the arena is full.
+	AddScript(s *ArenaScript) (bool, error)
+	// UpdateScript stores the strategy when it isn't deleted. It returns false when the strategy doesn't exist.
+	UpdateScript(s *ArenaScript) (bool, error)
+	// Script returns the strategy or nil when it doesn't exist
+	Script(id string) (*ArenaScript, error)
+	// DeleteScript removes the strategy and its standing in the leaderboard. It returns false when it doesn't exist.
+	DeleteScript(id string) (bool, error)
+	// Scripts returns all strategies
+	Scripts() ([]*ArenaScript, error)
+	// AddPoints adds the points to strategies
+	AddPoints(points map[string]int) error
+	// Leaderboard returns the top limit strategies
+	Leaderboard(limit int) ([]ArenaEntry, error)
+	// Schedule marks the scheduled tournament for ttl. It returns false when another instance has marked it already.
+	Schedule(ttl time.Duration) (bool, error)
+	// Lock takes the lock of running tournament for ttl. It returns the token of lock or "" when the lock is taken.
+	Lock(ttl time.Duration) (string, error)
+	// Extend prolongs the lock taken with token for ttl. It returns false when the lock is lost.
+	Extend(token string, ttl time.Duration) (bool, error)
+	// Unlock releases the lock taken with token
+	Unlock(token string) error
+}
+
+// arena is the storage of arena strategies and leaderboard
+var arena ArenaStore
+
+// arenaProgram is the loaded strategy
+type arenaProgram struct {
+	id   string
+	move starlark.Callable
+}
+
+// arenaThread returns the new interpreter thread with the step limit
+func arenaThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{Name: name, Print: func(*starlark.Thread, string) {}}
+	thread.SetMaxExecutionSteps(maxArenaSteps)
+	return thread
+}
+
+// arenaExec runs fn in thread with the time and memory limits
+func arenaExec(thread *starlark.Thread, fn func() error) error {
+	thread.SetLocal(arenaBudgetKey, &arenaBudget{})
+	timer := time.AfterFunc(arenaMoveTimeout, func() { thread.Cancel("time limit exceeded") })
+	defer timer.Stop()
+	return fn()
+}
+
+// arenaValueSize returns the size of value: the length of strings and the number of items of containers.
+// It stops counting when the size exceeds limit. The values in seen are already counted.
+func arenaValueSize(v starlark.Value, limit int, seen map[starlark.Value]bool) int {
+	switch v := v.(type) {
+	case starlark.String:
+		return len(v)
+	case starlark.Bytes:
+		return len(v)
+	case starlark.Tuple:
+		return arenaItemsSize(v, limit, seen)
+	case *starlark.List, *starlark.Dict, *starlark.Set:
+		if seen[v] {
+			return 0
+		}
+		seen[v] = true
+		iter := v.(starlark.Iterable).Iterate()
+		defer iter.Done()
+		size := 1
+		var item starlark.Value
+		for size <= limit && iter.Next(&item) {
+			size += 1 + arenaValueSize(item, limit-size, seen)
+			if d, ok := v.(*starlark.Dict); ok {
+				value, _, _ := d.Get(item)
+				size += arenaValueSize(value, limit-size, seen)
+			}
+		}
+		return size
+	default:
+		return 1
+	}
+}
+
+// arenaItemsSize returns the total size of values
+func arenaItemsSize(values []starlark.Value, limit int, seen map[starlark.Value]bool) int {
+	size := 1
+	for _, item := range values {
+		if size > limit {
+			break
+		}
+		size += 1 + arenaValueSize(item, limit-size, seen)
+	}
+	return size
+}
+
+// loadArenaScript executes the script and returns the strategy defined by it
+func loadArenaScript(id, source string) (*arenaProgram, error) {
+	if len(source) > maxArenaScript {
+		return nil, fmt.Errorf("script is longer than %d bytes", maxArenaScript)
+	}
+	thread := arenaThread(id)
+	var globals starlark.StringDict
+	err := arenaExec(thread, func() error {
+		prog, err := arenaCompile(id+".star", source)
+		if err != nil {
+			return err
+		}
+		globals, err = prog.Init(thread, arenaPredeclared)
+		// the strategy can't keep the state between moves
+		globals.Freeze()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("script error: %w", err)
+	}
+	fn, ok := globals[arenaScriptFunction].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script has to define function %s(mine, theirs)", arenaScriptFunction)
+	}
+	// the global values are kept while the strategy is loaded
+	values := make([]starlark.Value, 0, len(globals))
+	for _, v := range globals {
+		values = append(values, v)
+	}
+	if arenaItemsSize(values, maxArenaValues, map[starlark.Value]bool{}) > maxArenaValues {
+		return nil, fmt.Errorf("script global values are larger than %d", maxArenaValues)
+	}
+	return &arenaProgram{id: id, move: fn}, nil
+}
+
+// checkArenaScript loads the strategy and makes its first move
+func checkArenaScript(script *ArenaScript) error {
+	p, err := loadArenaScript(script.ID, script.Source)
+	if err != nil {
+		return err
+	}
+	_, err = p.Move(nil, nil)
+	return err
+}
+
+// historyList returns the Starlark list of move names
+func historyList(moves []Gesture) *starlark.List {
+	values := make([]starlark.Value, len(moves))
+	for i, m := range moves {
+		values[i] = starlark.String(m.String())
+	}
+	return starlark.NewList(values)
+}
+
+// Move returns the strategy move by the previous moves of the strategy and of its rival
+func (p *arenaProgram) Move(mine, theirs []Gesture) (Gesture, error) {
+	thread := arenaThread(p.id)
+	var v starlark.Value
+	err := arenaExec(thread, func() (err error) {
+		v, err = starlark.Call(thread, p.move, starlark.Tuple{historyList(mine), historyList(theirs)}, nil)
+		return err
+	})
+	if err != nil {
+		return nothing, fmt.Errorf("strategy %s error: %w", p.id, err)
+	}
+	name, ok := starlark.AsString(v)
+	if !ok {
+		return nothing, fmt.Errorf("strategy %s returned %s instead of string", p.id, v.Type())
+	}
+	rps, _ := gameByName(gameRPS)
+	return parseMove(rps, name)
+}
+
+// arenaToken returns the token of strategy in the arena rounds
+func arenaToken(id string) string {
+	return keyHash(ring.active, arenaHashID, "script:"+id)
+}
+
+// playArenaRound plays the round of strategies' moves by the round rules. It returns the points of strategies.
+func playArenaRound(token1, token2 string, move1, move2 Gesture) (int, int, error) {
+	round := NewRound(token1)
+	round.Attach(token2)
+	secret1, secret2 := newSecret(), newSecret()
+	round.Bet(round.saltedHash(secret1, []byte(move1.String())), token1)
+	round.Bet(round.saltedHash(secret2, []byte(move2.String())), token2)
+	round.Disclose(secret1, move1.String(), token1)
+	round.Disclose(secret2, move2.String(), token2)
+	points := round.PlayerPoints(token1)
+	if points == nil {
+		return 0, 0, fmt.Errorf("arena round %s is not finished", round.ID)
+	}
+	return points.Your, points.Rival, nil
+}
+
+// playArenaMatch plays the match of two strategies. The strategy that fails to move loses the round.
+func playArenaMatch(p1, p2 *arenaProgram) (int, int) {
+	var points1, points2 int
+	var history1, history2 []Gesture
+	token1, token2 := arenaToken(p1.id), arenaToken(p2.id)
+	for i := 0; i < arenaMatchRounds; i++ {
+		move1, err1 := p1.Move(history1, history2)
+		move2, err2 := p2.Move(history2, history1)
+		if err1 != nil || err2 != nil {
+			for _, err := range []error{err1, err2} {
+				if err != nil {
+					log.Printf("arena: %v", err)
+				}
+			}
+			if err1 == nil {
+				points1++
+			}
+			if err2 == nil {
+				points2++
+			}
+			continue
+		}
+		pts1, pts2, err := playArenaRound(token1, token2, move1, move2)
+		if err != nil {
+			log.Printf("arena: %v", err)
+			continue
+		}
+		points1, points2 = points1+pts1, points2+pts2
+		history1, history2 = append(history1, move1), append(history2, move2)
+	}
+	return points1, points2
+}
+
+// runTournament plays the round robin tournament of all strategies and adds the points to the leaderboard.
+// The rejected strategies and the strategies that can't be loaded don't take part. It returns the points of tournament.
+func runTournament() (map[string]int, error) {
+	scripts, err := arena.Scripts()
+	if err != nil {
+		return nil, err
+	}
+	programs := []*arenaProgram{}
+	for _, s := range scripts {
+		if s.Status == arenaRejected {
+			continue
+		}
+		p, err := loadArenaScript(s.ID, s.Source)
+		if err != nil {
+			log.Printf("arena: strategy %s is skipped: %v", s.ID, err)
+			continue
+		}
+		programs = append(programs, p)
+	}
+	// the strategy without points is in the leaderboard too
+	points := make(map[string]int, len(programs))
+	for _, p := range programs {
+		points[p.id] = 0
+	}
+	for i, p1 := range programs {
+		for _, p2 := range programs[i+1:] {
+			pts1, pts2 := playArenaMatch(p1, p2)
+			points[p1.id] += pts1
+			points[p2.id] += pts2
+		}
+	}
+	if len(points) == 0 {
+		return points, nil
+	}
+	return points, arena.AddPoints(points)
+}
+
+// errArenaBusy is returned when the tournament is run by another request or service instance
+var errArenaBusy = errors.New("arena tournament is running already")
+
+// lockArena takes the lock of running tournament, so the tournaments don't overlap. It returns errArenaBusy when
+// the lock is taken.
+func lockArena() (string, error) {
+	token, err := arena.Lock(arenaLockTTL)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", errArenaBusy
+	}
+	return token, nil
+}
+
+// lockedTournament runs the tournament under the lock taken with token. The lock is extended while the tournament
+// is running and released after it.
+func lockedTournament(token string) (map[string]int, error) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(arenaLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if ok, err := arena.Extend(token, arenaLockTTL); err != nil || !ok {
+					log.Printf("arena lock is not extended: %v", err)
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		if err := arena.Unlock(token); err != nil {
+			log.Printf("arena unlock error: %v", err)
+		}
+	}()
+	return runTournament()
+}
+
+// logTournament runs the tournament under the lock taken with token and logs its result
+func logTournament(token string) {
+	points, err := lockedTournament(token)
+	if err != nil {
+		log.Printf("arena tournament error: %v", err)
+		return
+	}
+	log.Printf("arena tournament of %d strategies is finished", len(points))
+}
+
+// arenaJob runs the tournament every interval until stop is closed. Only one service instance runs the tournament.
+func arenaJob(interval time.Duration, stop <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+		if ok, err := arena.Schedule(interval / 2); err != nil || !ok {
+			if err != nil {
+				log.Printf("arena schedule error: %v", err)
+			}
+			continue
+		}
+		token, err := lockArena()
+		if err != nil {
+			log.Printf("arena tournament error: %v", err)
+			continue
+		}
+		logTournament(token)
+	}
+}
+
+// arenaChecks is the queue of uploaded strategies to check
+var arenaChecks = make(chan *ArenaScript, maxArenaScripts)
+
+// arenaCheckJob checks the uploaded strategies one by one until stop is closed. The strategy that isn't checked
+// (e.g. the queue is full or the service is restarted) stays pending and is checked by loading before the tournament.
+func arenaCheckJob(stop <-chan struct{}) {
+	for {
+		var script *ArenaScript
+		select {
+		case script = <-arenaChecks:
+		case <-stop:
+			return
+		}
+		script.Status = arenaAccepted
+		if err := checkArenaScript(script); err != nil {
+			script.Status, script.Error = arenaRejected, err.Error()
+		}
+		if _, err := arena.UpdateScript(script); err != nil {
+			log.Printf("arena: strategy %s update error: %v", script.ID, err)
+			continue
+		}
+		log.Printf("arena: strategy %s is %s", script.ID, script.Status)
+	}
+}
+
+// redisArena is a Redis implementation of ArenaStore interface
+type redisArena struct {
+	r redis.UniversalClient
+}
+
+// NewArenaStore returns a new instance of ArenaStore interface implementing the storage via Redis
+func NewArenaStore(opt redis.UniversalOptions) (ArenaStore, error) {
+	s := &redisArena{redis.NewUniversalClient(&opt)}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+const (
+	arenaScriptsKey     = "arena:scripts"     // hash of strategies JSON by ids
+	arenaLeaderboardKey = "arena:leaderboard" // sorted set of strategies points
+	arenaLockKey        = "arena:lock"        // lock of running tournament
+	arenaScheduleKey    = "arena:scheduled"   // mark of scheduled tournament
+)
+
+// addScript sets the field of hash when the hash has less than ARGV[2] fields
+var addScript = redis.NewScript(`
+if redis.call("HLEN", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[3])
+return 1
+`)
+
+// updateScript sets the field of hash when it exists
+var updateScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// AddScript stores the strategy JSON in the hash of strategies
+func (s *redisArena) AddScript(script *ArenaScript) (bool, error) {
+	data, err := json.Marshal(script)
+	if err != nil {
+		return false, err
+	}
+	n, err := addScript.Run(s.r, []string{arenaScriptsKey}, script.ID, maxArenaScripts, data).Int()
+	return n == 1, err
+}
+
+// UpdateScript replaces the strategy JSON in the hash of strategies
+func (s *redisArena) UpdateScript(script *ArenaScript) (bool, error) {
+	data, err := json.Marshal(script)
+	if err != nil {
+		return false, err
+	}
+	n, err := updateScript.Run(s.r, []string{arenaScriptsKey}, script.ID, data).Int()
+	return n == 1, err
+}
+
+// Script reads the strategy JSON from the hash of strategies
+func (s *redisArena) Script(id string) (*ArenaScript, error) {
+	data, err := s.r.HGet(arenaScriptsKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	script := &ArenaScript{}
+	if err := json.Unmarshal(data, script); err != nil {
+		return nil, fmt.Errorf("wrong arena strategy %s: %w", id, err)
+	}
+	return script, nil
+}
+
+// DeleteScript removes the strategy from the hash of strategies and from the leaderboard sorted set
+func (s *redisArena) DeleteScript(id string) (bool, error) {
+	var deleted *redis.IntCmd
+	_, err := s.r.TxPipelined(func(p redis.Pipeliner) error {
+		deleted = p.HDel(arenaScriptsKey, id)
+		p.ZRem(arenaLeaderboardKey, id)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted.Val() == 1, nil
+}
+
+// Scripts reads the hash of strategies
+func (s *redisArena) Scripts() ([]*ArenaScript, error) {
+	list, err := s.r.HGetAll(arenaScriptsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	scripts := make([]*ArenaScript, 0, len(list))
+	for id, data := range list {
+		script := &ArenaScript{}
+		if err := json.Unmarshal([]byte(data), script); err != nil {
+			return nil, fmt.Errorf("wrong arena strategy %s: %w", id, err)
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+// AddPoints increments the scores of strategies in the leaderboard sorted set
+func (s *redisArena) AddPoints(points map[string]int) error {
+	_, err := s.r.Pipelined(func(p redis.Pipeliner) error {
+		for id, pts := range points {
+			p.ZIncrBy(arenaLeaderboardKey, float64(pts), id)
+		}
+		return nil
+	})
+	return err
+}
+
+// Leaderboard returns the strategies with the highest scores and their names
+func (s *redisArena) Leaderboard(limit int) ([]ArenaEntry, error) {
+	list, err := s.r.ZRevRangeWithScores(arenaLeaderboardKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ArenaEntry, len(list))
+	if len(list) == 0 {
+		return entries, nil
+	}
+	ids := make([]string, len(list))
+	for i, z := range list {
+		ids[i] = z.Member.(string)
+		entries[i] = ArenaEntry{Script: ids[i], Points: int(z.Score), Place: i + 1}
+	}
+	scripts, err := s.r.HMGet(arenaScriptsKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, data := range scripts {
+		if data, ok := data.(string); ok {
+			script := &ArenaScript{}
+			if json.Unmarshal([]byte(data), script) == nil {
+				entries[i].Name = script.Name
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Schedule sets the schedule key when it doesn't exist
+func (s *redisArena) Schedule(ttl time.Duration) (bool, error) {
+	return s.r.SetNX(arenaScheduleKey, nowMilli(), ttl).Result()
+}
+
+// extendLock prolongs the key when it has the value ARGV[1]
+var extendLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+`)
+
+// unlock removes the key when it has the value ARGV[1]
+var unlock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call("DEL", KEYS[1])
+`)
+
+// Lock sets the lock key to the new token when it doesn't exist
+func (s *redisArena) Lock(ttl time.Duration) (string, error) {
+	token := uuid.NewString()
+	ok, err := s.r.SetNX(arenaLockKey, token, ttl).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+// Extend sets the expiration of lock key when it has the token
+func (s *redisArena) Extend(token string, ttl time.Duration) (bool, error) {
+	n, err := extendLock.Run(s.r, []string{arenaLockKey}, token, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Unlock removes the lock key when it has the token
+func (s *redisArena) Unlock(token string) error {
+	return unlock.Run(s.r, []string{arenaLockKey}, token).Err()
+}
+
+// ArenaRequests realizes the requests to the arena:
+// GET /arena/leaderboard[?limit=<n>] - the leaderboard of strategies,
+// GET /arena/script/{id} - the state of uploaded strategy.
+func ArenaRequests(w http.ResponseWriter, req *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/arena/"), "/"), "/")
+	switch {
+	case len(path) == 1 && path[0] == "leaderboard":
+		ArenaLeaderboard(w, req)
+	case len(path) == 2 && path[0] == "script":
+		ArenaScriptState(w, req, path[1])
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// ArenaUpload realizes the request for upload of strategy. The strategy is stored as pending and checked by
+// arenaCheckJob.
+func ArenaUpload(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		Player string `json:"player"`
+		Name   string `json:"name"`
+		Script string `json:"script"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.Player == "" || input.Name == "" || input.Script == "" {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if len(input.Name) > maxArenaName {
+		errMsg := fmt.Sprintf("strategy name is longer than %d", maxArenaName)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if len(input.Script) > maxArenaScript {
+		errMsg := fmt.Sprintf("script is longer than %d bytes", maxArenaScript)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	script := &ArenaScript{
+		ID:      uuid.NewString(),
+		Name:    input.Name,
+		Owner:   keyHash(ring.active, arenaHashID, input.Player),
+		Source:  input.Script,
+		Created: nowMilli(),
+		Status:  arenaPending,
+	}
+	added, err := arena.AddScript(script)
+	if err != nil {
+		storageError(fmt.Errorf("Arena strategy store error: %w", err), w)
+		return
+	}
+	if !added {
+		errMsg := fmt.Sprintf("arena is full (%d strategies)", maxArenaScripts)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusConflict)
+		return
+	}
+	select {
+	case arenaChecks <- script:
+	default:
+		log.Printf("arena: check queue is full, strategy %s stays pending", script.ID)
+	}
+
+	sendResponse(w, struct {
+		Script string `json:"script"`
+		Status string `json:"status"`
+	}{script.ID, script.Status})
+	log.Printf("arena: strategy %s (%s) uploaded by %s", script.ID, script.Name, input.Player)
+}
+
+// ArenaScriptState realizes the request for the state of uploaded strategy
+func ArenaScriptState(w http.ResponseWriter, req *http.Request, id string) {
+	if req.Method != "GET" {
+		http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	script, err := arena.Script(id)
+	if err != nil {
+		storageError(fmt.Errorf("Arena strategy read error: %w", err), w)
+		return
+	}
+	if script == nil {
+		http.NotFound(w, req)
+		return
+	}
+	sendResponse(w, struct {
+		Script string `json:"script"`
+		Name   string `json:"name"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}{script.ID, script.Name, script.Status, script.Error})
+}
+
+// ArenaLeaderboard realizes the request for the leaderboard of strategies
+func ArenaLeaderboard(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > maxArenaLimit {
+		limit = defaultArenaLimit
+	}
+	entries, err := arena.Leaderboard(limit)
+	if err != nil {
+		storageError(fmt.Errorf("Arena leaderboard error: %w", err), w)
+		return
+	}
+	sendResponse(w, struct {
+		Leaderboard []ArenaEntry `json:"leaderboard"`
+	}{entries})
+}
+
+// ArenaRun realizes the administrator's request for the tournament out of schedule. The tournament is run in
+// the background under the lock taken by the request, its points are added to the leaderboard.
+func ArenaRun(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	token, err := lockArena()
+	if errors.Is(err, errArenaBusy) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		storageError(fmt.Errorf("Arena tournament error: %w", err), w)
+		return
+	}
+	go logTournament(token)
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if _, err := w.Write([]byte(`{"status":"running"}`)); err != nil {
+		log.Printf("response writing error: %v", err)
+	}
+}
+
+// ArenaDelete realizes the administrator's request for removal of strategy: DELETE /admin/arena/scripts/{id}
+func ArenaDelete(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "DELETE" {
+		http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(req.URL.Path, "/admin/arena/scripts"), "/")
+	deleted, err := arena.DeleteScript(id)
+	if err != nil {
+		storageError(fmt.Errorf("Arena strategy delete error: %w", err), w)
+		return
+	}
+	if !deleted {
+		http.NotFound(w, req)
+		return
+	}
+	sendResponse(w, struct {
+		Script string `json:"script"`
+	}{id})
+	log.Printf("arena: strategy %s is deleted", id)
+}
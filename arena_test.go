@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	alwaysPaper = `def move(mine, theirs):
+    return "paper"
+`
+	beatLast = `beats = {"stone": "paper", "scissors": "stone", "paper": "scissors"}
+
+def move(mine, theirs):
+    if not theirs:
+        return "stone"
+    return beats[theirs[-1]]
+`
+	// the strategy fails after the first round
+	failing = `def move(mine, theirs):
+    return "scissors" if not mine else mine[5]
+`
+)
+
+func Test1_ArenaScript(t *testing.T) {
+	for source, msg := range map[string]string{
+		"def move(:":                               "script error",
+		"x = 1":                                    "script has to define function move(mine, theirs)",
+		`load("os.star", "os")`:                    "script error",
+		strings.Repeat("#", 20000):                 "script is longer than 16384 bytes",
+		"x = [i for i in range(1000000)]":          "too many steps",
+		`x = "x" * (100 << 20)`:                    "memory limit exceeded",
+		"x = [\"x\" * 1000] * 100\n" + alwaysPaper: "script global values are larger than 65536",
+	} {
+		_, err := loadArenaScript("s1", source)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), msg)
+	}
+
+	for source, msg := range map[string]string{
+		"def move(mine, theirs):\n    return 1":                                      "returned int instead of string",
+		"def move(mine, theirs):\n    return \"heads\"":                              "heads is not a move of rps",
+		"def move(mine, theirs):\n    return move(mine, theirs)":                     "called recursively",
+		"def move(mine, theirs):\n    for i in range(10000000):\n        pass\n":     "too many steps",
+		"def move(mine, theirs):\n    x = \"x\" * (100 << 20)\n    return \"stone\"": "memory limit exceeded",
+	} {
+		p, err := loadArenaScript("s1", source)
+		require.NoError(t, err)
+		_, err = p.Move(nil, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), msg)
+	}
+
+	// the values are limited before they are made by operators, methods and builtins
+	for _, body := range []string{
+		"s = \"x\" * 1000\n    for i in range(20):\n        s += s",
+		"s = [\"x\" * 1000] * 1000\n    x = \"\".join(s * 20)",
+		"s = \"x\" * 100000\n    x = s.replace(\"x\", s)",
+		"s = \"x\" * 100000\n    x = (\"%s\" * 100) % tuple([s] * 100)",
+		"s = \"x\" * 100000\n    x = \"{}\".format([s] * 100)",
+		"s = \"x\" * 100000\n    x = str([s] * 100)",
+		"s = [1] * 400000\n    x = []\n    for i in range(20):\n        x.extend(s)",
+		"s = [1] * 400000\n    x = []\n    for i in range(20):\n        x += s",
+		"s = [1] * 400000\n    x = [s[:] for i in range(20)]",
+		"s = [1] * 400000\n    x = [list(s) for i in range(20)]",
+		"s = [1] * 400000\n    x = [s + s for i in range(10)]",
+		"s = \"x\" * 100000\n    x = getattr(s, \"replace\")(\"x\", s)",
+	} {
+		p, err := loadArenaScript("s1", "def move(mine, theirs):\n    "+body+"\n    return \"stone\"")
+		require.NoError(t, err, body)
+		_, err = p.Move(nil, nil)
+		require.Error(t, err, body)
+		require.Contains(t, err.Error(), errArenaMemory.Error(), body)
+	}
+
+	// the limit is per execution and the values made by the interpreter work as usual
+	p, err := loadArenaScript("s1", `def move(mine, theirs):
+    s = "x" * 1000
+    s += s
+    l = [1, 2]
+    l += [3]
+    d = {"a": 1}
+    d |= {"b": 2}
+    d["a"] += 1
+    x = "%s %d" % ("a", 1) + "{}".format(l[1:]) + ",".join(["a", "b"])
+    if len(s) != 2000 or l != [1, 2, 3] or d != {"a": 2, "b": 2} or x != "a 1[2, 3]a,b":
+        return "fail"
+    return "stone"
+`)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		move, err := p.Move(nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, stone, move)
+	}
+
+	// the cyclic global value is counted once
+	_, err = loadArenaScript("s1", "a = []\na.append(a)\n"+alwaysPaper)
+	require.NoError(t, err)
+
+	p, err = loadArenaScript("s1", beatLast)
+	require.NoError(t, err)
+	move, err := p.Move([]Gesture{stone}, []Gesture{paper, scissors})
+	require.NoError(t, err)
+	require.Equal(t, stone, move)
+
+	// the beating strategy wins all rounds but the first one
+	p2, err := loadArenaScript("s2", alwaysPaper)
+	require.NoError(t, err)
+	points1, points2 := playArenaMatch(p, p2)
+	require.Equal(t, arenaMatchRounds-1, points1)
+	require.Equal(t, 1, points2)
+}
+
+func Test2_ArenaRequests(t *testing.T) {
+	_, err := NewArenaStore(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}})
+	require.Error(t, err)
+
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+	opt := redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}
+	require.NoError(t, redis.NewUniversalClient(&opt).Del(arenaScriptsKey, arenaLeaderboardKey, arenaLockKey, arenaScheduleKey).Err())
+	arena, err = NewArenaStore(opt)
+	require.NoError(t, err)
+	defer func() { arena = nil }()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go arenaCheckJob(stop)
+
+	do := func(method, url string, body interface{}) (int, string) {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, bytes.NewReader(data))
+		req.Header.Set("Authorization", "Bearer arena-token")
+		switch {
+		case url == "/arena/upload":
+			admin("arena-token", ArenaUpload)(w, req)
+		case strings.HasPrefix(url, "/admin/arena/scripts/"):
+			ArenaDelete(w, req)
+		case url == "/admin/arena/run":
+			ArenaRun(w, req)
+		default:
+			ArenaRequests(w, req)
+		}
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	// upload returns the id of pending strategy and waits for the check
+	upload := func(name, source string) (string, string) {
+		code, body := do("POST", "/arena/upload", map[string]string{"player": "a1", "name": name, "script": source})
+		require.Equal(t, http.StatusOK, code, body)
+		res := struct {
+			Script string `json:"script"`
+			Status string `json:"status"`
+		}{}
+		require.NoError(t, json.Unmarshal([]byte(body), &res))
+		require.Equal(t, arenaPending, res.Status)
+		state := struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}{}
+		require.Eventually(t, func() bool {
+			code, body := do("GET", "/arena/script/"+res.Script, nil)
+			require.Equal(t, http.StatusOK, code, body)
+			require.NoError(t, json.Unmarshal([]byte(body), &state))
+			return state.Status != arenaPending
+		}, 5*time.Second, 10*time.Millisecond)
+		return res.Script, state.Error
+	}
+
+	ids := map[string]string{}
+	for name, source := range map[string]string{"paper": alwaysPaper, "beatlast": beatLast, "failing": failing} {
+		id, errMsg := upload(name, source)
+		require.Empty(t, errMsg)
+		ids[name] = id
+	}
+	wrong, errMsg := upload("wrong", "x = 1")
+	require.Equal(t, "script has to define function move(mine, theirs)", errMsg)
+	code, _ := do("POST", "/arena/upload", map[string]string{"player": "a1", "name": "empty"})
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("GET", "/arena/unknown", nil)
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = do("GET", "/arena/script/unknown", nil)
+	require.Equal(t, http.StatusNotFound, code)
+	w := httptest.NewRecorder()
+	admin("arena-token", ArenaUpload)(w, httptest.NewRequest("POST", "/arena/upload", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// the tournament isn't run while another one is running
+	token, err := arena.Lock(time.Second)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	code, body := do("POST", "/admin/arena/run", nil)
+	require.Equal(t, http.StatusConflict, code)
+	require.Equal(t, errArenaBusy.Error(), body)
+	require.NoError(t, arena.Unlock(token))
+
+	// the tournament is run in the background under the lock
+	code, body = do("POST", "/admin/arena/run", nil)
+	require.Equal(t, http.StatusAccepted, code)
+	require.Equal(t, `{"status":"running"}`, body)
+	code, _ = do("POST", "/admin/arena/run", nil)
+	require.Equal(t, http.StatusConflict, code)
+	// beatlast: 9 points against paper, 10 against failing that moves only once;
+	// paper: 1 point against beatlast, 9 against failing that wins the first round with scissors;
+	// the rejected strategy doesn't take part
+	require.Eventually(t, func() bool {
+		code, body = do("GET", "/arena/leaderboard", nil)
+		require.Equal(t, http.StatusOK, code)
+		return strings.Contains(body, ids["failing"])
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, fmt.Sprintf(`{"leaderboard":[{"script":%q,"name":"beatlast","points":19,"place":1},`+
+		`{"script":%q,"name":"paper","points":10,"place":2},{"script":%q,"name":"failing","points":1,"place":3}]}`,
+		ids["beatlast"], ids["paper"], ids["failing"]), body)
+	// the lock is released after the tournament
+	require.Eventually(t, func() bool {
+		token, err := arena.Lock(time.Second)
+		require.NoError(t, err)
+		if token == "" {
+			return false
+		}
+		require.NoError(t, arena.Unlock(token))
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	code, body = do("GET", "/arena/leaderboard?limit=2", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, fmt.Sprintf(`{"leaderboard":[{"script":%q,"name":"beatlast","points":19,"place":1},`+
+		`{"script":%q,"name":"paper","points":10,"place":2}]}`, ids["beatlast"], ids["paper"]), body)
+
+	// the deleted strategy is removed from the leaderboard
+	code, _ = do("DELETE", "/admin/arena/scripts/"+ids["beatlast"], nil)
+	require.Equal(t, http.StatusOK, code)
+	code, _ = do("DELETE", "/admin/arena/scripts/"+ids["beatlast"], nil)
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = do("DELETE", "/admin/arena/scripts/"+wrong, nil)
+	require.Equal(t, http.StatusOK, code)
+	code, body = do("GET", "/arena/leaderboard", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.NotContains(t, body, ids["beatlast"])
+	require.Contains(t, body, ids["paper"])
+
+	// the limit of strategies holds for concurrent uploads
+	var wg sync.WaitGroup
+	var mx sync.Mutex
+	added := 0
+	for i := 0; i < maxArenaScripts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := arena.AddScript(&ArenaScript{ID: uuid.NewString(), Status: arenaPending})
+			require.NoError(t, err)
+			if ok {
+				mx.Lock()
+				added++
+				mx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, maxArenaScripts-2, added)
+	code, _ = do("POST", "/arena/upload", map[string]string{"player": "a1", "name": "full", "script": alwaysPaper})
+	require.Equal(t, http.StatusConflict, code)
+
+	ok, err := arena.Schedule(time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = arena.Schedule(time.Second)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	token, err = arena.Lock(time.Second)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	second, err := arena.Lock(time.Second)
+	require.NoError(t, err)
+	require.Empty(t, second)
+	ok, err = arena.Extend("wrong", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = arena.Extend(token, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, arena.Unlock("wrong"))
+	second, err = arena.Lock(time.Second)
+	require.NoError(t, err)
+	require.Empty(t, second)
+	require.NoError(t, arena.Unlock(token))
+	second, err = arena.Lock(time.Second)
+	require.NoError(t, err)
+	require.NotEmpty(t, second)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// Bots are the built-in opponents. The bot attaches the round created with "opponent":"bot:<name>" as the second
+// player and places the server-assisted bet at once, so its move is committed before the human bets and discloses.
+
+// Strategy is the way of bot to select its move
+type Strategy interface {
+	// Move returns the bot's move of game g by the previous moves of the rival (the oldest first)
+	Move(g Game, history []Gesture) Gesture
+}
+
+// strategies are the available bot strategies by their names
+var strategies = map[string]Strategy{
+	"random":    randomStrategy{},
+	"frequency": frequencyStrategy{},
+	"markov":    markovStrategy{},
+	"beatlast":  beatLastStrategy{},
+}
+
+const (
+	botPrefix     = "bot:" // prefix of the bot opponent name
+	maxBotHistory = 100    // maximal number of the rival's moves used by strategies
+	botHashID     = "bot"  // id used for the hashes of bots' tokens and rivals
+)
+
+// botRand returns the uniform random number in [0, n)
+var botRand = func(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(err)
+	}
+	return int(v.Int64())
+}
+
+// sortedMoves returns the moves of game in the stable order
+func sortedMoves(g Game) []Gesture {
+	moves := g.Moves()
+	sort.Slice(moves, func(i, j int) bool { return moves[i] < moves[j] })
+	return moves
+}
+
+// beating returns the second player's move that wins against the move of the first player.
+// It returns the random move when there is no winning move.
+func beating(g Game, move Gesture) Gesture {
+	moves := sortedMoves(g)
+	for _, m := range moves {
+		if g.Winner(move, m) == second {
+			return m
+		}
+	}
+	return moves[botRand(len(moves))]
+}
+
+// mostFrequent returns the most frequent move of counter or nothing when the counter is empty.
+// The ties are resolved by the order of moves.
+func mostFrequent(g Game, counter map[Gesture]int) Gesture {
+	best, max := nothing, 0
+	for _, m := range sortedMoves(g) {
+		if counter[m] > max {
+			best, max = m, counter[m]
+		}
+	}
+	return best
+}
+
+// randomStrategy plays the uniform random moves
+type randomStrategy struct{}
+
+// Move returns the random move
+func (randomStrategy) Move(g Game, history []Gesture) Gesture {
+	moves := sortedMoves(g)
+	return moves[botRand(len(moves))]
+}
+
+// frequencyStrategy beats the most frequent move of the rival
+type frequencyStrategy struct{}
+
+// Move returns the move beating the most frequent move in history
+func (frequencyStrategy) Move(g Game, history []Gesture) Gesture {
+	counter := map[Gesture]int{}
+	for _, m := range history {
+		counter[m]++
+	}
+	if m := mostFrequent(g, counter); m != nothing {
+		return beating(g, m)
+	}
+	return randomStrategy{}.Move(g, history)
+}
+
+// markovStrategy predicts the rival's move by the first order Markov chain of its history
+type markovStrategy struct{}
+
+// Move returns the move beating the most frequent successor of the rival's last move
+func (markovStrategy) Move(g Game, history []Gesture) Gesture {
+	if len(history) > 0 {
+		last := history[len(history)-1]
+		counter := map[Gesture]int{}
+		for i := 1; i < len(history); i++ {
+			if history[i-1] == last {
+				counter[history[i]]++
+			}
+		}
+		if m := mostFrequent(g, counter); m != nothing {
+			return beating(g, m)
+		}
+	}
+	return randomStrategy{}.Move(g, history)
+}
+
+// beatLastStrategy beats the last move of the rival
+type beatLastStrategy struct{}
+
+// Move returns the move beating the last move in history
+func (beatLastStrategy) Move(g Game, history []Gesture) Gesture {
+	if len(history) == 0 {
+		return randomStrategy{}.Move(g, history)
+	}
+	return beating(g, history[len(history)-1])
+}
+
+// botByOpponent returns the bot strategy name by the opponent option
+func botByOpponent(opponent string) (string, error) {
+	name := strings.TrimPrefix(opponent, botPrefix)
+	if _, ok := strategies[name]; !ok && name != houseBot || name == opponent {
+		return "", fmt.Errorf("unknown opponent: %q", opponent)
+	}
+	return name, nil
+}
+
+// botToken returns the bot's token in rounds with players' hashes made by the server key keyID.
+// The token can't be forged without the server key.
+func botToken(keyID, name string) string {
+	return botPrefix + name + ":" + keyHash(keyID, botHashID, name)
+}
+
+// botRival returns the id of player's history of moves against bots. It is made with the active server key,
+// so the history is started again after the key rotation.
+func botRival(player string) string {
+	return keyHash(ring.active, botHashID, player)
+}
+
+// BotHistoryStore is an interface of the storage of the players' moves against bots
+type BotHistoryStore interface {
+	// Append adds the move of rival in game to its history
+	Append(game, rival string, move Gesture) error
+	// History returns the last moves of rival in game (the oldest first)
+	History(game, rival string) ([]Gesture, error)
+}
+
+// botHistory is the storage of the players' moves against bots. Bots play without history when it is nil.
+var botHistory BotHistoryStore
+
+// redisBotHistory is a Redis implementation of BotHistoryStore interface
+type redisBotHistory struct {
+	r redis.UniversalClient
+}
+
+// NewBotHistoryStore returns a new instance of BotHistoryStore interface implementing the storage via Redis lists
+func NewBotHistoryStore(opt redis.UniversalOptions) (BotHistoryStore, error) {
+	s := &redisBotHistory{redis.NewUniversalClient(&opt)}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// botHistoryKey returns the key of the list of rival's moves in game
+func botHistoryKey(game, rival string) string {
+	return "bot:history:" + game + ":" + rival
+}
+
+// Append pushes the move to the list and trims the list to the last maxBotHistory moves
+func (s *redisBotHistory) Append(game, rival string, move Gesture) error {
+	_, err := s.r.Pipelined(func(p redis.Pipeliner) error {
+		p.RPush(botHistoryKey(game, rival), int(move))
+		p.LTrim(botHistoryKey(game, rival), -maxBotHistory, -1)
+		return nil
+	})
+	return err
+}
+
+// History reads the list of moves
+func (s *redisBotHistory) History(game, rival string) ([]Gesture, error) {
+	list, err := s.r.LRange(botHistoryKey(game, rival), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	history := make([]Gesture, 0, len(list))
+	for _, v := range list {
+		m, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("wrong move in bot history: %q", v)
+		}
+		history = append(history, Gesture(m))
+	}
+	return history, nil
+}
+
+// botPlay attaches the bot of round when it is not attached yet and places the bot's bet.
+// It does nothing for the round without bot.
+func botPlay(round *Round) error {
+	round.mx.Lock()
+	name, keyID, rival, game := round.Bot, round.HashKeyID, round.BotRival, round.game()
+	round.mx.Unlock()
+	if name == "" {
+		return nil
+	}
+	strategy, ok := strategies[name]
+	if !ok && name != houseBot {
+		return fmt.Errorf("unknown bot: %q", name)
+	}
+
+	token := botToken(keyID, name)
+	if !round.Attached() {
+		if res := round.Attach(token); res != "place Your bet, please" {
+			return fmt.Errorf("bot %s can't attach: %s", name, res)
+		}
+	}
+	if name == houseBot {
+		if res, placed := round.HouseBet(token); !placed {
+			return fmt.Errorf("bot %s can't bet: %s", name, res)
+		}
+		return nil
+	}
+
+	var history []Gesture
+	if botHistory != nil {
+		var err error
+		if history, err = botHistory.History(game.Name(), rival); err != nil {
+			return fmt.Errorf("bot history error: %w", err)
+		}
+	}
+	if res, secret := round.AssistedBet(strategy.Move(game, history).String(), token); secret == "" {
+		return fmt.Errorf("bot %s can't bet: %s", name, res)
+	}
+	return nil
+}
+
+// learnBot adds the human's move of finished round to its history against bots
+func learnBot(round *Round) {
+	round.mx.Lock()
+	name, rival, game, move := round.Bot, round.BotRival, round.game().Name(), round.Bet1
+	round.mx.Unlock()
+	// the fallback bot's rounds have no history: the rival is not known at the substitution
+	if botHistory == nil || name == "" || rival == "" {
+		return
+	}
+	if err := botHistory.Append(game, rival, move); err != nil {
+		log.Printf("round: %s - bot history error: %v", round.ID, err)
+	}
+}
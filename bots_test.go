@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_BotStrategies(t *testing.T) {
+	rand := botRand
+	defer func() { botRand = rand }()
+	botRand = func(n int) int { return n - 1 }
+
+	rps, _ := gameByName(gameRPS)
+	pennies, _ := gameByName(gamePennies)
+	for _, c := range []struct {
+		strategy string
+		g        Game
+		history  []Gesture
+		move     Gesture
+	}{
+		{"random", rps, []Gesture{stone}, paper},
+		{"beatlast", rps, nil, paper},
+		{"beatlast", rps, []Gesture{paper, stone}, paper},
+		{"beatlast", rps, []Gesture{stone, scissors}, stone},
+		{"beatlast", pennies, []Gesture{heads}, tails},
+		{"frequency", rps, []Gesture{paper, paper, stone}, scissors},
+		{"frequency", rps, []Gesture{paper, stone}, paper},
+		// the player repeats the move after stone
+		{"markov", rps, []Gesture{stone, scissors, paper, stone, scissors, paper, stone}, stone},
+		{"markov", rps, []Gesture{paper, scissors}, paper},
+	} {
+		require.Equal(t, c.move, strategies[c.strategy].Move(c.g, c.history), c)
+	}
+}
+
+func Test2_BotOptions(t *testing.T) {
+	_, err := NewRoundWithOptions("player1", RoundOptions{Opponent: "bot:beatlast"})
+	require.EqualError(t, err, "bots are not supported")
+	useMemSealKeys(t)
+	_, err = NewRoundWithOptions("player1", RoundOptions{Opponent: "beatlast"})
+	require.EqualError(t, err, `unknown opponent: "beatlast"`)
+	_, err = NewRoundWithOptions("player1", RoundOptions{Opponent: "bot:unknown"})
+	require.Error(t, err)
+	_, err = NewRoundWithOptions("player1", RoundOptions{Opponent: "bot:random", Game: gameMinusOne})
+	require.Error(t, err)
+
+	// the bot commits its move before the human bets
+	tr, err := NewRoundWithOptions("player1", RoundOptions{Opponent: "bot:random"})
+	require.NoError(t, err)
+	require.Equal(t, "random", tr.Bot)
+	require.NoError(t, botPlay(tr))
+	require.Equal(t, StateBetting, tr.State)
+	require.NotEmpty(t, tr.HiddenBet2)
+	require.Equal(t, nothing, tr.Bet2)
+	require.Equal(t, "this round is already full", tr.Attach("player2"))
+	require.Equal(t, "disclose your bet, please", tr.Bet(tr.saltedHash("s1", []byte("stone")), "player1"))
+	require.NotEqual(t, nothing, tr.Bet2)
+	require.Contains(t, tr.Disclose("s1", "stone", "player1"), "your bet: stone")
+}
+
+func Test3_BotService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	// the service changes the key ring and seal keys used by the following tests
+	stored := ring
+	defer func() { ring, sealKeys = stored, nil }()
+	defer stopService(startService(t))
+
+	data, err := request("new", []byte(`{"player":"b1","opponent":"bot:unknown"}`))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `unknown opponent: "bot:unknown"`)
+
+	// the bot beats the repeated move of player
+	round := ""
+	for i, bet := range []string{"stone", "stone", "stone"} {
+		data, err := request("new", []byte(`{"player":"b1","opponent":"bot:beatlast"}`))
+		require.NoError(t, err)
+		created := struct {
+			Round string `json:"round"`
+		}{}
+		require.NoError(t, json.Unmarshal(data, &created))
+		round = created.Round
+		data, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":"b1","bet":%q}`,
+			created.Round, saltedHash("b1", bet))))
+		require.NoError(t, err)
+		require.Equal(t, `{"response":"disclose your bet, please"}`, string(data))
+		data, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":"b1","bet":%q,"secret":"b1"}`,
+			created.Round, bet)))
+		require.NoError(t, err)
+		if i > 0 {
+			require.Contains(t, string(data), "You lose")
+		}
+	}
+
+	// the bot accepts the rematch and places its bet at once
+	data, err = request("rematch", []byte(fmt.Sprintf(`{"round":%q,"player":"b1"}`, round)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"response":"place Your bet, please"`)
+
+	_, err = NewBotHistoryStore(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}})
+	require.Error(t, err)
+}
@@ -90,3 +90,32 @@ func (c *Cache) Retrieve(id string) (*Round, error) {
 
 	return r, nil
 }
+
+// Evict removes the Round from memory cache, so the next Retrieve reads it from db
+func (c *Cache) Evict(id string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.data, id)
+}
+
+// Cached reports whether the Round is in memory cache
+func (c *Cache) Cached(id string) bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	_, ok := c.data[id]
+	return ok
+}
+
+// roundCached reports whether the round is in the memory cache
+func roundCached(id string) bool {
+	c, ok := db.(*Cache)
+	return ok && c.Cached(id)
+}
+
+// evictRound removes the round from the memory cache when the database is cached, so the changes of round
+// that are not stored are dropped
+func evictRound(id string) {
+	if c, ok := db.(*Cache); ok {
+		c.Evict(id)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// Hidden bets (commitments) can be provided in two formats:
+//
+//	legacy: base64url(sha256(bet + secret))
+//	v2:     "v2:" + alg + ":" + base64url(alg(commitDomain, alg, round, player, bet, secret))
+//
+// In the v2 format every field is prefixed by its length (4 bytes, big-endian), so the concatenation is unambiguous,
+// and the commitment is bound to the round and player, so it can't be replayed in another round or by another player.
+// The player is the pseudonym returned by the server (the salted hash of player's token), not the token itself:
+// the commitment is published in the transcript, so it must not depend on the player's credential.
+const (
+	commitV2Prefix = "v2:"
+	commitDomain   = "stone_scissors_paper/commitment/v2"
+)
+
+// commitAlgs are the supported hash algorithms of v2 commitments
+var commitAlgs = map[string]func() hash.Hash{
+	"sha256":      sha256.New,
+	"sha3-256":    sha3.New256,
+	"blake2b-256": func() hash.Hash { h, _ := blake2b.New256(nil); return h },
+}
+
+// encode64 returns BASE64 URL safe encoding without padding
+func encode64(b []byte) string {
+	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(b)
+}
+
+// commitmentV2 returns the v2 commitment of the bet made by the player with pseudonym in the round
+func commitmentV2(alg, round, pseudonym, bet, secret string) string {
+	newHash, ok := commitAlgs[alg]
+	if !ok {
+		return ""
+	}
+	h := newHash()
+	for _, field := range []string{commitDomain, alg, round, pseudonym, strings.ToLower(bet), secret} {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(field)))
+		h.Write(l[:])
+		h.Write([]byte(field))
+	}
+	return commitV2Prefix + alg + ":" + encode64(h.Sum(nil))
+}
+
+// validCommitment checks the format of hidden bet. Any legacy value is accepted as before.
+func validCommitment(hiddenBet string) bool {
+	if !strings.HasPrefix(hiddenBet, commitV2Prefix) {
+		return true
+	}
+	parts := strings.Split(strings.TrimPrefix(hiddenBet, commitV2Prefix), ":")
+	if len(parts) != 2 {
+		return false
+	}
+	if _, ok := commitAlgs[parts[0]]; !ok {
+		return false
+	}
+	h, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(parts[1])
+	return err == nil && len(h) == 32
+}
+
+// commitmentMatches checks that the hidden bet is the commitment of bet and secret made by the player with
+// pseudonym in the round
+func (r *Round) commitmentMatches(hiddenBet, secret, bet, pseudonym string) bool {
+	return matchCommitment(r.ID, hiddenBet, secret, bet, pseudonym)
+}
+
+// matchCommitment checks that the hidden bet is the commitment of bet and secret made by the player with pseudonym
+// in the game with id round (the legacy commitment doesn't depend on the game and player)
+func matchCommitment(round, hiddenBet, secret, bet, pseudonym string) bool {
+	if !strings.HasPrefix(hiddenBet, commitV2Prefix) {
+		h := sha256.Sum256([]byte(bet + secret))
+		return hiddenBet == encode64(h[:])
+	}
+	alg := strings.SplitN(strings.TrimPrefix(hiddenBet, commitV2Prefix), ":", 2)[0]
+	return hiddenBet == commitmentV2(alg, round, pseudonym, bet, secret)
+}
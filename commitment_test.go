@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_commitmentV2Vectors(t *testing.T) {
+	round := "e500c6d1-93b5-4bd9-8ceb-a4a87fe60cd5"
+	// the same vectors are published in README
+	require.Equal(t, "v2:sha256:IE19oUv1Qjnm62Ut9KuKcZ30gJbANq9h17_sHX3GoA4",
+		commitmentV2("sha256", round, "player1", "stone", "my secret"))
+	require.Equal(t, "v2:sha3-256:9q6kiWNsX_goVGspeJRO8zajGFZpSuN3z4_Ee3fSl44",
+		commitmentV2("sha3-256", round, "player1", "stone", "my secret"))
+	require.Equal(t, "v2:blake2b-256:vUJJoj6YiQIsSIg1tkUoLarg35E53-41eviNyWarKWA",
+		commitmentV2("blake2b-256", round, "player1", "stone", "my secret"))
+	require.Equal(t, "", commitmentV2("md5", round, "player1", "stone", "my secret"))
+	// the fields can't be shifted
+	require.NotEqual(t, commitmentV2("sha256", round, "player1", "stone", "my secret"),
+		commitmentV2("sha256", round, "player1", "ston", "emy secret"))
+}
+
+func Test_validCommitment(t *testing.T) {
+	require.True(t, validCommitment("L64zOtDB4yPHkd9ieLH8ghGdzDVn-_2X17Oo2bjDE64"))
+	require.True(t, validCommitment("any legacy value"))
+	require.True(t, validCommitment("v2:sha256:IE19oUv1Qjnm62Ut9KuKcZ30gJbANq9h17_sHX3GoA4"))
+	require.False(t, validCommitment("v2:md5:IE19oUv1Qjnm62Ut9KuKcZ30gJbANq9h17_sHX3GoA4"))
+	require.False(t, validCommitment("v2:sha256:IE19oUv1Qjnm62Ut9KuKcZ30gJbANq9h17_sHX3GoA"))
+	require.False(t, validCommitment("v2:sha256:IE19oUv1Qjnm62Ut9KuKcZ30gJbANq9h17_sHX3GoA4:x"))
+	require.False(t, validCommitment("v2:sha256"))
+}
+
+func Test_commitmentV2Round(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	tr := NewRound(player1)
+	require.Equal(t, "place Your bet, please", tr.Attach(player2))
+
+	res := tr.Bet("v2:md5:IE19oUv1Qjnm62Ut9KuKcZ30gJbANq9h17_sHX3GoA4", player1)
+	require.Equal(t, "unsupported commitment format", res)
+
+	res = tr.Bet(commitmentV2("sha3-256", tr.ID, tr.Pseudonym(player1), "paper", "my secret"), player1)
+	require.Equal(t, "wait for the rival to place its bet", res)
+
+	// the legacy format is still accepted
+	res = tr.Bet(tr.saltedHash("my 2 secret", []byte("stone")), player2)
+	require.Equal(t, "disclose your bet, please", res)
+
+	res = tr.Disclose("my secret", "stone", player1)
+	require.Equal(t, "Your bet is incorrect", res)
+
+	res = tr.Disclose("my secret", "Paper", player1)
+	require.Equal(t, "wait for your rival to disclose its bet", res)
+
+	res = tr.Disclose("my 2 secret", "stone", player2)
+	require.Equal(t, "You lose: your bet: stone, the rival's bet: paper", res)
+}
+
+func Test_commitmentV2Replay(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	tr1 := NewRound(player1)
+	tr1.Attach(player2)
+	tr2 := NewRound(player1)
+	tr2.Attach(player2)
+
+	// the commitment of player1 is copied by player2 in another round
+	bet := commitmentV2("blake2b-256", tr1.ID, tr1.Pseudonym(player1), "paper", "my secret")
+	tr1.Bet(bet, player1)
+	tr2.Bet(bet, player2)
+	tr2.Bet(commitmentV2("blake2b-256", tr2.ID, tr2.Pseudonym(player1), "paper", "my secret"), player1)
+
+	// when player1 discloses the bet in the first round, player2 can't use it in the second one
+	require.Equal(t, "Your bet is incorrect", tr2.Disclose("my secret", "paper", player2))
+	require.Equal(t, "wait for your rival to disclose its bet", tr2.Disclose("my secret", "paper", player1))
+}
@@ -2,32 +2,78 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type config struct {
-	HostPort      string   `default:"localhost:8080"`
-	RedisAddrs    []string `required:"true"`
-	ServerSalt    string   `required:"true"`
-	RedisPassword string
+	HostPort       string   `default:"localhost:8080"`
+	GRPCHostPort   string   `default:"localhost:8081"`
+	RedisAddrs     []string `required:"true"`
+	ServerSalt     string   `required:"true"`
+	ServerKeys     map[string]string
+	ServerKeyID    string
+	RedisPassword  string
+	IdempotencyTTL time.Duration `default:"24h"`
+	SealKeyPeriod  time.Duration `default:"24h"`
+	ResignInterval time.Duration `default:"1h"`
+	ArenaInterval  time.Duration `default:"1h"`
+	AdminToken     string
+	ArenaToken     string // bearer token for the upload of arena strategies, the upload is disabled when it is empty
+	TamperWebhook  string
+	StorageMode    string `default:"blob"`
+	SnapshotEvery  int    `default:"20"`
+	// the fallback bot attaches the open round after this wait of rival, 0 - no fallback bot by default
+	FallbackBotAfter   time.Duration
+	FallbackBotUnrated bool          // the rounds played by the fallback bot are excluded from leagues
+	StakeExpiry        time.Duration `default:"24h"` // the escrowed stakes are refunded when the round isn't resolved in time
 }
 
 const (
-	defaultHostPort = "localhost:8080"
+	defaultHostPort       = "localhost:8080"
+	defaultGRPCHostPort   = "localhost:8081"
+	defaultIdempotencyTTL = 24 * time.Hour
+	defaultSealKeyPeriod  = 24 * time.Hour
+	defaultResignInterval = time.Hour
+	defaultArenaInterval  = time.Hour
+	defaultStakeExpiry    = 24 * time.Hour
+	defaultStorageMode    = storageBlob
+	defaultSnapshotEvery  = 20
+)
+
+const (
+	// storage modes
+	storageBlob   = "blob"   // the round is stored as one JSON value
+	storageEvents = "events" // the events of round are stored in Redis stream
 )
 
 func newConfig() (*config, error) {
 	cfg := config{
-		HostPort:      defaultHostPort,
-		RedisAddrs:    []string{},
-		ServerSalt:    "",
-		RedisPassword: "",
+		HostPort:       defaultHostPort,
+		GRPCHostPort:   defaultGRPCHostPort,
+		RedisAddrs:     []string{},
+		ServerSalt:     "",
+		RedisPassword:  "",
+		IdempotencyTTL: defaultIdempotencyTTL,
+		SealKeyPeriod:  defaultSealKeyPeriod,
+		ServerKeys:     map[string]string{},
+		ResignInterval: defaultResignInterval,
+		ArenaInterval:  defaultArenaInterval,
+		StorageMode:    defaultStorageMode,
+		SnapshotEvery:  defaultSnapshotEvery,
+		StakeExpiry:    defaultStakeExpiry,
 	}
 	val, ok := os.LookupEnv("SSP_HOST_PORT")
 	if ok && len(val) > 0 {
 		cfg.HostPort = val
 	}
+	val, ok = os.LookupEnv("SSP_GRPC_HOST_PORT")
+	if ok && len(val) > 0 {
+		cfg.GRPCHostPort = val
+	}
 	val, ok = os.LookupEnv("SSP_REDIS_PASSWORD")
 	if ok {
 		cfg.RedisPassword = val
@@ -38,11 +84,112 @@ func newConfig() (*config, error) {
 	} else {
 		return nil, errors.New("Environment variable SSP_REDIS_ADDRS is not defined")
 	}
+	val, ok = os.LookupEnv("SSP_SERVER_KEYS")
+	if ok && len(val) > 0 {
+		for _, k := range strings.Split(val, ",") {
+			kv := strings.SplitN(k, ":", 2)
+			if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+				return nil, errors.New("Environment variable SSP_SERVER_KEYS has wrong format")
+			}
+			cfg.ServerKeys[kv[0]] = kv[1]
+		}
+	}
 	val, ok = os.LookupEnv("SSP_SERVER_SALT")
 	if ok && len(val) > 0 {
 		cfg.ServerSalt = val
-	} else {
+		cfg.ServerKeys[""] = val // legacy key has empty id
+	} else if len(cfg.ServerKeys) == 0 {
 		return nil, errors.New("Environment variable SSP_SERVER_SALT is not defined")
 	}
+	val, ok = os.LookupEnv("SSP_SERVER_KEY_ID")
+	if ok {
+		cfg.ServerKeyID = val
+	}
+	if _, ok := cfg.ServerKeys[cfg.ServerKeyID]; !ok {
+		return nil, fmt.Errorf("Environment variable SSP_SERVER_KEY_ID has wrong value: %q", cfg.ServerKeyID)
+	}
+	val, ok = os.LookupEnv("SSP_IDEMPOTENCY_TTL")
+	if ok && len(val) > 0 {
+		ttl, err := time.ParseDuration(val)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("Environment variable SSP_IDEMPOTENCY_TTL has wrong value: %s", val)
+		}
+		cfg.IdempotencyTTL = ttl
+	}
+	val, ok = os.LookupEnv("SSP_SEAL_KEY_PERIOD")
+	if ok && len(val) > 0 {
+		period, err := time.ParseDuration(val)
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("Environment variable SSP_SEAL_KEY_PERIOD has wrong value: %s", val)
+		}
+		cfg.SealKeyPeriod = period
+	}
+	val, ok = os.LookupEnv("SSP_RESIGN_INTERVAL")
+	if ok && len(val) > 0 {
+		interval, err := time.ParseDuration(val)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("Environment variable SSP_RESIGN_INTERVAL has wrong value: %s", val)
+		}
+		cfg.ResignInterval = interval
+	}
+	val, ok = os.LookupEnv("SSP_ARENA_INTERVAL")
+	if ok && len(val) > 0 {
+		interval, err := time.ParseDuration(val)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("Environment variable SSP_ARENA_INTERVAL has wrong value: %s", val)
+		}
+		cfg.ArenaInterval = interval
+	}
+	val, ok = os.LookupEnv("SSP_ADMIN_TOKEN")
+	if ok {
+		cfg.AdminToken = val
+	}
+	val, ok = os.LookupEnv("SSP_ARENA_TOKEN")
+	if ok {
+		cfg.ArenaToken = val
+	}
+	val, ok = os.LookupEnv("SSP_TAMPER_WEBHOOK")
+	if ok {
+		cfg.TamperWebhook = val
+	}
+	val, ok = os.LookupEnv("SSP_STORAGE_MODE")
+	if ok && len(val) > 0 {
+		if val != storageBlob && val != storageEvents {
+			return nil, fmt.Errorf("Environment variable SSP_STORAGE_MODE has wrong value: %s", val)
+		}
+		cfg.StorageMode = val
+	}
+	val, ok = os.LookupEnv("SSP_SNAPSHOT_EVERY")
+	if ok && len(val) > 0 {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("Environment variable SSP_SNAPSHOT_EVERY has wrong value: %s", val)
+		}
+		cfg.SnapshotEvery = n
+	}
+	val, ok = os.LookupEnv("SSP_FALLBACK_BOT_AFTER")
+	if ok && len(val) > 0 {
+		wait, err := time.ParseDuration(val)
+		if err != nil || wait < 0 {
+			return nil, fmt.Errorf("Environment variable SSP_FALLBACK_BOT_AFTER has wrong value: %s", val)
+		}
+		cfg.FallbackBotAfter = wait
+	}
+	val, ok = os.LookupEnv("SSP_FALLBACK_BOT_UNRATED")
+	if ok && len(val) > 0 {
+		unrated, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("Environment variable SSP_FALLBACK_BOT_UNRATED has wrong value: %s", val)
+		}
+		cfg.FallbackBotUnrated = unrated
+	}
+	val, ok = os.LookupEnv("SSP_STAKE_EXPIRY")
+	if ok && len(val) > 0 {
+		expiry, err := time.ParseDuration(val)
+		if err != nil || expiry <= 0 {
+			return nil, fmt.Errorf("Environment variable SSP_STAKE_EXPIRY has wrong value: %s", val)
+		}
+		cfg.StakeExpiry = expiry
+	}
 	return &cfg, nil
 }
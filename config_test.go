@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -28,3 +29,120 @@ func TestConfigFail(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, cfg)
 }
+
+func TestConfigIdempotencyTTL(t *testing.T) {
+	t.Setenv("SSP_REDIS_ADDRS", "some.redis.adr:1234")
+	t.Setenv("SSP_SERVER_SALT", "some.salt")
+	t.Setenv("SSP_IDEMPOTENCY_TTL", "10m")
+	cfg, err := newConfig()
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Minute, cfg.IdempotencyTTL)
+	t.Setenv("SSP_IDEMPOTENCY_TTL", "wrong")
+	cfg, err = newConfig()
+	require.Error(t, err)
+	require.Nil(t, cfg)
+}
+
+func TestConfigServerKeys(t *testing.T) {
+	t.Setenv("SSP_REDIS_ADDRS", "some.redis.adr:1234")
+	t.Setenv("SSP_SERVER_SALT", "")
+	t.Setenv("SSP_SERVER_KEYS", "k1:key1,k2:key:2")
+	t.Setenv("SSP_SERVER_KEY_ID", "k2")
+	cfg, err := newConfig()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"k1": "key1", "k2": "key:2"}, cfg.ServerKeys)
+	require.Equal(t, "k2", cfg.ServerKeyID)
+
+	t.Setenv("SSP_SERVER_SALT", "salt")
+	cfg, err = newConfig()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"": "salt", "k1": "key1", "k2": "key:2"}, cfg.ServerKeys)
+
+	t.Setenv("SSP_SERVER_KEY_ID", "k3")
+	cfg, err = newConfig()
+	require.Error(t, err)
+	require.Nil(t, cfg)
+
+	t.Setenv("SSP_SERVER_KEY_ID", "")
+	t.Setenv("SSP_SERVER_KEYS", "k1")
+	cfg, err = newConfig()
+	require.Error(t, err)
+	require.Nil(t, cfg)
+}
+
+func TestConfigStorageMode(t *testing.T) {
+	t.Setenv("SSP_REDIS_ADDRS", "some.redis.adr:1234")
+	t.Setenv("SSP_SERVER_SALT", "some.salt")
+	cfg, err := newConfig()
+	require.NoError(t, err)
+	require.Equal(t, storageBlob, cfg.StorageMode)
+	require.Equal(t, defaultSnapshotEvery, cfg.SnapshotEvery)
+
+	t.Setenv("SSP_STORAGE_MODE", "events")
+	t.Setenv("SSP_SNAPSHOT_EVERY", "5")
+	cfg, err = newConfig()
+	require.NoError(t, err)
+	require.Equal(t, storageEvents, cfg.StorageMode)
+	require.Equal(t, 5, cfg.SnapshotEvery)
+
+	t.Setenv("SSP_SNAPSHOT_EVERY", "0")
+	_, err = newConfig()
+	require.Error(t, err)
+
+	t.Setenv("SSP_SNAPSHOT_EVERY", "")
+	t.Setenv("SSP_STORAGE_MODE", "files")
+	_, err = newConfig()
+	require.Error(t, err)
+}
+
+func TestConfigFallbackBot(t *testing.T) {
+	t.Setenv("SSP_REDIS_ADDRS", "some.redis.adr:1234")
+	t.Setenv("SSP_SERVER_SALT", "some.salt")
+	cfg, err := newConfig()
+	require.NoError(t, err)
+	require.Zero(t, cfg.FallbackBotAfter)
+	require.False(t, cfg.FallbackBotUnrated)
+
+	t.Setenv("SSP_FALLBACK_BOT_AFTER", "2m")
+	t.Setenv("SSP_FALLBACK_BOT_UNRATED", "true")
+	cfg, err = newConfig()
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Minute, cfg.FallbackBotAfter)
+	require.True(t, cfg.FallbackBotUnrated)
+
+	t.Setenv("SSP_FALLBACK_BOT_UNRATED", "maybe")
+	_, err = newConfig()
+	require.Error(t, err)
+
+	t.Setenv("SSP_FALLBACK_BOT_UNRATED", "")
+	t.Setenv("SSP_FALLBACK_BOT_AFTER", "-1m")
+	_, err = newConfig()
+	require.Error(t, err)
+}
+
+func TestConfigArenaInterval(t *testing.T) {
+	t.Setenv("SSP_REDIS_ADDRS", "some.redis.adr:1234")
+	t.Setenv("SSP_SERVER_SALT", "some.salt")
+	t.Setenv("SSP_ARENA_INTERVAL", "15m")
+	cfg, err := newConfig()
+	require.NoError(t, err)
+	require.Equal(t, 15*time.Minute, cfg.ArenaInterval)
+	t.Setenv("SSP_ARENA_INTERVAL", "0s")
+	_, err = newConfig()
+	require.Error(t, err)
+}
+
+func TestConfigStakeExpiry(t *testing.T) {
+	t.Setenv("SSP_REDIS_ADDRS", "some.redis.adr:1234")
+	t.Setenv("SSP_SERVER_SALT", "some.salt")
+	cfg, err := newConfig()
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, cfg.StakeExpiry)
+	t.Setenv("SSP_STAKE_EXPIRY", "30m")
+	cfg, err = newConfig()
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Minute, cfg.StakeExpiry)
+	t.Setenv("SSP_STAKE_EXPIRY", "0s")
+	_, err = newConfig()
+	require.Error(t, err)
+}
@@ -2,4 +2,4 @@
 
 ### sample command file to run service in docker
 
-docker run --name stone_scissors_paper -d -p 8080:8080 --env-file .env stone_scissors_paper
\ No newline at end of file
+docker run --name stone_scissors_paper -d -p 8080:8080 -p 8081:8081 --env-file .env stone_scissors_paper
\ No newline at end of file
@@ -0,0 +1,140 @@
+package main
+
+import "fmt"
+
+// Game is the definition of simultaneous-move game played by the commit-reveal rounds.
+// The game supplies the move space and the payoff function, the round does the rest.
+type Game interface {
+	// Name returns the game name used at the round creation
+	Name() string
+	// Moves returns the move space of game
+	Moves() []Gesture
+	// Winner returns the winner selection ('first'|'second'|'draw') by the moves of players
+	Winner(move1, move2 Gesture) int
+	// Points returns the points scored by players with their moves
+	Points(move1, move2 Gesture) (int, int)
+}
+
+const (
+	// moves of matching pennies
+	heads Gesture = iota + 7
+	tails
+	// moves of odd-or-even
+	one
+	two
+)
+
+const (
+	// game names
+	gameRPS      = "rps"       // stone, scissors, paper
+	gamePennies  = "pennies"   // matching pennies: the first player wins when the pennies match
+	gameOddEven  = "odd-even"  // odd-or-even: the first player wins when the sum of fingers is odd
+	gameMinusOne = "minus-one" // "minus one": two-stage stone scissors paper (see minusone.go)
+	gameGlico    = "glico"     // stone scissors paper where the win scores the points of winning gesture
+	defaultGame  = gameRPS
+)
+
+// matrixGame is the game defined by the payoff matrix
+type matrixGame struct {
+	name   string
+	payoff map[Gesture]map[Gesture]int // winner selection by moves
+	points map[Gesture]map[Gesture]int // points of the move against the rival's move, nil - 1 point for the win
+}
+
+// Name returns the game name
+func (g *matrixGame) Name() string {
+	return g.name
+}
+
+// Moves returns the moves of payoff matrix
+func (g *matrixGame) Moves() []Gesture {
+	moves := []Gesture{}
+	for m := range g.payoff {
+		moves = append(moves, m)
+	}
+	return moves
+}
+
+// Winner returns the payoff matrix value
+func (g *matrixGame) Winner(move1, move2 Gesture) int {
+	return g.payoff[move1][move2]
+}
+
+// Points returns the points by the points matrix or 1 point for the winner when there is no matrix
+func (g *matrixGame) Points(move1, move2 Gesture) (int, int) {
+	if g.points != nil {
+		return g.points[move1][move2], g.points[move2][move1]
+	}
+	switch g.Winner(move1, move2) {
+	case first:
+		return 1, 0
+	case second:
+		return 0, 1
+	}
+	return 0, 0
+}
+
+// games are the available games by their names
+var games = map[string]Game{
+	gameRPS: &matrixGame{name: gameRPS, payoff: rules},
+	// the moves of "minus one" are the withdrawn gestures, its winner is selected by the remaining gestures
+	gameMinusOne: &matrixGame{name: gameMinusOne, payoff: rules},
+	gameGlico: &matrixGame{name: gameGlico, payoff: rules, points: map[Gesture]map[Gesture]int{
+		stone:    {scissors: 1},
+		scissors: {paper: 2},
+		paper:    {stone: 5},
+	}},
+	gamePennies: &matrixGame{name: gamePennies, payoff: map[Gesture]map[Gesture]int{
+		heads: {heads: first, tails: second},
+		tails: {heads: second, tails: first},
+	}},
+	gameOddEven: &matrixGame{name: gameOddEven, payoff: map[Gesture]map[Gesture]int{
+		one: {one: second, two: first},
+		two: {one: first, two: second},
+	}},
+}
+
+// gameByName returns the game by its name. The empty name is the default game.
+func gameByName(name string) (Game, error) {
+	if name == "" {
+		name = defaultGame
+	}
+	g, ok := games[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown game: %q", name)
+	}
+	return g, nil
+}
+
+// parseMove returns the move of game by its name
+func parseMove(g Game, name string) (Gesture, error) {
+	m, err := ParseGesture(name)
+	if err != nil {
+		return nothing, err
+	}
+	for _, gm := range g.Moves() {
+		if gm == m {
+			return m, nil
+		}
+	}
+	return nothing, fmt.Errorf("%s is not a move of %s", name, g.Name())
+}
+
+// game returns the game of round. The rounds of unknown games can't be played: their moves are not accepted.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) game() Game {
+	g, err := gameByName(r.Game)
+	if err != nil {
+		return &matrixGame{name: r.Game}
+	}
+	return g
+}
+
+// moves returns the moves resolved by the game: the open bets or the remaining gestures of "minus one" round.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) moves() (Gesture, Gesture) {
+	if r.Game == gameMinusOne {
+		return remaining(r.pair(r.Player1), r.Bet1), remaining(r.pair(r.Player2), r.Bet2)
+	}
+	return r.Bet1, r.Bet2
+}
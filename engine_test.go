@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_Games(t *testing.T) {
+	for name, c := range map[string]struct {
+		move1, move2 string
+		res1, res2   string
+		foreign      string
+	}{
+		"pennies":  {"heads", "heads", "You won: your bet: heads, the rival's bet: heads", "You lose: your bet: heads, the rival's bet: heads", "scissors"},
+		"odd-even": {"one", "two", "You won: your bet: one, the rival's bet: two", "You lose: your bet: two, the rival's bet: one", "tails"},
+		"rps":      {"paper", "paper", "draw: your bet: paper, the rival's bet: paper", "draw: your bet: paper, the rival's bet: paper", "one"},
+	} {
+		tr, err := NewGameRound("player1", name)
+		require.NoError(t, err)
+		if name == gameRPS {
+			require.Empty(t, tr.Game)
+		} else {
+			require.Equal(t, name, tr.Game)
+		}
+		tr.Attach("player2")
+		tr.Bet(tr.saltedHash("s1", []byte(c.move1)), "player1")
+		tr.Bet(tr.saltedHash("s2", []byte(c.move2)), "player2")
+		// the moves of another game are not accepted
+		require.Equal(t, "unknown bet", tr.Disclose("s1", c.foreign, "player1"), name)
+		tr.Disclose("s1", c.move1, "player1")
+		require.Equal(t, c.res2, tr.Disclose("s2", c.move2, "player2"), name)
+		require.Equal(t, c.res1, tr.Result("player1"), name)
+
+		transcript, res := tr.Transcript()
+		require.Empty(t, res)
+		require.Equal(t, tr.Game, transcript.Game)
+	}
+
+	_, err := NewGameRound("player1", "chess")
+	require.Error(t, err)
+}
+
+func Test2_GamePayoff(t *testing.T) {
+	pennies, err := gameByName(gamePennies)
+	require.NoError(t, err)
+	require.Equal(t, second, pennies.Winner(heads, tails))
+	require.Equal(t, first, pennies.Winner(tails, tails))
+	require.ElementsMatch(t, []Gesture{heads, tails}, pennies.Moves())
+
+	oddEven, err := gameByName(gameOddEven)
+	require.NoError(t, err)
+	require.Equal(t, first, oddEven.Winner(two, one))
+	require.Equal(t, second, oddEven.Winner(two, two))
+
+	rps, err := gameByName("")
+	require.NoError(t, err)
+	require.Equal(t, first, rps.Winner(stone, scissors))
+
+	_, err = parseMove(rps, "heads")
+	require.Error(t, err)
+	m, err := parseMove(oddEven, "Two")
+	require.NoError(t, err)
+	require.Equal(t, two, m)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RoundEvent is the record of action with round. The event of rejected action has no patch.
+type RoundEvent struct {
+	Type     string                     `json:"type"`               // action type
+	Player   string                     `json:"player,omitempty"`   // hash of player's token
+	Input    map[string]string          `json:"input,omitempty"`    // action parameters provided by player
+	Response string                     `json:"response,omitempty"` // action response
+	Time     int64                      `json:"time"`               // server time (Unix time in milliseconds)
+	Patch    map[string]json.RawMessage `json:"patch,omitempty"`    // changed round fields, null - removed field
+}
+
+const (
+	// round event types
+	eventCreated  = "created"
+	eventAttach   = "attach"
+	eventBet      = "bet"
+	eventDisclose = "disclose"
+	eventResigned = "resigned"
+	eventRematch  = "rematch"
+	eventReplay   = "replay"
+	eventCancel   = "cancel"
+	eventResolved = "resolved" // the resolution hooks of finished round are completed
+	eventStored   = "stored"   // the whole round is stored (e.g. restored from the audit trail), it replaces all fields
+)
+
+// recordEvents enables the recording of round events. It is set in the event-sourced storage mode,
+// the rounds don't make events in other modes.
+var recordEvents bool
+
+// fields returns the round fields as they are stored
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) fields() map[string]json.RawMessage {
+	data, _ := json.Marshal(r)
+	f := map[string]json.RawMessage{}
+	_ = json.Unmarshal(data, &f)
+	return f
+}
+
+// eventFields returns the round fields before the action for the event patch. It returns nil when the events
+// are not recorded, so the round is not marshaled for nothing.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) eventFields() map[string]json.RawMessage {
+	if !recordEvents {
+		return nil
+	}
+	return r.fields()
+}
+
+// record adds the event of action to the not stored events of round. The patch is made by the round fields
+// before the action. It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) record(typ, player string, input map[string]string, before map[string]json.RawMessage, res *string) {
+	if !recordEvents {
+		return
+	}
+	e := RoundEvent{Type: typ, Input: input, Time: nowMilli()}
+	if player != "" {
+		e.Player = r.roundSaltedHash(player)
+	}
+	if res != nil {
+		e.Response = *res
+	}
+	after := r.fields()
+	for k, v := range after {
+		if !bytes.Equal(before[k], v) {
+			if e.Patch == nil {
+				e.Patch = map[string]json.RawMessage{}
+			}
+			e.Patch[k] = v
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			if e.Patch == nil {
+				e.Patch = map[string]json.RawMessage{}
+			}
+			e.Patch[k] = json.RawMessage("null")
+		}
+	}
+	r.events = append(r.events, e)
+}
+
+// DrainEvents returns the not stored events of round and forgets them
+func (r *Round) DrainEvents() []RoundEvent {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// foldEvents applies the patches of events to the round fields. The stored round replaces all fields.
+func foldEvents(fields map[string]json.RawMessage, events []RoundEvent) {
+	for _, e := range events {
+		if e.Type == eventStored {
+			for k := range fields {
+				delete(fields, k)
+			}
+		}
+		for k, v := range e.Patch {
+			if bytes.Equal(v, []byte("null")) {
+				delete(fields, k)
+			} else {
+				fields[k] = v
+			}
+		}
+	}
+}
+
+// RoundEvents is an interface of the persistence layer that keeps the events of rounds
+type RoundEvents interface {
+	Events(id string) ([]RoundEvent, error)
+}
+
+// eventDB is an event-sourced Redis implementation of Database interface.
+// The events of round are appended to Redis stream, the round is rebuilt by folding its events
+// starting from the last snapshot.
+type eventDB struct {
+	r             redis.UniversalClient
+	snapshotEvery int // the snapshot is made when the stream gets so many events
+}
+
+// snapshot is the stored round fields made by folding the events till the stream entry Last
+type snapshot struct {
+	Fields map[string]json.RawMessage `json:"fields"`
+	Last   string                     `json:"last"`
+}
+
+// the keys of round have the same hash tag to be in one slot of Redis cluster
+func eventsKey(id string) string   { return "{" + id + "}:events" }
+func snapshotKey(id string) string { return "{" + id + "}:snapshot" }
+
+// NewEventDatabase returns a new instance of Database interface implementing the event-sourced persistence layer
+// via Redis streams. The round snapshot is made every snapshotEvery events.
+func NewEventDatabase(opt redis.UniversalOptions, snapshotEvery int) (Database, error) {
+	db := &eventDB{redis.NewUniversalClient(&opt), snapshotEvery}
+	// try to ping database
+	if err := db.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Store appends the not stored events of round. When there are no such events the whole round is stored
+// as one event. The round is also added to the round history. The snapshot is made when the stream
+// gets the next snapshotEvery events.
+func (db *eventDB) Store(round *Round) error {
+	events := round.DrainEvents()
+	if len(events) == 0 {
+		round.mx.Lock()
+		events = []RoundEvent{{Type: eventStored, Time: nowMilli(), Patch: round.fields()}}
+		round.mx.Unlock()
+	}
+	data, _ := json.Marshal(round)
+	var last *redis.StringCmd
+	var length *redis.IntCmd
+	_, err := db.r.Pipelined(func(p redis.Pipeliner) error {
+		for _, e := range events {
+			ev, _ := json.Marshal(e)
+			last = p.XAdd(&redis.XAddArgs{Stream: eventsKey(round.ID), Values: map[string]interface{}{"event": ev}})
+		}
+		length = p.XLen(eventsKey(round.ID))
+		p.Expire(eventsKey(round.ID), time.Hour*8760)
+		p.LPush(historyKey(round.ID), data)
+		p.LTrim(historyKey(round.ID), 0, historyLength-1)
+		p.Expire(historyKey(round.ID), time.Hour*8760)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	n, every := length.Val(), int64(db.snapshotEvery)
+	if n/every > (n-int64(len(events)))/every {
+		if err := db.snapshot(round.ID, last.Val()); err != nil {
+			// the round is rebuilt from the previous snapshot
+			log.Printf("round: %s - snapshot error: %v", round.ID, err)
+		}
+	}
+	return nil
+}
+
+// snapshot stores the round fields made by folding the events till the stream entry last
+func (db *eventDB) snapshot(id, last string) error {
+	s := snapshot{Fields: map[string]json.RawMessage{}, Last: "-"}
+	data, err := db.r.Get(snapshotKey(id)).Bytes()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("wrong snapshot of round %s: %w", id, err)
+		}
+	}
+	if _, err := db.fold(id, &s, last); err != nil {
+		return err
+	}
+	data, _ = json.Marshal(s)
+	return db.r.Set(snapshotKey(id), data, time.Hour*8760).Err()
+}
+
+// fold applies the events after the snapshot till the stream entry end ("+" - the last one) to the snapshot.
+// It returns the number of applied events.
+func (db *eventDB) fold(id string, s *snapshot, end string) (int, error) {
+	msgs, err := db.r.XRange(eventsKey(id), s.Last, end).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(msgs) > 0 && msgs[0].ID == s.Last {
+		msgs = msgs[1:] // the start of range is inclusive
+	}
+	events, err := decodeEvents(msgs)
+	if err != nil {
+		return 0, fmt.Errorf("wrong event of round %s: %w", id, err)
+	}
+	foldEvents(s.Fields, events)
+	if len(msgs) > 0 {
+		s.Last = msgs[len(msgs)-1].ID
+	}
+	return len(msgs), nil
+}
+
+// Retrieve rebuilds the round from the last snapshot and following events, the database is not changed.
+// The quarantined round is reported as not existing.
+func (db *eventDB) Retrieve(id string) (*Round, error) {
+	var snap *redis.StringCmd
+	var quarantined *redis.IntCmd
+	_, err := db.r.Pipelined(func(p redis.Pipeliner) error {
+		snap = p.Get(snapshotKey(id))
+		quarantined = p.Exists(quarantineKey(id))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if quarantined.Val() > 0 {
+		return nil, redis.Nil
+	}
+	s := snapshot{Fields: map[string]json.RawMessage{}, Last: "-"}
+	if data, err := snap.Bytes(); err == nil {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("wrong snapshot of round %s: %w", id, err)
+		}
+	}
+	n, err := db.fold(id, &s, "+")
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 && s.Last == "-" {
+		return nil, redis.Nil
+	}
+	data, _ := json.Marshal(s.Fields)
+	round := &Round{}
+	if err := json.Unmarshal(data, round); err != nil {
+		return nil, err
+	}
+	return round, nil
+}
+
+// Events returns all stored events of round
+func (db *eventDB) Events(id string) ([]RoundEvent, error) {
+	msgs, err := db.r.XRange(eventsKey(id), "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, redis.Nil
+	}
+	return decodeEvents(msgs)
+}
+
+// ForEachRound calls fn for each stored round till fn returns an error
+func (db *eventDB) ForEachRound(fn func(id string) error) error {
+	pattern := eventsKey(roundKeys)
+	scan := func(c redis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := c.Scan(cursor, pattern, 100).Result()
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				id := strings.TrimSuffix(strings.TrimPrefix(key, "{"), "}:events")
+				if err := fn(id); err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	if cluster, ok := db.r.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(func(c *redis.Client) error { return scan(c) })
+	}
+	return scan(db.r)
+}
+
+// decodeEvents decodes the stream entries
+func decodeEvents(msgs []redis.XMessage) ([]RoundEvent, error) {
+	events := make([]RoundEvent, 0, len(msgs))
+	for _, m := range msgs {
+		data, ok := m.Values["event"].(string)
+		if !ok {
+			return nil, errors.New("event is missed in stream entry " + m.ID)
+		}
+		e := RoundEvent{}
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_EventsFold(t *testing.T) {
+	recordEvents = true
+	defer func() { recordEvents = false }()
+	player1 := "player1"
+	player2 := "player2"
+
+	tr := NewRound(player1)
+	tr.Attach(player2)
+	tr.Bet(tr.saltedHash("my secret", []byte("paper")), player1)
+	tr.Bet(tr.saltedHash("my 2 secret", []byte("stone")), player2)
+	tr.Disclose("wrong secret", "paper", player1)
+	tr.Disclose("my secret", "paper", player1)
+
+	events := tr.DrainEvents()
+	require.Empty(t, tr.DrainEvents())
+	types := []string{}
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []string{eventCreated, eventAttach, eventBet, eventBet, eventDisclose, eventDisclose}, types)
+
+	// the failed attempt is recorded with the player's input but it doesn't change the round
+	require.Equal(t, "Your bet is incorrect", events[4].Response)
+	require.Equal(t, map[string]string{"bet": "paper", "secret": "wrong secret"}, events[4].Input)
+	require.Equal(t, tr.Player1, events[4].Player)
+	require.Empty(t, events[4].Patch)
+
+	fields := map[string]json.RawMessage{}
+	foldEvents(fields, events)
+	data, _ := json.Marshal(fields)
+	folded := &Round{}
+	require.NoError(t, json.Unmarshal(data, folded))
+	require.Equal(t, tr, folded)
+
+	// the stored round replaces all fields, so the fields absent in the round are nulled
+	fields["forged"] = json.RawMessage(`"value"`)
+	foldEvents(fields, []RoundEvent{{Type: eventStored, Patch: tr.fields()}})
+	require.NotContains(t, fields, "forged")
+	require.Equal(t, tr.fields(), fields)
+
+	// the events are not recorded in other storage modes
+	recordEvents = false
+	tr = NewRound(player1)
+	tr.Attach(player2)
+	require.Empty(t, tr.DrainEvents())
+}
+
+func Test2_EventDatabase(t *testing.T) {
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+	opt := redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}
+
+	_, err = NewEventDatabase(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}}, 3)
+	require.Error(t, err)
+
+	d, err := NewEventDatabase(opt, 3)
+	require.NoError(t, err)
+	recordEvents = true
+	defer func() { recordEvents = false }()
+	edb := d.(*eventDB)
+
+	player1 := "player1"
+	player2 := "player2"
+
+	tr := NewRound(player1)
+	require.NoError(t, d.Store(tr))
+	tr.Attach(player2)
+	tr.Bet(tr.saltedHash("my secret", []byte("paper")), player1)
+	require.NoError(t, d.Store(tr))
+
+	// the stream got 3 events, so the store made the snapshot
+	require.Equal(t, int64(1), edb.r.Exists(snapshotKey(tr.ID)).Val())
+	require.NoError(t, edb.r.Del(snapshotKey(tr.ID)).Err())
+	rr, err := d.Retrieve(tr.ID)
+	require.NoError(t, err)
+	require.Equal(t, tr, rr)
+	// the retrieving doesn't change the database
+	require.Equal(t, int64(0), edb.r.Exists(snapshotKey(tr.ID)).Val())
+
+	rr.Bet(tr.saltedHash("my 2 secret", []byte("stone")), player2)
+	rr.Disclose("my secret", "paper", player1)
+	require.Equal(t, "You lose: your bet: stone, the rival's bet: paper", rr.Disclose("my 2 secret", "stone", player2))
+	require.NoError(t, d.Store(rr))
+
+	rr2, err := d.Retrieve(tr.ID)
+	require.NoError(t, err)
+	require.Equal(t, rr, rr2)
+	require.True(t, rr2.Finished())
+
+	events, err := d.(RoundEvents).Events(tr.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 6)
+
+	// the round without new events is stored as a whole
+	require.NoError(t, d.Store(rr2))
+	events, err = d.(RoundEvents).Events(tr.ID)
+	require.NoError(t, err)
+	require.Equal(t, eventStored, events[6].Type)
+	rr3, err := d.Retrieve(tr.ID)
+	require.NoError(t, err)
+	require.Equal(t, rr2, rr3)
+
+	found := false
+	err = d.(RoundLister).ForEachRound(func(id string) error {
+		found = found || id == tr.ID
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// the quarantined round is not available
+	require.NoError(t, edb.r.Set(quarantineKey(tr.ID), "", 0).Err())
+	_, err = d.Retrieve(tr.ID)
+	require.ErrorIs(t, err, redis.Nil)
+	require.NoError(t, edb.r.Del(quarantineKey(tr.ID)).Err())
+
+	_, err = d.Retrieve("Non-existing_key")
+	require.ErrorIs(t, err, redis.Nil)
+	_, err = d.(RoundEvents).Events("Non-existing_key")
+	require.ErrorIs(t, err, redis.Nil)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// The fallback bot is the house bot that attaches the open round when no rival attached it in time. The bot attaches
+// at the first request to the round after the wait, so the creator gets the game when it requests the result.
+
+var (
+	// fallbackAfter is the default wait of the rival, 0 - the rounds have no fallback bot by default
+	fallbackAfter time.Duration
+	// fallbackUnrated excludes the rounds played by the fallback bot from leagues
+	fallbackUnrated bool
+)
+
+// parseFallback returns the wait of the rival by the request option: empty - the default wait,
+// "0" - no fallback bot, otherwise the duration in Go format
+func parseFallback(val string) (time.Duration, error) {
+	if val == "" {
+		return fallbackAfter, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("wrong fallback_after: %s", val)
+	}
+	return d, nil
+}
+
+// claimFallback checks that the fallback bot has to attach the open round now and assigns the house bot to the round
+// under the same lock, so the bot is not attached by concurrent requests twice. It returns true when the round is claimed.
+func (r *Round) claimFallback() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.FallbackAt == 0 || r.NoFallback || r.Bot != "" || r.state() != StateOpen || nowMilli() < r.FallbackAt || !r.validSignature() {
+		return false
+	}
+	r.Bot = houseBot
+	r.reSing()
+	return true
+}
+
+// failFallback marks the round that the fallback bot failed to attach, so the round is left to the rival
+func (r *Round) failFallback() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if !r.validSignature() {
+		return
+	}
+	r.NoFallback = true
+	r.reSing()
+}
+
+// setSubstitute marks the round as played by the fallback bot after the bot attached it
+func (r *Round) setSubstitute() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.Substitute, r.Unrated = true, fallbackUnrated
+	r.reSing()
+}
+
+// Substituted returns true when the rival is the fallback bot
+func (r *Round) Substituted() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.Substitute
+}
+
+// substitute attaches the fallback bot to the open round when the wait of rival is over.
+// It returns the round to play and true when the bot is attached. When the bot fails the round is evicted
+// from the memory cache, so the changes made by the bot are rolled back, and the round read again is stored
+// with the mark of failed fallback, so the bot doesn't try to attach it at the following requests.
+func substitute(round *Round) (*Round, bool, error) {
+	if !round.claimFallback() {
+		return round, false, nil
+	}
+	if err := botPlay(round); err != nil {
+		log.Printf("round: %s - fallback bot error: %v", round.ID, err)
+		evictRound(round.ID)
+		if round, err = retrieve(round.ID); err != nil {
+			return nil, false, err
+		}
+		round.failFallback()
+		if err = db.Store(round); err != nil {
+			evictRound(round.ID)
+			return nil, false, fmt.Errorf("Round store error: %w", err)
+		}
+		return round, false, nil
+	}
+	round.setSubstitute()
+	log.Printf("round: %s - fallback bot attached", round.ID)
+	return round, true, nil
+}
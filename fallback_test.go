@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_FallbackOption(t *testing.T) {
+	stored := fallbackAfter
+	defer func() { fallbackAfter = stored }()
+	fallbackAfter = time.Minute
+
+	for val, wait := range map[string]time.Duration{"": time.Minute, "0": 0, "30s": 30 * time.Second} {
+		d, err := parseFallback(val)
+		require.NoError(t, err)
+		require.Equal(t, wait, d)
+	}
+	for _, val := range []string{"-1s", "1"} {
+		_, err := parseFallback(val)
+		require.Error(t, err)
+	}
+
+	_, err := NewRoundWithOptions("player1", RoundOptions{Fallback: time.Second})
+	require.EqualError(t, err, "fallback bot is not supported")
+	tr, err := NewRoundWithOptions("player1", RoundOptions{})
+	require.NoError(t, err)
+	require.False(t, tr.claimFallback())
+
+	// the fallback bot is claimed once
+	tr.FallbackAt = nowMilli()
+	tr.reSing()
+	require.True(t, tr.claimFallback())
+	require.False(t, tr.claimFallback())
+	require.False(t, tr.Substitute)
+
+	// the round marked by the failed fallback isn't claimed
+	tr, err = NewRoundWithOptions("player1", RoundOptions{})
+	require.NoError(t, err)
+	tr.FallbackAt = nowMilli()
+	tr.reSing()
+	tr.failFallback()
+	require.True(t, tr.NoFallback)
+	require.False(t, tr.claimFallback())
+}
+
+func Test2_FallbackService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	t.Setenv("SSP_FALLBACK_BOT_AFTER", "1h")
+	t.Setenv("SSP_FALLBACK_BOT_UNRATED", "true")
+	stored := ring
+	defer func() { ring, sealKeys, house, fallbackAfter, fallbackUnrated = stored, nil, nil, 0, false }()
+	defer stopService(startService(t))
+
+	league := uuid.NewString()
+	data, err := request("new", []byte(fmt.Sprintf(`{"player":"f1","league":%q,"fallback_after":"50ms"}`, league)))
+	require.NoError(t, err)
+	created := struct {
+		Round string `json:"round"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &created))
+	data, err = request("result", []byte(fmt.Sprintf(`{"round":%q,"player":"f1"}`, created.Round)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"response":"wait for rival attach"`)
+
+	// the bot attaches the round at the first request after the wait
+	time.Sleep(60 * time.Millisecond)
+	data, err = request("result", []byte(fmt.Sprintf(`{"round":%q,"player":"f1"}`, created.Round)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"response":"place Your bet, please"`)
+	require.Contains(t, string(data), `"substitute":true`)
+	data, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":"f2"}`, created.Round)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"this round is already full"}`, string(data))
+
+	_, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":"f1","bet":%q}`,
+		created.Round, saltedHash("f1", "paper"))))
+	require.NoError(t, err)
+	data, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":"f1","bet":"paper","secret":"f1"}`,
+		created.Round)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"house":{`)
+
+	// the round is unrated
+	data, err = request("league", []byte(fmt.Sprintf(`{"league":%q}`, league)))
+	require.NoError(t, err)
+	require.Equal(t, `{"standings":[]}`, string(data))
+
+	// the default wait is used without the option
+	data, err = request("new", []byte(`{"player":"f1"}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &created))
+	round, err := db.Retrieve(created.Round)
+	require.NoError(t, err)
+	require.Equal(t, round.Times.Created+time.Hour.Milliseconds(), round.FallbackAt)
+	// the round made by gRPC request has the default wait too
+	resp, err := grpcClient(t).NewRound(context.Background(), &NewRoundRequest{Player: "f1"})
+	require.NoError(t, err)
+	round, err = db.Retrieve(resp.Round)
+	require.NoError(t, err)
+	require.Equal(t, round.Times.Created+time.Hour.Milliseconds(), round.FallbackAt)
+
+	// the minus-one round has no fallback bot
+	data, err = request("new", []byte(`{"player":"f1","game":"minus-one"}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &created))
+	round, err = db.Retrieve(created.Round)
+	require.NoError(t, err)
+	require.Zero(t, round.FallbackAt)
+	resp, err = grpcClient(t).NewRound(context.Background(), &NewRoundRequest{Player: "f1", Game: gameMinusOne})
+	require.NoError(t, err)
+	round, err = db.Retrieve(resp.Round)
+	require.NoError(t, err)
+	require.Zero(t, round.FallbackAt)
+	data, err = request("new", []byte(`{"player":"f1","game":"minus-one","fallback_after":"1m"}`))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "fallback bot doesn't play minus-one")
+
+	data, err = request("new", []byte(`{"player":"f1","fallback_after":"wrong"}`))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "wrong fallback_after: wrong")
+
+	// the failed fallback is marked in the round, so the following requests don't fail
+	data, err = request("new", []byte(`{"player":"f1","fallback_after":"50ms"}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &created))
+	time.Sleep(60 * time.Millisecond)
+	chains := house
+	house = nil
+	for i := 0; i < 2; i++ {
+		data, err = request("result", []byte(fmt.Sprintf(`{"round":%q,"player":"f1"}`, created.Round)))
+		require.NoError(t, err)
+		require.Contains(t, string(data), `"response":"wait for rival attach"`)
+	}
+	house = chains
+	round, err = db.Retrieve(created.Round)
+	require.NoError(t, err)
+	require.True(t, round.NoFallback)
+	require.Empty(t, round.Bot)
+	data, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":"f2"}`, created.Round)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "place Your bet, please")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Gesture is the player's bid
+type Gesture int
+
+const (
+	// gestures (the values are kept from the untyped bids for compatibility of stored rounds)
+	stone Gesture = iota + 4
+	scissors
+	paper
+	nothing Gesture = 0 // the bid is not disclosed yet
+)
+
+// gestureNames are the names of gestures of all games
+var gestureNames = map[Gesture]string{
+	stone: "stone", scissors: "scissors", paper: "paper",
+	heads: "heads", tails: "tails",
+	one: "one", two: "two",
+}
+
+// ParseGesture returns the gesture by its name (case insensitive)
+func ParseGesture(name string) (Gesture, error) {
+	for g, n := range gestureNames {
+		if strings.EqualFold(name, n) {
+			return g, nil
+		}
+	}
+	return nothing, fmt.Errorf("unknown gesture: %q", name)
+}
+
+// String returns the name of gesture or empty string for not disclosed or unknown gesture
+func (g Gesture) String() string {
+	return gestureNames[g]
+}
+
+// Valid checks that the gesture is one of known gestures
+func (g Gesture) Valid() bool {
+	_, ok := gestureNames[g]
+	return ok
+}
+
+// State is the phase of round
+type State string
+
+const (
+	StateOpen        State = "open"        // waiting for the rival to attach
+	StateBetting     State = "betting"     // waiting for hidden bets
+	StateDisclosing  State = "disclosing"  // all hidden bets are placed, waiting for disclosures
+	StateWithdrawing State = "withdrawing" // "minus one" pairs are disclosed, waiting for hidden withdrawals
+	StateFinished    State = "finished"    // the round has the result
+	StateCancelled   State = "cancelled"   // the round is cancelled by the player before the bets
+)
+
+// transitions are the allowed transitions between round states.
+// A new phase has to be added here, otherwise the round can't reach it.
+var transitions = map[State][]State{
+	StateOpen:        {StateBetting, StateCancelled},
+	StateBetting:     {StateDisclosing, StateCancelled},
+	StateDisclosing:  {StateFinished, StateWithdrawing},
+	StateWithdrawing: {StateDisclosing},
+}
+
+// transitionHooks are called after each state transition of round. They are called under the round lock,
+// so they must not call the Round methods.
+var transitionHooks []func(r *Round, from, to State)
+
+// state returns the round state. The state of legacy rounds stored without it is derived from the round data.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) state() State {
+	switch {
+	case r.State != "":
+		return r.State
+	case r.Winner != nobody:
+		return StateFinished
+	case r.HiddenBet1 != "" && r.HiddenBet2 != "":
+		return StateDisclosing
+	case r.Player2 != "":
+		return StateBetting
+	default:
+		return StateOpen
+	}
+}
+
+// allowed checks that the transition from the state from to the state to is in the table of transitions
+func allowed(table map[State][]State, from, to State) bool {
+	for _, s := range table[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transition applies the change of round data and moves the round to the state to. Nothing is changed when
+// the transition is not allowed: it returns the error in this case.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) transition(to State, change func()) error {
+	from := r.state()
+	if !allowed(transitions, from, to) {
+		return fmt.Errorf("round %s: transition from %s to %s is not allowed", r.ID, from, to)
+	}
+	change()
+	r.State = to
+	for _, hook := range transitionHooks {
+		hook(r, from, to)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_FSM(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	type change struct{ from, to State }
+	changes := []change{}
+	prevHooks := transitionHooks
+	defer func() { transitionHooks = prevHooks }()
+	transitionHooks = []func(r *Round, from, to State){func(r *Round, from, to State) {
+		changes = append(changes, change{from, to})
+	}}
+
+	tr := NewRound(player1)
+	require.Equal(t, StateOpen, tr.State)
+	tr.Attach(player2)
+	// the hidden bet of unknown gesture can be placed but it can't be disclosed
+	tr.Bet(tr.saltedHash("my secret", []byte("rock")), player1)
+	tr.Bet(tr.saltedHash("my 2 secret", []byte("paper")), player2)
+	require.Equal(t, StateDisclosing, tr.State)
+
+	require.Equal(t, "unknown bet", tr.Disclose("my secret", "rock", player1))
+	require.Equal(t, nothing, tr.Bet1)
+	require.Equal(t, "wait for your rival to disclose its bet", tr.Disclose("my 2 secret", "paper", player2))
+	require.False(t, tr.Finished())
+
+	require.Equal(t, []change{
+		{StateOpen, StateBetting},
+		{StateBetting, StateDisclosing},
+	}, changes)
+
+	// the round can't skip the phase
+	require.Error(t, tr.transition(StateOpen, func() { t.Error("change of not allowed transition") }))
+	require.Equal(t, StateDisclosing, tr.State)
+}
+
+func Test2_FSMLegacyState(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	tr := NewRound(player1)
+	tr.Attach(player2)
+	tr.Bet(tr.saltedHash("my secret", []byte("paper")), player1)
+
+	// the round stored before the state field was added
+	tr.State = ""
+	tr.reSing()
+	data, _ := json.Marshal(tr)
+	require.NotContains(t, string(data), `"state"`)
+	legacy := &Round{}
+	require.NoError(t, json.Unmarshal(data, legacy))
+	require.Equal(t, StateBetting, legacy.state())
+
+	require.Equal(t, "disclose your bet, please", legacy.Bet(tr.saltedHash("my 2 secret", []byte("stone")), player2))
+	require.Equal(t, StateDisclosing, legacy.State)
+	legacy.Disclose("my secret", "paper", player1)
+	require.Equal(t, "You lose: your bet: stone, the rival's bet: paper", legacy.Disclose("my 2 secret", "stone", player2))
+	require.Equal(t, StateFinished, legacy.State)
+	require.True(t, legacy.Finished())
+}
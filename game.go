@@ -1,13 +1,14 @@
 package main
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"log"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -18,16 +19,31 @@ const (
 	first
 	second
 	draw
-	// bids
-	stone
-	scissors
-	paper
-	nothing = nobody
+)
+
+const (
+	// bet modes
+	modeCommit   = "commit"   // player makes the hidden bet and discloses it
+	modeSealed   = "sealed"   // player makes the hidden bet and sealed disclosure that is opened by server
+	modeAssisted = "assisted" // server makes the hidden bet from the open bet and discloses it, player has to trust the server
+)
+
+const (
+	// responses that mean the round can't be played by the requester
+	msgFalsificated = "round had been falsificated"
+	msgUnknownKey   = "round is signed with unknown server key"
+	msgUnauthorized = "unauthorized"
+)
+
+const (
+	msgCancelled   = "the round is cancelled"
+	msgCantCancel  = "the round can't be cancelled after the bets"
+	msgSeriesRound = "the round of series can't be cancelled"
 )
 
 var (
 	// rules - determines the winner by first and second bids
-	rules = map[int]map[int]int{
+	rules = map[Gesture]map[Gesture]int{
 		stone:    {stone: draw, scissors: first, paper: second},
 		scissors: {stone: second, scissors: draw, paper: first},
 		paper:    {stone: first, scissors: second, paper: draw},
@@ -36,27 +52,180 @@ var (
 
 // Round is a single round game provider
 type Round struct {
-	mx         sync.Mutex // guard for async updates
-	ID         string     `json:"id"`         // round id
-	Player1    string     `json:"player1"`    // hash of player1's token
-	Player2    string     `json:"player2"`    // hash of player2's token
-	HiddenBet1 string     `json:"hiddenbet1"` // hidden bet of player1
-	HiddenBet2 string     `json:"hiddenbet2"` // hidden bet of player2
-	Bet1       int        `json:"bet1"`       // open bet of player1
-	Bet2       int        `json:"bet2"`       // open bet of player2
-	Winner     int        `json:"winner"`     // 'nobody' - not all bids done, 'first'|'second'|'draw' - winner selection when all bids done
-	Signature  string     `json:"signature"`  // round signature (calculated without itself)
-}
-
-// NewRound returns new initialized open Round
+	mx           sync.Mutex   // guard for async updates
+	ID           string       `json:"id"`                    // round id
+	Player1      string       `json:"player1"`               // hash of player1's token
+	Player2      string       `json:"player2"`               // hash of player2's token
+	HiddenBet1   string       `json:"hiddenbet1"`            // hidden bet of player1
+	HiddenBet2   string       `json:"hiddenbet2"`            // hidden bet of player2
+	Bet1         Gesture      `json:"bet1"`                  // open bet of player1
+	Bet2         Gesture      `json:"bet2"`                  // open bet of player2
+	Winner       int          `json:"winner"`                // 'nobody' - not all bids done, 'first'|'second'|'draw' - winner selection when all bids done
+	Signature    string       `json:"signature"`             // round signature (calculated without itself)
+	Sealed1      string       `json:"sealed1,omitempty"`     // sealed disclosure of player1
+	Sealed2      string       `json:"sealed2,omitempty"`     // sealed disclosure of player2
+	Mode1        string       `json:"mode1,omitempty"`       // bet mode of player1
+	Mode2        string       `json:"mode2,omitempty"`       // bet mode of player2
+	Secret1      string       `json:"secret1,omitempty"`     // disclosed secret of player1
+	Secret2      string       `json:"secret2,omitempty"`     // disclosed secret of player2
+	Disclosed1   string       `json:"disclosed1,omitempty"`  // bet disclosed by player1 as it was sent, when it differs from bet1
+	Disclosed2   string       `json:"disclosed2,omitempty"`  // bet disclosed by player2 as it was sent, when it differs from bet2
+	KeyID        string       `json:"keyid,omitempty"`       // id of server key used for the signature
+	HashKeyID    string       `json:"hashkeyid,omitempty"`   // id of server key used for the players' hashes
+	State        State        `json:"state,omitempty"`       // round state, it is derived from the round data for legacy rounds
+	Times        *Timeline    `json:"timeline,omitempty"`    // server times of round events
+	Game         string       `json:"game,omitempty"`        // game name, empty - stone scissors paper
+	Series       string       `json:"series,omitempty"`      // id of series the round belongs to
+	Hand1        *Hand        `json:"hand1,omitempty"`       // gestures available to player1 in the series
+	Hand2        *Hand        `json:"hand2,omitempty"`       // gestures available to player2 in the series
+	Pairs        *Pairs       `json:"pairs,omitempty"`       // the first stage of "minus one" round
+	Points1      int          `json:"points1,omitempty"`     // points scored by player1
+	Points2      int          `json:"points2,omitempty"`     // points scored by player2
+	League       string       `json:"league,omitempty"`      // league the round points are added to
+	Member1      string       `json:"member1,omitempty"`     // league member id of player1
+	Member2      string       `json:"member2,omitempty"`     // league member id of player2
+	Link         string       `json:"link,omitempty"`        // id of the first linked round, it is used for the players' hashes
+	Prev         string       `json:"prev,omitempty"`        // id of the previous linked round
+	Next         string       `json:"next,omitempty"`        // id of the next linked round (replay or rematch)
+	Rival        string       `json:"rival,omitempty"`       // hash of the only player that can attach the rematch
+	ReplayOnDraw bool         `json:"replay,omitempty"`      // the round is replayed automatically on draw
+	Bot          string       `json:"bot,omitempty"`         // strategy name of the bot playing as player2
+	BotRival     string       `json:"botrival,omitempty"`    // id of the player1's history of moves against bots
+	House        *HouseSeed   `json:"house,omitempty"`       // seed of the house bot's bet
+	FallbackAt   int64        `json:"fallback_at,omitempty"` // server time when the fallback bot attaches the open round
+	Substitute   bool         `json:"substitute,omitempty"`  // player2 is the fallback bot
+	NoFallback   bool         `json:"no_fallback,omitempty"` // the fallback bot failed to attach the round, it waits for the rival
+	Unrated      bool         `json:"unrated,omitempty"`     // the round points are not added to the league
+	Spectators   string       `json:"spectators,omitempty"`  // 'public'|'token' - spectators can watch the round, empty - no spectators
+	Spectator    string       `json:"spectator,omitempty"`   // hash of spectator token
+	Stake        int64        `json:"stake,omitempty"`       // coins staked by each player
+	Account1     string       `json:"account1,omitempty"`    // ledger account of player1 in the round played for stakes
+	Account2     string       `json:"account2,omitempty"`    // ledger account of player2 in the round played for stakes
+	EscrowExpiry int64        `json:"escrow_exp,omitempty"`  // server time when the escrowed stakes expire
+	Resolving    bool         `json:"resolving,omitempty"`   // the round is finished, but its resolution hooks are not completed
+	events       []RoundEvent // events of round actions that are not stored yet
+	specToken    string       // spectator token of new round, it is not stored
+	claimed      bool         // the resolution hooks are run by some request
+}
+
+// NewRound returns new initialized open Round of stone scissors paper
 func NewRound(player string) *Round {
+	r, _ := NewGameRound(player, "")
+	return r
+}
+
+// NewGameRound returns new initialized open Round of the game. The empty name means stone scissors paper.
+func NewGameRound(player, game string) (*Round, error) {
+	return newRound(player, game, nil)
+}
+
+// RoundOptions are the options of new round
+type RoundOptions struct {
+	Game         string        // game name, empty - stone scissors paper
+	League       string        // league the round points are added to, empty - the round is out of leagues
+	ReplayOnDraw bool          // the round is replayed automatically on draw
+	Opponent     string        // "bot:<strategy>" - the bot attaches the round, empty - the rival is a human
+	Fallback     time.Duration // wait of the rival before the fallback bot attaches the round, 0 - no fallback bot
+	Spectators   string        // 'public'|'token' - spectators can watch the round, empty - no spectators
+	Stake        int64         // coins staked by each player, 0 - the round isn't played for stakes
+}
+
+// validate checks the options
+func (opt RoundOptions) validate() error {
+	if _, err := gameByName(opt.Game); err != nil {
+		return err
+	}
+	if len(opt.League) > maxLeagueName {
+		return fmt.Errorf("league name is longer than %d", maxLeagueName)
+	}
+	if err := checkSpectators(opt.Spectators); err != nil {
+		return err
+	}
+	if opt.Fallback > 0 && (sealKeys == nil || house == nil) {
+		return errors.New("fallback bot is not supported")
+	}
+	if opt.Fallback > 0 && opt.Game == gameMinusOne {
+		return fmt.Errorf("fallback bot doesn't play %s", gameMinusOne)
+	}
+	if opt.Stake < 0 {
+		return errors.New("stake can't be negative")
+	}
+	if opt.Stake > 0 {
+		switch {
+		case ledger == nil:
+			return errors.New("stakes are not supported")
+		case opt.Opponent != "":
+			return errors.New("bots don't play for stakes")
+		case opt.Fallback > 0:
+			return errors.New("fallback bot doesn't play for stakes")
+		}
+	}
+	if opt.Opponent == "" {
+		return nil
+	}
+	if _, err := botByOpponent(opt.Opponent); err != nil {
+		return err
+	}
+	if opt.Game == gameMinusOne {
+		return fmt.Errorf("bots don't play %s", gameMinusOne)
+	}
+	if sealKeys == nil {
+		return errors.New("bots are not supported")
+	}
+	if opt.Opponent == botPrefix+houseBot && house == nil {
+		return errors.New("house bot is not supported")
+	}
+	return nil
+}
+
+// NewRoundWithOptions returns new initialized open Round with the options.
+// The bot opponent is not attached here: it is done by botPlay.
+func NewRoundWithOptions(player string, opt RoundOptions) (*Round, error) {
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	bot, _ := botByOpponent(opt.Opponent)
+	return newRound(player, opt.Game, func(r *Round) {
+		if opt.League != "" {
+			r.League = opt.League
+			r.Member1 = leagueMember(opt.League, player)
+		}
+		r.ReplayOnDraw = opt.ReplayOnDraw
+		if bot != "" {
+			r.Bot, r.BotRival = bot, botRival(player)
+		} else if opt.Fallback > 0 {
+			r.FallbackAt = r.Times.Created + opt.Fallback.Milliseconds()
+		}
+		r.specToken = r.setSpectators(opt.Spectators)
+		if opt.Stake > 0 {
+			r.Stake, r.Account1 = opt.Stake, ledgerAccount(player)
+		}
+	})
+}
+
+// newRound returns new initialized open Round of the game. The setup changes the round before it is signed.
+func newRound(player, game string, setup func(r *Round)) (*Round, error) {
+	if _, err := gameByName(game); err != nil {
+		return nil, err
+	}
+	if game == defaultGame {
+		game = "" // keep rounds of the default game the same as legacy rounds
+	}
 	r := &Round{
-		ID: uuid.NewString(),
+		ID:        uuid.NewString(),
+		HashKeyID: ring.active,
+		State:     StateOpen,
+		Times:     &Timeline{Created: nowMilli()},
+		Game:      game,
 	}
 
 	r.Player1 = r.roundSaltedHash(player)
+	if setup != nil {
+		setup(r)
+	}
 	r.reSing()
-	return r
+	r.record(eventCreated, player, nil, map[string]json.RawMessage{}, nil)
+	return r, nil
 }
 
 // saltedHash returns first 32 symbos of BASE64 encoging of sha256(salt + obj)
@@ -64,122 +233,490 @@ func (r *Round) saltedHash(salt string, obj []byte) string {
 
 	h := sha256.Sum256(append(obj, []byte(salt)...))
 
-	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(h[:])
+	return encode64(h[:])
 }
 
+// roundSaltedHash returns the salted hash of obj made with the server key of players' hashes.
+// The linked rounds use the id of the first round of the chain, so they share the players' hashes.
 func (r *Round) roundSaltedHash(obj interface{}) string {
+	return keyHash(r.HashKeyID, r.hashID(), obj)
+}
 
-	salt := serverSalt + r.ID // make individual salt for each round object
+// keyHash returns the salted hash of obj made with the server key keyID and the id of game object.
+// It returns empty string when the key is not in the key ring.
+func keyHash(keyID, id string, obj interface{}) string {
+	key, ok := ring.keys[keyID]
+	if !ok {
+		return ""
+	}
+
+	salt := key + id // make individual salt for each game object
 
 	bObj, err := json.Marshal(obj)
 	if err != nil {
 		panic(err)
 	}
 
-	return r.saltedHash(salt, bObj)
+	h := sha256.Sum256(append(bObj, []byte(salt)...))
+	return encode64(h[:])
 }
 
-func (r *Round) check(player string) string {
+// signing is the signature of game object (round, party, team round or series): the object is signed with
+// the server key by its JSON without the signature
+type signing struct {
+	id        string      // id of game object, it is used for the salt
+	obj       interface{} // game object
+	keyID     *string     // id of server key used for the signature
+	hashKeyID string      // id of server key used for the players' hashes
+	signature *string     // signature of game object
+}
+
+// sign returns the signature made with the server key of signature
+func (s signing) sign() string {
+	// clear signature to calculate the hash without it
+	sign := *s.signature
+	defer func() { *s.signature = sign }()
+	*s.signature = ""
 
-	// clear Signature to calculate round hash without it
-	sign := r.Signature
-	defer func() { r.Signature = sign }()
-	r.Signature = ""
+	return keyHash(*s.keyID, s.id, s.obj)
+}
 
-	if sign != r.roundSaltedHash(r) {
-		return "round had been falsificated"
+// valid checks the signature
+func (s signing) valid() bool {
+	sign := s.sign()
+	return sign != "" && sign == *s.signature
+}
+
+// reSign recalculates the signature with the active server key
+func (s signing) reSign() {
+	*s.keyID = ring.active
+	*s.signature = ""
+	*s.signature = keyHash(*s.keyID, s.id, s.obj)
+}
+
+// err checks the signature. It returns msgUnknownKey when the server key of signature or players' hashes is not
+// in the key ring (e.g. the key was removed) and msgFalsificated when the signature is not valid.
+func (s signing) err() string {
+	_, signKey := ring.keys[*s.keyID]
+	_, hashKey := ring.keys[s.hashKeyID]
+	switch {
+	case !signKey || !hashKey:
+		return msgUnknownKey
+	case !s.valid():
+		return msgFalsificated
+	}
+	return ""
+}
+
+// signing returns the signature of round
+func (r *Round) signing() signing {
+	return signing{id: r.ID, obj: r, keyID: &r.KeyID, hashKeyID: r.HashKeyID, signature: &r.Signature}
+}
+
+// sign returns the round signature made with the server key of signature
+func (r *Round) sign() string {
+	return r.signing().sign()
+}
+
+// validSignature checks the round signature.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) validSignature() bool {
+	return r.signing().valid()
+}
+
+// signatureError checks the round signature (see signing.err).
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) signatureError() string {
+	return r.signing().err()
+}
+
+// Valid checks the round signature
+func (r *Round) Valid() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.validSignature()
+}
+
+func (r *Round) check(player string) string {
+
+	if res := r.signatureError(); res != "" {
+		return res
 	}
 
 	if err := r.authorized(player); err != nil {
-		return "unauthorized"
+		return msgUnauthorized
 	}
 	return ""
 }
 
+// reSing recalculates the signature with the active server key
 func (r *Round) reSing() {
-	r.Signature = ""
-	r.Signature = r.roundSaltedHash(r)
+	r.signing().reSign()
+}
+
+// Resign migrates the round signature to the active server key. It returns false when the round is already
+// signed by the active key or when the round signature is not valid.
+func (r *Round) Resign() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.KeyID == ring.active {
+		return false
+	}
+	if !r.validSignature() {
+		return false
+	}
+	before := r.eventFields()
+	r.reSing()
+	r.record(eventResigned, "", nil, before, nil)
+	return true
 }
 
 // Attach new player to existing round
-func (r *Round) Attach(player string) string {
+func (r *Round) Attach(player string) (res string) {
+	return r.AttachHand(player, nil)
+}
+
+// AttachHand attaches new player with the gestures available to the player in the series.
+// The series rounds can be attached only with the hand.
+func (r *Round) AttachHand(player string, hand *Hand) (res string) {
 	r.mx.Lock()
 	defer r.mx.Unlock()
+	defer r.record(eventAttach, player, nil, r.eventFields(), &res)
+	if res := r.signatureError(); res != "" {
+		return res
+	}
 	if r.Player2 != "" {
 		return "this round is already full"
 	}
+	if r.Series != "" && hand == nil {
+		return "this round is a part of series"
+	}
+	if r.Rival != "" && r.roundSaltedHash(player) != r.Rival {
+		return "this round is a rematch for another player"
+	}
 	hPlayer := r.roundSaltedHash(player)
 	if r.Player1 == hPlayer {
 		return "You can't play with yourself"
 	}
-	r.Player2 = hPlayer
+	if r.state() == StateCancelled {
+		return msgCancelled
+	}
+	if r.state() != StateOpen {
+		return "this round is already full"
+	}
+	if msg := r.escrow(player); msg != "" {
+		return msg
+	}
+	if err := r.transition(StateBetting, func() {
+		r.Player2 = hPlayer
+		r.Hand2 = hand
+		if r.League != "" {
+			r.Member2 = leagueMember(r.League, player)
+		}
+		r.timeline().Attached = nowMilli()
+	}); err != nil {
+		log.Println(err)
+		return "this round is already full"
+	}
+	r.reSing()
+	return r.result(player)
+}
+
+// Cancel cancels the open round or the filled round without bets. The escrowed stakes of cancelled round
+// are refunded by settleStakes.
+func (r *Round) Cancel(player string) (res string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	defer r.record(eventCancel, player, nil, r.eventFields(), &res)
+	if res := r.check(player); res != "" {
+		return res
+	}
+	if r.Series != "" {
+		return msgSeriesRound
+	}
+	switch st := r.state(); {
+	case st == StateCancelled:
+		return msgCancelled
+	case st == StateOpen:
+	case st != StateBetting || r.HiddenBet1 != "" || r.HiddenBet2 != "":
+		return msgCantCancel
+	}
+	if err := r.transition(StateCancelled, func() {}); err != nil {
+		log.Println(err)
+		return msgCantCancel
+	}
 	r.reSing()
 	return r.result(player)
 }
 
 // Bet makes the user's hidden bid
-func (r *Round) Bet(hiddenBet, player string) string {
+func (r *Round) Bet(hiddenBet, player string) (res string) {
 	// data racing prevention
 	r.mx.Lock()
 	defer r.mx.Unlock()
+	defer r.record(eventBet, player, map[string]string{"bet": hiddenBet, "mode": modeCommit}, r.eventFields(), &res)
+
+	res, _ = r.bet(hiddenBet, "", modeCommit, player)
+	return res
+}
+
+// SealedBet makes the user's hidden bid with the sealed disclosure that is opened by server when all bids are done
+func (r *Round) SealedBet(hiddenBet, sealed, player string) (res string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	input := map[string]string{"bet": hiddenBet, "sealed": sealed, "mode": modeSealed}
+	defer r.record(eventBet, player, input, r.eventFields(), &res)
+
+	if sealKeys == nil {
+		return "sealed disclosures are not supported"
+	}
+
+	if !validSealed(sealed) {
+		return "unsupported sealed disclosure format"
+	}
+
+	res, _ = r.bet(hiddenBet, sealed, modeSealed, player)
+	return res
+}
+
+// AssistedBet makes the hidden bid for user from the open bet. It returns the secret that was used for the hidden bet.
+// The bet is disclosed by server when all bids are done.
+func (r *Round) AssistedBet(bet, player string) (res, secret string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	// the open bet is not recorded: it is kept in secret till all bids are done
+	defer r.record(eventBet, player, map[string]string{"mode": modeAssisted}, r.eventFields(), &res)
+
+	secret = newSecret()
+	res, placed := r.assistedBet(bet, secret, player)
+	if !placed {
+		return res, ""
+	}
+	return res, secret
+}
+
+// assistedBet makes the hidden bid for user from the open bet and the secret.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) assistedBet(bet, secret, player string) (string, bool) {
+	if sealKeys == nil {
+		return "server-assisted bets are not supported", false
+	}
+
+	if err := r.checkBet(bet); err != nil {
+		return "unknown bet", false
+	}
+
+	// the hidden bet of series round is checked by the hand on disclose, the open one is checked now
+	if g, err := parseMove(r.game(), bet); err == nil {
+		if hand := r.hand(r.roundSaltedHash(player)); hand != nil && hand.Count(g) == 0 {
+			return msgNotInHand, false
+		}
+	}
+
+	// the open bet is kept sealed by the server key till all bids are done
+	key, err := sealKeys.Current()
+	if err != nil {
+		log.Printf("round: %s: seal key error: %v", r.ID, err)
+		return "server-assisted bet can't be placed now", false
+	}
+	sealed, err := sealReveal(key, sealedReveal{Player: r.roundSaltedHash(player), Bet: bet, Secret: secret})
+	if err != nil {
+		log.Printf("round: %s: sealing error: %v", r.ID, err)
+		return "server-assisted bet can't be placed now", false
+	}
+
+	return r.bet(r.saltedHash(secret, []byte(bet)), sealed, modeAssisted, player)
+}
 
+// bet is not protected against data racing.
+// It have to be called after mx.Lock(). It returns the response and true when the bet was placed.
+func (r *Round) bet(hiddenBet, sealed, mode, player string) (string, bool) {
 	if res := r.check(player); res != "" {
-		return res
+		return res, false
+	}
+
+	if !validCommitment(hiddenBet) {
+		return "unsupported commitment format", false
 	}
 
 	shPlayer := r.roundSaltedHash(player)
 
 	if r.Player1 == shPlayer && r.HiddenBet1 != "" ||
 		r.Player2 == shPlayer && r.HiddenBet2 != "" {
-		return "bet has already been placed"
+		return "bet has already been placed", false
+	}
+
+	if st := r.state(); st != StateOpen && st != StateBetting && st != StateWithdrawing {
+		return r.result(player), false
+	}
+
+	if r.House != nil && r.Player1 == shPlayer && r.Times != nil && r.Times.Bet2 != 0 &&
+		nowMilli() > r.Times.Bet2+houseBetWindow.Milliseconds() {
+		// the key of house chain can be revealed already
+		return "the bet of the house bot has expired", false
+	}
+
+	if r.stakesExpired() {
+		// the escrowed stakes can be settled already
+		return msgStakesExpired, false
+	}
+
+	place := func() {
+		if r.Player1 == shPlayer {
+			r.HiddenBet1 = hiddenBet
+			r.Sealed1 = sealed
+			r.Mode1 = mode
+			r.timeline().Bet1 = nowMilli()
+		} else {
+			r.HiddenBet2 = hiddenBet
+			r.Sealed2 = sealed
+			r.Mode2 = mode
+			r.timeline().Bet2 = nowMilli()
+		}
 	}
 
-	if r.Player1 == shPlayer {
-		r.HiddenBet1 = hiddenBet
+	if r.HiddenBet1 != "" || r.HiddenBet2 != "" {
+		// the last hidden bet
+		if err := r.transition(StateDisclosing, place); err != nil {
+			log.Println(err)
+			return r.result(player), false
+		}
 	} else {
-		r.HiddenBet2 = hiddenBet
+		place()
 	}
 
 	// recalculate signature
 	r.reSing()
-	return r.result(player)
+
+	r.autoDisclose()
+	return r.result(player), true
+}
+
+// autoDisclose opens the sealed disclosures and discloses them when all bids are done.
+// The sealed disclosure that can't be opened or doesn't match the hidden bet is ignored:
+// the player can still disclose the bet.
+func (r *Round) autoDisclose() {
+	if r.state() != StateDisclosing {
+		return
+	}
+	for _, s := range []struct {
+		sealed, player string
+		bet            Gesture
+	}{{r.Sealed1, r.Player1, r.Bet1}, {r.Sealed2, r.Player2, r.Bet2}} {
+		if s.sealed == "" || s.bet != nothing {
+			continue
+		}
+		reveal, err := openSealed(s.sealed)
+		if err != nil {
+			log.Printf("round: %s: sealed disclosure opening error: %v", r.ID, err)
+			continue
+		}
+		if reveal.Player != s.player {
+			log.Printf("round: %s: sealed disclosure of another player", r.ID)
+			continue
+		}
+		if res := r.disclose(reveal.Secret, reveal.Bet, s.player); res != "" {
+			log.Printf("round: %s: sealed disclosure error: %s", r.ID, res)
+		}
+	}
 }
 
 // Disclose used to disclose the user's steps
-func (r *Round) Disclose(secret, bet, player string) string {
+func (r *Round) Disclose(secret, bet, player string) (res string) {
 	r.mx.Lock()
 	defer r.mx.Unlock()
+	defer r.record(eventDisclose, player, map[string]string{"bet": bet, "secret": secret}, r.eventFields(), &res)
 	if res := r.check(player); res != "" {
 		return res
 	}
 
-	if r.HiddenBet1 == "" || r.HiddenBet2 == "" {
+	if r.state() != StateDisclosing {
 		return r.result(player)
 	}
 
-	shPlayer := r.roundSaltedHash(player)
+	if res := r.disclose(secret, bet, r.roundSaltedHash(player)); res != "" {
+		return res
+	}
+	return r.result(player)
+}
 
-	shBet := r.saltedHash(secret, []byte(bet))
+// disclose checks the bet of player with hash shPlayer by the hidden bet and stores it. The sealed disclosure
+// is dropped with the disclosed bet. It returns the error message when bet is incorrect.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) disclose(secret, bet, shPlayer string) string {
+	if r.stakesExpired() {
+		// the escrowed stakes can be settled already
+		return msgStakesExpired
+	}
 
-	if shPlayer == r.Player1 && r.HiddenBet1 != shBet ||
-		shPlayer == r.Player2 && r.HiddenBet2 != shBet {
-		return "Your bet is incorrect"
+	if r.pairStage() {
+		return r.disclosePair(secret, bet, shPlayer)
 	}
 
-	if shPlayer == r.Player1 {
-		r.Bet1 = r.betEncode(bet)
-	} else {
-		r.Bet2 = r.betEncode(bet)
+	gesture, err := parseMove(r.game(), bet)
+	if err != nil {
+		return "unknown bet"
 	}
 
-	if r.Bet1 != nothing && r.Bet2 != nothing {
-		// find the winner
-		r.Winner = rules[r.Bet1][r.Bet2]
+	if r.Game == gameMinusOne {
+		if pair := r.pair(shPlayer); gesture != pair[0] && gesture != pair[1] {
+			return "withdraw one of your hands"
+		}
+	}
+
+	if hand := r.hand(shPlayer); hand != nil && hand.Count(gesture) == 0 {
+		return msgNotInHand
+	}
 
+	if shPlayer == r.Player1 && !r.commitmentMatches(r.HiddenBet1, secret, bet, shPlayer) ||
+		shPlayer == r.Player2 && !r.commitmentMatches(r.HiddenBet2, secret, bet, shPlayer) {
+		return "Your bet is incorrect"
+	}
+
+	open := func() {
+		if shPlayer == r.Player1 {
+			r.Bet1 = gesture
+			r.Secret1 = secret
+			r.Disclosed1 = disclosed(gesture, bet)
+			r.Sealed1 = ""
+			r.timeline().Disclose1 = nowMilli()
+		} else {
+			r.Bet2 = gesture
+			r.Secret2 = secret
+			r.Disclosed2 = disclosed(gesture, bet)
+			r.Sealed2 = ""
+			r.timeline().Disclose2 = nowMilli()
+		}
+	}
+
+	if shPlayer == r.Player1 && r.Bet2 != nothing || shPlayer == r.Player2 && r.Bet1 != nothing {
+		// the last disclosure: find the winner
+		err = r.transition(StateFinished, func() {
+			open()
+			r.Winner = r.game().Winner(r.moves())
+			r.Points1, r.Points2 = r.game().Points(r.moves())
+			r.timeline().Resolved = nowMilli()
+			r.Resolving = true
+		})
+		if err != nil {
+			log.Println(err)
+			return "round can't be finished"
+		}
+	} else {
+		open()
 	}
 	// recalculate signature
 	r.reSing()
-	return r.result(player)
+	return ""
+}
+
+// disclosed returns the bet as it was disclosed when it differs from the name of gesture.
+// The legacy commitment is made from the disclosed string, so it is kept for the transcript.
+func disclosed(gesture Gesture, bet string) string {
+	if bet == gesture.String() {
+		return ""
+	}
+	return bet
 }
 
 // Result returns the round result
@@ -192,14 +729,71 @@ func (r *Round) Result(player string) string {
 	return r.result(player)
 }
 
+// Attached returns true when the round has both players
+func (r *Round) Attached() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.Player2 != ""
+}
+
+// Pseudonym returns the player's pseudonym (the hash of player's token) that binds the v2 commitments.
+// It is empty when the player is not attached to the round.
+func (r *Round) Pseudonym(player string) string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if h := r.roundSaltedHash(player); h != "" && (h == r.Player1 || h == r.Player2) {
+		return h
+	}
+	return ""
+}
+
+// Finished returns true when the round has the result
+func (r *Round) Finished() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.state() == StateFinished
+}
+
+// claimResolution reports whether the caller has to run the resolution hooks of the finished round.
+// The hooks are run by one caller at a time.
+func (r *Round) claimResolution() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if !r.Resolving || r.claimed {
+		return false
+	}
+	r.claimed = true
+	return true
+}
+
+// completeResolution marks that the resolution hooks of round are completed
+func (r *Round) completeResolution() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	before := r.eventFields()
+	r.Resolving, r.claimed = false, false
+	r.reSing()
+	r.record(eventResolved, "", nil, before, nil)
+}
+
+// Ended reports whether the round is over: it is finished or cancelled
+func (r *Round) Ended() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	st := r.state()
+	return st == StateFinished || st == StateCancelled
+}
+
 // result is not protected against data racing.
 // It have to be called after mx.Lock() or mx.RLock()
 func (r *Round) result(player string) string {
 
-	var rival, hiddenBet, rHiddenBet string
-	var bet, rBet, cPlayer int
+	var shPlayer, rival, hiddenBet, rHiddenBet string
+	var bet, rBet Gesture
+	var cPlayer int
 
 	if r.Player1 == r.roundSaltedHash(player) {
+		shPlayer = r.Player1
 		rival = r.Player2
 		hiddenBet = r.HiddenBet1
 		bet = r.Bet1
@@ -207,6 +801,7 @@ func (r *Round) result(player string) string {
 		rBet = r.Bet2
 		cPlayer = first
 	} else {
+		shPlayer = r.Player2
 		rival = r.Player1
 		hiddenBet = r.HiddenBet2
 		bet = r.Bet2
@@ -215,10 +810,18 @@ func (r *Round) result(player string) string {
 		cPlayer = second
 	}
 
+	if r.state() == StateCancelled {
+		return msgCancelled
+	}
+
 	if rival == "" {
 		return "wait for rival attach"
 	}
 
+	if r.Game == gameMinusOne && !r.pairStage() {
+		return r.withdrawalResult(shPlayer, rival, hiddenBet, rHiddenBet, bet, rBet, cPlayer)
+	}
+
 	if hiddenBet == "" {
 		return "place Your bet, please"
 	}
@@ -227,6 +830,10 @@ func (r *Round) result(player string) string {
 		return "wait for the rival to place its bet"
 	}
 
+	if r.pairStage() {
+		return r.pairResult(shPlayer)
+	}
+
 	if bet == nothing {
 		return "disclose your bet, please"
 	}
@@ -236,51 +843,33 @@ func (r *Round) result(player string) string {
 	}
 
 	// there is a game result
-	resp := ""
+	return fmt.Sprintf("%s: your bet: %s, the rival's bet: %s", r.outcome(cPlayer), bet, rBet)
+}
 
-	if r.Winner == draw {
-		resp = "draw"
-	} else {
-		if r.Winner == cPlayer {
-			resp = "You won"
-		} else {
-			resp = "You lose"
-		}
+// outcome returns the round outcome for player cPlayer ('first'|'second')
+func (r *Round) outcome(cPlayer int) string {
+	switch r.Winner {
+	case draw:
+		return "draw"
+	case cPlayer:
+		return "You won"
 	}
+	return "You lose"
+}
 
-	return fmt.Sprintf("%s: your bet: %s, the rival's bet: %s", resp, r.betDecode(bet), r.betDecode(rBet))
+// newSecret returns the random secret for hidden bet
+func newSecret() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return encode64(b)
 }
 
 // authorized checks the user
 func (r *Round) authorized(token string) error {
-	if r.roundSaltedHash(token) != r.Player1 && r.roundSaltedHash(token) != r.Player2 {
+	if hToken := r.roundSaltedHash(token); hToken == "" || hToken != r.Player1 && hToken != r.Player2 {
 		return errors.New("Unauthorized")
 	}
 	return nil
 }
-
-func (r *Round) betDecode(bet int) string {
-	switch bet {
-	case paper:
-		return "paper"
-	case scissors:
-		return "scissors"
-	case stone:
-		return "stone"
-	default:
-		return ""
-	}
-}
-
-func (r *Round) betEncode(bet string) int {
-	switch strings.ToLower(bet) {
-	case "paper":
-		return paper
-	case "scissors":
-		return scissors
-	case "stone":
-		return stone
-	default:
-		return -1
-	}
-}
@@ -3,6 +3,7 @@ package main
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -34,6 +35,9 @@ func Test1_NewRound(t *testing.T) {
 	player1 := "player1"
 	player2 := "player2"
 
+	defer func(prev func() time.Time) { now = prev }(now)
+	now = func() time.Time { return time.UnixMilli(1000) }
+
 	tr := NewRound(player1)
 	rs := tr.Signature
 	res := tr.Attach(player1)
@@ -50,9 +54,12 @@ func Test1_NewRound(t *testing.T) {
 	tr.Signature = ""
 	require.Equal(t, tr.roundSaltedHash(tr), storedSig)
 	tr.ID = ""
+	tr.events = nil
 	require.Equal(t, &Round{
 		Player1: p1,
 		Player2: p2,
+		State:   StateBetting,
+		Times:   &Timeline{Created: 1000, Attached: 1000},
 	}, tr)
 	tr.Signature = storedSig
 	tr.ID = storedID
@@ -276,22 +283,22 @@ func Test6_falsificate(t *testing.T) {
 }
 
 func Test7_bidEncodeDecode(t *testing.T) {
-	tr := NewRound("u1")
-
-	if tr.betDecode(stone) != "stone" ||
-		tr.betDecode(scissors) != "scissors" ||
-		tr.betDecode(paper) != "paper" ||
-		tr.betDecode(nothing) != "" {
+	if stone.String() != "stone" ||
+		scissors.String() != "scissors" ||
+		paper.String() != "paper" ||
+		nothing.String() != "" {
 		t.Error("wrong bids decoding")
 	}
 
-	if tr.betEncode("Stone") != stone ||
-		tr.betEncode("scIssors") != scissors ||
-		tr.betEncode("papEr") != paper ||
-		tr.betEncode("nOthing") != -1 {
-		t.Error("wrong bids encoding")
+	for name, g := range map[string]Gesture{"Stone": stone, "scIssors": scissors, "papEr": paper} {
+		parsed, err := ParseGesture(name)
+		require.NoError(t, err)
+		require.Equal(t, g, parsed)
 	}
-
+	_, err := ParseGesture("nOthing")
+	require.Error(t, err)
+	require.False(t, Gesture(-1).Valid())
+	require.True(t, paper.Valid())
 }
 
 func Test8_NewRoundUnauthorized(t *testing.T) {
@@ -325,3 +332,53 @@ func Test9_authorized(t *testing.T) {
 	err = tr.authorized("player3")
 	require.Error(t, err)
 }
+
+func Test10_assistedBet(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	tr := NewRound(player1)
+	tr.Attach(player2)
+
+	res, secret := tr.AssistedBet("paper", player1)
+	require.Equal(t, "server-assisted bets are not supported", res)
+	require.Empty(t, secret)
+
+	useMemSealKeys(t)
+
+	res, secret = tr.AssistedBet("rock", player1)
+	require.Equal(t, "unknown bet", res)
+	require.Empty(t, secret)
+
+	res, secret = tr.AssistedBet("paper", "player3")
+	require.Equal(t, "unauthorized", res)
+	require.Empty(t, secret)
+
+	res, secret = tr.AssistedBet("paper", player1)
+	require.Equal(t, "wait for the rival to place its bet", res)
+	require.NotEmpty(t, secret)
+	// the commitment is made as by player
+	require.Equal(t, tr.saltedHash(secret, []byte("paper")), tr.HiddenBet1)
+	require.Equal(t, modeAssisted, tr.Mode1)
+
+	res, secret = tr.AssistedBet("stone", player1)
+	require.Equal(t, "bet has already been placed", res)
+	require.Empty(t, secret)
+
+	res = tr.Bet(tr.saltedHash("my secret", []byte("scissors")), player2)
+	require.Equal(t, "disclose your bet, please", res)
+	require.Equal(t, modeCommit, tr.Mode2)
+	require.Equal(t, paper, tr.Bet1)
+
+	res = tr.Disclose("my secret", "scissors", player2)
+	require.Equal(t, "You won: your bet: scissors, the rival's bet: paper", res)
+
+	// both players use server-assisted bets
+	tr = NewRound(player1)
+	tr.Attach(player2)
+	tr.AssistedBet("stone", player1)
+	res, _ = tr.AssistedBet("stone", player2)
+	require.Equal(t, "draw: your bet: stone, the rival's bet: stone", res)
+	require.Equal(t, modeAssisted, tr.Mode1)
+	require.Equal(t, modeAssisted, tr.Mode2)
+}
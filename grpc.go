@@ -0,0 +1,257 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ssp.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// gameServer is the gRPC implementation of the game service.
+// It uses the same Database and game logic as HTTP handlers.
+type gameServer struct {
+	UnimplementedGameServer
+	watchInterval time.Duration // interval of round checks in WatchRound
+	stop          chan struct{} // closed when the service is shutting down
+}
+
+// NewGRPCServer returns new gRPC server with registered game service and the function that stops it gracefully
+func NewGRPCServer(watchInterval time.Duration) (*grpc.Server, func(ctx context.Context)) {
+	gs := &gameServer{
+		watchInterval: watchInterval,
+		stop:          make(chan struct{}),
+	}
+	server := grpc.NewServer()
+	RegisterGameServer(server, gs)
+	shutdown := func(ctx context.Context) {
+		close(gs.stop) // finish all watchers
+		done := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			server.Stop()
+		}
+	}
+	return server, shutdown
+}
+
+// grpcError converts the request processing error to gRPC status error
+func grpcError(err error) error {
+	log.Println(err)
+	if errors.Is(err, redis.Nil) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, errQuarantined) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// missedFields returns the gRPC status error for request with missed mandatory fields
+func missedFields(in interface{}) error {
+	errMsg := fmt.Sprintf("Some mandatory fields are missed: %v", in)
+	log.Println(errMsg)
+	return status.Error(codes.InvalidArgument, errMsg)
+}
+
+// grpcTimeline converts the player's timeline to gRPC message
+func grpcTimeline(t *PlayerTimeline) *RoundTimeline {
+	if t == nil {
+		return nil
+	}
+	return &RoundTimeline{
+		Created:       t.Created,
+		Attached:      t.Attached,
+		YourBet:       t.YourBet,
+		RivalBet:      t.RivalBet,
+		YourDisclose:  t.YourDisclose,
+		RivalDisclose: t.RivalDisclose,
+		Resolved:      t.Resolved,
+	}
+}
+
+// NewRound realizes the request for new round
+func (s *gameServer) NewRound(ctx context.Context, in *NewRoundRequest) (*NewRoundResponse, error) {
+	if in.Player == "" {
+		return nil, missedFields(in)
+	}
+	// the round has the default wait of the fallback bot as the round made by HTTP request
+	opt := RoundOptions{Game: in.Game, Spectators: in.Spectators}
+	if in.Game != gameMinusOne {
+		opt.Fallback = fallbackAfter
+	}
+	if err := opt.validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	round, err := startRound(in.Player, opt)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	log.Printf("new round: %s started by %s (gRPC)", round.ID, in.Player)
+	return &NewRoundResponse{Round: round.ID, SpectatorToken: round.SpectatorToken(),
+		Pseudonym: round.Pseudonym(in.Player)}, nil
+}
+
+// Attach realizes the request for attach to existing round
+func (s *gameServer) Attach(ctx context.Context, in *AttachRequest) (*RoundResponse, error) {
+	if in.Round == "" || in.Player == "" {
+		return nil, missedFields(in)
+	}
+	round, res, err := play(in.Round, true, func(round *Round) string {
+		return round.Attach(in.Player)
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	log.Printf("round: %s: %s attached (gRPC)", round.ID, in.Player)
+	return &RoundResponse{Response: res, Pseudonym: round.Pseudonym(in.Player)}, nil
+}
+
+// Bet realizes the request for the new bet of user
+func (s *gameServer) Bet(ctx context.Context, in *BetRequest) (*RoundResponse, error) {
+	if in.Round == "" || in.Player == "" || in.Bet == "" && in.Gesture == "" {
+		return nil, missedFields(in)
+	}
+	secret := ""
+	round, res, err := play(in.Round, true, func(round *Round) string {
+		return placeBet(round, in.Bet, in.Sealed, in.Gesture, in.Player, &secret)
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	log.Printf("round: %s:%s - bet result: %s (gRPC)", round.ID, in.Player, res)
+	return &RoundResponse{Response: res, Secret: secret}, nil
+}
+
+// Disclose realizes the request for the disclose bet of user
+func (s *gameServer) Disclose(ctx context.Context, in *DiscloseRequest) (*RoundResponse, error) {
+	if in.Round == "" || in.Player == "" || in.Bet == "" || in.Secret == "" {
+		return nil, missedFields(in)
+	}
+	round, res, err := play(in.Round, true, func(round *Round) string {
+		return round.Disclose(in.Secret, in.Bet, in.Player)
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	log.Printf("round: %s:%s - disclose result: %s (gRPC)", round.ID, in.Player, res)
+	return &RoundResponse{Response: res}, nil
+}
+
+// Result realizes the request for result of round
+func (s *gameServer) Result(ctx context.Context, in *ResultRequest) (*RoundResponse, error) {
+	if in.Round == "" || in.Player == "" {
+		return nil, missedFields(in)
+	}
+	round, res, err := play(in.Round, false, func(round *Round) string {
+		return round.Result(in.Player)
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &RoundResponse{Response: res, Timeline: grpcTimeline(round.PlayerTimeline(in.Player))}, nil
+}
+
+// WatchRound sends the round result every time it changes.
+// The stream ends when the round is finished, cancelled or it can't be played by the requester.
+func (s *gameServer) WatchRound(in *ResultRequest, stream Game_WatchRoundServer) error {
+	if in.Round == "" || in.Player == "" {
+		return missedFields(in)
+	}
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+	last := ""
+	for {
+		round, res, err := play(in.Round, false, func(round *Round) string {
+			return round.Result(in.Player)
+		})
+		if err != nil {
+			return grpcError(err)
+		}
+		if res != last {
+			resp := &RoundResponse{Response: res, Timeline: grpcTimeline(round.PlayerTimeline(in.Player))}
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			last = res
+		}
+		if round.Ended() || res == msgUnauthorized || res == msgFalsificated || res == msgUnknownKey {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.stop:
+			return status.Error(codes.Unavailable, "service is shutting down")
+		}
+	}
+}
+
+// grpcSpectatorView converts the spectator's view of round to gRPC message
+func grpcSpectatorView(v *SpectatorView) *SpectateResponse {
+	resp := &SpectateResponse{Round: v.Round, Game: v.Game, State: string(v.State), Bet1: v.Bet1, Bet2: v.Bet2,
+		Winner: v.Winner}
+	if t := v.Timeline; t != nil {
+		resp.Timeline = &SpectatorTimeline{
+			Created:   t.Created,
+			Attached:  t.Attached,
+			Bet1:      t.Bet1,
+			Bet2:      t.Bet2,
+			Disclose1: t.Disclose1,
+			Disclose2: t.Disclose2,
+			Resolved:  t.Resolved,
+		}
+	}
+	return resp
+}
+
+// Spectate sends the spectator's view of round every time it changes.
+// The stream ends when the round is finished or cancelled. The round is not changed by spectators.
+func (s *gameServer) Spectate(in *SpectateRequest, stream Game_SpectateServer) error {
+	if in.Round == "" {
+		return missedFields(in)
+	}
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+	var last *SpectateResponse
+	for {
+		view, res, err := spectate(in.Round, in.Token)
+		if err != nil {
+			return grpcError(err)
+		}
+		if view == nil {
+			return status.Error(codes.PermissionDenied, res)
+		}
+		resp := grpcSpectatorView(view)
+		if !proto.Equal(resp, last) {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			last = resp
+		}
+		if view.State == StateFinished || view.State == StateCancelled {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.stop:
+			return status.Error(codes.Unavailable, "service is shutting down")
+		}
+	}
+}
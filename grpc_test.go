@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func grpcClient(t *testing.T) GameClient {
+	conn, err := grpc.Dial("localhost:8081", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return NewGameClient(conn)
+}
+
+func Test_grpcFullGame(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	c := grpcClient(t)
+	ctx := context.Background()
+
+	player1 := "player1"
+	player2 := "player2"
+
+	nr, err := c.NewRound(ctx, &NewRoundRequest{Player: player1})
+	require.NoError(t, err)
+
+	watch, err := c.WatchRound(ctx, &ResultRequest{Round: nr.Round, Player: player1})
+	require.NoError(t, err)
+
+	res, err := c.Attach(ctx, &AttachRequest{Round: nr.Round, Player: player2})
+	require.NoError(t, err)
+	require.Equal(t, "place Your bet, please", res.Response)
+
+	res, err = c.Bet(ctx, &BetRequest{Round: nr.Round, Player: player1, Bet: saltedHash("p1 secret", "paper")})
+	require.NoError(t, err)
+	require.Equal(t, "wait for the rival to place its bet", res.Response)
+
+	res, err = c.Bet(ctx, &BetRequest{Round: nr.Round, Player: player2, Bet: saltedHash("p2 secret", "stone")})
+	require.NoError(t, err)
+	require.Equal(t, "disclose your bet, please", res.Response)
+
+	res, err = c.Disclose(ctx, &DiscloseRequest{Round: nr.Round, Player: player1, Secret: "p1 secret", Bet: "paper"})
+	require.NoError(t, err)
+	require.Equal(t, "wait for your rival to disclose its bet", res.Response)
+
+	res, err = c.Disclose(ctx, &DiscloseRequest{Round: nr.Round, Player: player2, Secret: "p2 secret", Bet: "stone"})
+	require.NoError(t, err)
+	require.Equal(t, "You lose: your bet: stone, the rival's bet: paper", res.Response)
+
+	res, err = c.Result(ctx, &ResultRequest{Round: nr.Round, Player: player1})
+	require.NoError(t, err)
+	require.Equal(t, "You won: your bet: paper, the rival's bet: stone", res.Response)
+
+	// the watcher receives the changes of result until the round is finished
+	last := ""
+	for {
+		r, err := watch.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NotEqual(t, last, r.Response)
+		last = r.Response
+	}
+	require.Equal(t, "You won: your bet: paper, the rival's bet: stone", last)
+}
+
+func Test_grpcBadRequests(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	c := grpcClient(t)
+	ctx := context.Background()
+
+	_, err := c.NewRound(ctx, &NewRoundRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = c.Attach(ctx, &AttachRequest{Round: "not_existing"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = c.Result(ctx, &ResultRequest{Round: "not_existing", Player: "p1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	nr, err := c.NewRound(ctx, &NewRoundRequest{Player: "p1"})
+	require.NoError(t, err)
+
+	// the watcher of foreign round ends after the first response
+	watch, err := c.WatchRound(ctx, &ResultRequest{Round: nr.Round, Player: "p3"})
+	require.NoError(t, err)
+	r, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, msgUnauthorized, r.Response)
+	_, err = watch.Recv()
+	require.Equal(t, io.EOF, err)
+}
+
+func Test_grpcWatcherShutdown(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	wg := startService(t)
+
+	c := grpcClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nr, err := c.NewRound(ctx, &NewRoundRequest{Player: "p1"})
+	require.NoError(t, err)
+
+	watch, err := c.WatchRound(ctx, &ResultRequest{Round: nr.Round, Player: "p1"})
+	require.NoError(t, err)
+	r, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "wait for rival attach", r.Response)
+
+	stopService(wg)
+
+	_, err = watch.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func Test_grpcWatchCancelled(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	c := grpcClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nr, err := c.NewRound(ctx, &NewRoundRequest{Player: "p1", Spectators: spectatorsPublic})
+	require.NoError(t, err)
+	watch, err := c.WatchRound(ctx, &ResultRequest{Round: nr.Round, Player: "p1"})
+	require.NoError(t, err)
+	spectate, err := c.Spectate(ctx, &SpectateRequest{Round: nr.Round})
+	require.NoError(t, err)
+	r, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "wait for rival attach", r.Response)
+
+	_, err = request("cancel", []byte(`{"round":"`+nr.Round+`","player":"p1"}`))
+	require.NoError(t, err)
+
+	// both streams end with the cancelled round
+	r, err = watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, msgCancelled, r.Response)
+	_, err = watch.Recv()
+	require.Equal(t, io.EOF, err)
+	var last *SpectateResponse
+	for {
+		v, err := spectate.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		last = v
+	}
+	require.Equal(t, string(StateCancelled), last.State)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// The house bot is the provably fair bot: its moves are derived from the seeds of hash chain. The chain is made
+// from the random root by repeated sha256: seed(i-1) = sha256(seed(i)), seed(0) is the anchor published before
+// the seeds are used. The seeds are used from index 1 up, so the revealed seed discloses the seeds with lower
+// indexes that can still be in play when the rounds are finished out of order. Therefore the move is derived from
+// the seed together with the HMAC of round id under the chain key. The key is committed by its hash published with
+// the anchor and it is revealed when the chain is exhausted.
+// The seed with the HMAC is the secret of the bot's hidden bet, so the commitment can't be brute-forced by the seed
+// disclosed by the later round. The secret is revealed when the round is finished, and anybody can check that
+// the seed leads to the anchor, the bet is derived from the seed, the HMAC and the round id and it matches
+// the commitment. The HMAC is checked by the chain key after the key is revealed.
+// The player's bet against the house bot is accepted during houseBetWindow after the bot's bet, so the key is revealed
+// in houseBetWindow after the chain is exhausted when the rounds of chain can't get the player's bets.
+
+const (
+	houseBot         = "house" // name of the house bot
+	houseChainLength = 10000   // number of seeds in the chain
+
+	houseBetWindow = time.Hour * 24 // the wait of player's bet after the house bot's bet
+)
+
+// HouseSeed is the reference to the seed of hash chain used by the house bot in the round
+type HouseSeed struct {
+	Chain string `json:"chain"` // id of hash chain
+	Index int    `json:"index"` // index of the seed in the chain starting from 1
+	Mac   string `json:"mac"`   // BASE64URL of HMAC-SHA256 of round id under the chain key
+}
+
+// HouseChain is the public data of hash chain
+type HouseChain struct {
+	ID      string `json:"chain"`         // id of hash chain
+	Anchor  string `json:"anchor"`        // BASE64URL of seed(0)
+	KeyHash string `json:"key_hash"`      // BASE64URL of sha256 of the chain key
+	Key     string `json:"key,omitempty"` // BASE64URL of the chain key, it is revealed when the chain is exhausted
+	Length  int    `json:"length"`        // number of seeds
+	Used    int    `json:"used"`          // number of used seeds
+	Created int64  `json:"created"`       // creation time (Unix time in milliseconds)
+}
+
+// HouseChains is an interface of the storage of hash chains of the house bot
+type HouseChains interface {
+	// Next returns the next unused seed of the current chain with the HMAC of round. The new chain is started when
+	// the current one is exhausted.
+	Next(round string) (*HouseSeed, string, error)
+	// Chain returns the public data of chain with id or of the current chain when id is empty
+	Chain(id string) (*HouseChain, error)
+}
+
+// house is the storage of hash chains. The house bot is not supported when it is nil.
+var house HouseChains
+
+// hashSeed returns seed hashed n times
+func hashSeed(seed []byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		h := sha256.Sum256(seed)
+		seed = h[:]
+	}
+	return seed
+}
+
+// VerifyHouseSeed checks that the seed with index leads to the chain anchor
+func VerifyHouseSeed(anchor, seed string, index int) bool {
+	bSeed, err := base64.RawURLEncoding.DecodeString(seed)
+	if err != nil || index < 1 {
+		return false
+	}
+	return encode64(hashSeed(bSeed, index)) == anchor
+}
+
+// houseMac returns the HMAC of round id under the chain key
+func houseMac(key []byte, round string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(round))
+	return encode64(h.Sum(nil))
+}
+
+// VerifyHouseMac checks that the revealed chain key matches the key hash and the HMAC of round id is made with it
+func VerifyHouseMac(keyHash, key, mac, round string) bool {
+	bKey, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return false
+	}
+	h := sha256.Sum256(bKey)
+	return encode64(h[:]) == keyHash && hmac.Equal([]byte(houseMac(bKey, round)), []byte(mac))
+}
+
+// houseSecret returns the secret of the house bot's hidden bet made of the seed and the HMAC of round
+func houseSecret(seed, mac string) string {
+	return seed + mac
+}
+
+// houseSeed returns the seed of the house bot's secret. It returns false when the secret isn't made with mac.
+func houseSeed(secret, mac string) (string, bool) {
+	if mac == "" || !strings.HasSuffix(secret, mac) {
+		return "", false
+	}
+	return strings.TrimSuffix(secret, mac), true
+}
+
+// houseMove returns the move of game derived from the seed, the HMAC of round and the round id
+func houseMove(g Game, seed, mac, round string) Gesture {
+	h := sha256.Sum256([]byte(seed + mac + round))
+	moves := sortedMoves(g)
+	return moves[binary.BigEndian.Uint64(h[:8])%uint64(len(moves))]
+}
+
+// redisHouse is a Redis implementation of HouseChains interface
+type redisHouse struct {
+	r      redis.UniversalClient
+	length int
+}
+
+// NewHouseChains returns a new instance of HouseChains interface implementing the storage via Redis hashes.
+// The new chains have length seeds.
+func NewHouseChains(opt redis.UniversalOptions, length int) (HouseChains, error) {
+	s := &redisHouse{redis.NewUniversalClient(&opt), length}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+const houseCurrentKey = "house:current" // key of the id of current chain
+
+// houseChainKey returns the key of the hash of chain
+func houseChainKey(id string) string {
+	return "house:chain:" + id
+}
+
+// newChain makes the new chain and sets it as current one
+func (s *redisHouse) newChain() (string, error) {
+	root := make([]byte, sha256.Size)
+	if _, err := rand.Read(root); err != nil {
+		return "", err
+	}
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	keyHash := sha256.Sum256(key)
+	id := uuid.NewString()
+	_, err := s.r.TxPipelined(func(p redis.Pipeliner) error {
+		p.HMSet(houseChainKey(id), map[string]interface{}{
+			"root":    encode64(root),
+			"anchor":  encode64(hashSeed(root, s.length)),
+			"key":     encode64(key),
+			"keyhash": encode64(keyHash[:]),
+			"length":  s.length,
+			"used":    0,
+			"created": nowMilli(),
+		})
+		p.Set(houseCurrentKey, id, 0)
+		return nil
+	})
+	return id, err
+}
+
+// Next increments the number of used seeds of the current chain and calculates the seed by the chain root.
+// The legacy chain without key is replaced by the new one.
+func (s *redisHouse) Next(round string) (*HouseSeed, string, error) {
+	id, err := s.r.Get(houseCurrentKey).Result()
+	if err == redis.Nil {
+		id, err = s.newChain()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		var used *redis.IntCmd
+		var fields *redis.SliceCmd
+		_, err := s.r.Pipelined(func(p redis.Pipeliner) error {
+			used = p.HIncrBy(houseChainKey(id), "used", 1)
+			fields = p.HMGet(houseChainKey(id), "root", "length", "key")
+			return nil
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		root, _ := fields.Val()[0].(string)
+		length, _ := fields.Val()[1].(string)
+		key, _ := fields.Val()[2].(string)
+		n, err := strconv.Atoi(length)
+		bRoot, rErr := base64.RawURLEncoding.DecodeString(root)
+		bKey, kErr := base64.RawURLEncoding.DecodeString(key)
+		if err != nil || rErr != nil || kErr != nil {
+			return nil, "", fmt.Errorf("wrong house chain: %s", id)
+		}
+		if idx := int(used.Val()); idx <= n && len(bKey) > 0 {
+			if idx == n {
+				// the last seed is used: the key is revealed after the bets of its rounds
+				if err := s.r.HSetNX(houseChainKey(id), "exhausted", nowMilli()).Err(); err != nil {
+					return nil, "", err
+				}
+			}
+			seed := &HouseSeed{Chain: id, Index: idx, Mac: houseMac(bKey, round)}
+			return seed, encode64(hashSeed(bRoot, n-idx)), nil
+		}
+		// the chain is exhausted
+		if id, err = s.newChain(); err != nil {
+			return nil, "", err
+		}
+	}
+}
+
+// Chain reads the hash of chain
+func (s *redisHouse) Chain(id string) (*HouseChain, error) {
+	if id == "" {
+		current, err := s.r.Get(houseCurrentKey).Result()
+		if err == redis.Nil {
+			current, err = s.newChain()
+		}
+		if err != nil {
+			return nil, err
+		}
+		id = current
+	}
+	fields, err := s.r.HGetAll(houseChainKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, redis.Nil
+	}
+	c := &HouseChain{ID: id, Anchor: fields["anchor"], KeyHash: fields["keyhash"]}
+	c.Length, _ = strconv.Atoi(fields["length"])
+	c.Used, _ = strconv.Atoi(fields["used"])
+	c.Created, _ = strconv.ParseInt(fields["created"], 10, 64)
+	if c.Used > c.Length {
+		c.Used = c.Length
+	}
+	if exhausted, err := strconv.ParseInt(fields["exhausted"], 10, 64); err == nil &&
+		nowMilli() >= exhausted+houseBetWindow.Milliseconds() {
+		// the rounds of chain can't get the player's bets any more
+		c.Key = fields["key"]
+	}
+	return c, nil
+}
+
+// HouseBet places the server-assisted bet of the house bot. The bet and the secret are derived from the next seed
+// of hash chain and the HMAC of round. It returns true when the bet was placed.
+func (r *Round) HouseBet(player string) (res string, placed bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	defer r.record(eventBet, player, map[string]string{"mode": modeAssisted}, r.eventFields(), &res)
+
+	if house == nil {
+		return "house bot is not supported", false
+	}
+	ref, seed, err := house.Next(r.ID)
+	if err != nil {
+		log.Printf("round: %s: house chain error: %v", r.ID, err)
+		return "house bot can't bet now", false
+	}
+	bet := houseMove(r.game(), seed, ref.Mac, r.ID).String()
+	if res, placed = r.assistedBet(bet, houseSecret(seed, ref.Mac), player); placed {
+		r.House = ref
+		r.reSing()
+	}
+	return res, placed
+}
+
+// HouseProof is the revealed data of the house bot's bet
+type HouseProof struct {
+	HouseSeed
+	Commitment string `json:"commitment"` // hidden bet of the house bot
+	Seed       string `json:"seed"`       // the seed of chain, the secret of hidden bet is the seed with the HMAC
+	Bet        string `json:"bet"`        // open bet of the house bot
+}
+
+// HouseProof returns the proof of the house bot's bet for player. It returns nil when the round is not finished,
+// it is not played by the house bot or it can't be played by player.
+func (r *Round) HouseProof(player string) *HouseProof {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.House == nil || r.check(player) != "" || r.state() != StateFinished {
+		return nil
+	}
+	seed, _ := houseSeed(r.Secret2, r.House.Mac)
+	return &HouseProof{HouseSeed: *r.House, Commitment: r.HiddenBet2, Seed: seed, Bet: r.Bet2.String()}
+}
+
+// BotCommitment returns the hidden bet of the bot or empty string when the round is not played by bot
+// or the bot has not placed its bet yet
+func (r *Round) BotCommitment() string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.Bot == "" {
+		return ""
+	}
+	return r.HiddenBet2
+}
+
+// HouseAnchor realizes the request for the public data of hash chain of the house bot
+func HouseAnchor(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	chain, err := house.Chain(req.URL.Query().Get("chain"))
+	if errors.Is(err, redis.Nil) {
+		http.Error(w, "chain not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		storageError(fmt.Errorf("House chain error: %w", err), w)
+		return
+	}
+	sendResponse(w, chain)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_HouseChain(t *testing.T) {
+	_, err := NewHouseChains(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}}, 3)
+	require.Error(t, err)
+
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+
+	h, err := NewHouseChains(redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}, 3)
+	require.NoError(t, err)
+
+	// start the short chain instead of the current one
+	id, err := h.(*redisHouse).newChain()
+	require.NoError(t, err)
+	seed, secret, err := h.Next("round1")
+	require.NoError(t, err)
+	require.Equal(t, id, seed.Chain)
+	require.Equal(t, 1, seed.Index)
+	chain, err := h.Chain(id)
+	require.NoError(t, err)
+	require.NotEmpty(t, chain.KeyHash)
+	macs := map[string]string{"round1": seed.Mac}
+	for seed.Index < chain.Length {
+		require.True(t, VerifyHouseSeed(chain.Anchor, secret, seed.Index))
+		round := fmt.Sprintf("round%d", seed.Index+1)
+		seed, secret, err = h.Next(round)
+		require.NoError(t, err)
+		macs[round] = seed.Mac
+	}
+	require.True(t, VerifyHouseSeed(chain.Anchor, secret, seed.Index))
+	require.False(t, VerifyHouseSeed(chain.Anchor, secret, seed.Index-1))
+
+	// the exhausted chain is replaced by the new one
+	next, nextSecret, err := h.Next("round4")
+	require.NoError(t, err)
+	require.NotEqual(t, chain.ID, next.Chain)
+	require.Equal(t, 1, next.Index)
+	current, err := h.Chain("")
+	require.NoError(t, err)
+	require.Equal(t, &HouseChain{ID: next.Chain, Anchor: current.Anchor, KeyHash: current.KeyHash, Length: 3, Used: 1,
+		Created: current.Created}, current)
+	require.True(t, VerifyHouseSeed(current.Anchor, nextSecret, 1))
+	chain, err = h.Chain(seed.Chain)
+	require.NoError(t, err)
+	require.Equal(t, 3, chain.Used)
+	// the key is not revealed till the rounds of exhausted chain can get the player's bets
+	require.Empty(t, chain.Key)
+	defer func(prev func() time.Time) { now = prev }(now)
+	now = func() time.Time { return time.Now().Add(houseBetWindow) }
+	chain, err = h.Chain(seed.Chain)
+	require.NoError(t, err)
+	require.NotEmpty(t, chain.Key)
+	for round, mac := range macs {
+		require.True(t, VerifyHouseMac(chain.KeyHash, chain.Key, mac, round))
+	}
+	require.False(t, VerifyHouseMac(chain.KeyHash, chain.Key, macs["round1"], "round2"))
+	require.False(t, VerifyHouseMac(current.KeyHash, chain.Key, macs["round1"], "round1"))
+	now = time.Now
+	_, err = h.Chain("unknown")
+	require.Equal(t, redis.Nil, err)
+
+	// the house bot's bet is checked by the transcript verification
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "k1")
+	useMemSealKeys(t)
+	house = h
+	defer func() { house = nil }()
+	tr, err := NewRoundWithOptions("player1", RoundOptions{Opponent: "bot:house"})
+	require.NoError(t, err)
+	require.NoError(t, botPlay(tr))
+	require.Equal(t, next.Chain, tr.House.Chain)
+	require.Equal(t, 2, tr.House.Index)
+	require.Nil(t, tr.HouseProof("player1"))
+	tr.Bet(tr.saltedHash("s1", []byte("stone")), "player1")
+	tr.Disclose("s1", "stone", "player1")
+	proof := tr.HouseProof("player1")
+	require.Equal(t, tr.saltedHash(houseSecret(proof.Seed, proof.Mac), []byte(proof.Bet)), proof.Commitment)
+	require.True(t, VerifyHouseSeed(current.Anchor, proof.Seed, proof.Index))
+	require.Nil(t, tr.HouseProof("player2"))
+	require.Equal(t, houseMove(tr.game(), proof.Seed, proof.Mac, tr.ID).String(), proof.Bet)
+
+	// the player's bet is rejected when the house bot's bet is expired
+	tr2, err := NewRoundWithOptions("player1", RoundOptions{Opponent: "bot:house"})
+	require.NoError(t, err)
+	require.NoError(t, botPlay(tr2))
+	now = func() time.Time { return time.Now().Add(houseBetWindow + time.Second) }
+	require.Equal(t, "the bet of the house bot has expired", tr2.Bet(tr2.saltedHash("s1", []byte("stone")), "player1"))
+	now = time.Now
+
+	transcript, _ := tr.Transcript()
+	data, _ := json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.NoError(t, err)
+	// the bet chosen by the server doesn't match the seed
+	move := scissors
+	if transcript.Bet2 == scissors.String() {
+		move = paper
+	}
+	transcript.Bet2 = move.String()
+	transcript.Commitment2 = tr.saltedHash(transcript.Secret2, []byte(move.String()))
+	transcript.Winner = winners[rules[stone][move]]
+	transcript.Points1, transcript.Points2 = tr.game().Points(stone, move)
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.EqualError(t, err, fmt.Sprintf("house bet %s doesn't match seed %s", transcript.Bet2, proof.Seed))
+	// the mac is always checked
+	transcript.House.Mac = ""
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.EqualError(t, err, fmt.Sprintf("house secret %s doesn't match mac ", transcript.Secret2))
+}
+
+func Test1_HouseOutOfOrder(t *testing.T) {
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+	h, err := NewHouseChains(redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}, 10)
+	require.NoError(t, err)
+	_, err = h.(*redisHouse).newChain()
+	require.NoError(t, err)
+
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "k1")
+	useMemSealKeys(t)
+	house = h
+	defer func() { house = nil }()
+	rounds := make([]*Round, 2)
+	for i := range rounds {
+		rounds[i], err = NewRoundWithOptions("player1", RoundOptions{Opponent: "bot:house"})
+		require.NoError(t, err)
+		require.NoError(t, botPlay(rounds[i]))
+	}
+	earlier, later := rounds[0], rounds[1]
+	require.Equal(t, earlier.House.Index+1, later.House.Index)
+
+	// the later round is finished first: its seed discloses the seed of the earlier round
+	later.Bet(later.saltedHash("s1", []byte("stone")), "player1")
+	later.Disclose("s1", "stone", "player1")
+	proof := later.HouseProof("player1")
+	require.NotNil(t, proof)
+	bSeed, err := base64.RawURLEncoding.DecodeString(proof.Seed)
+	require.NoError(t, err)
+	seed := encode64(hashSeed(bSeed, 1))
+	// the commitment of the earlier round can't be brute-forced with the seed alone
+	commitment := earlier.BotCommitment()
+	for _, move := range sortedMoves(earlier.game()) {
+		require.NotEqual(t, earlier.saltedHash(seed, []byte(move.String())), commitment)
+	}
+
+	earlier.Bet(earlier.saltedHash("s1", []byte("stone")), "player1")
+	earlier.Disclose("s1", "stone", "player1")
+	proof = earlier.HouseProof("player1")
+	require.NotNil(t, proof)
+	require.Equal(t, seed, proof.Seed)
+	require.Equal(t, earlier.saltedHash(houseSecret(seed, proof.Mac), []byte(proof.Bet)), commitment)
+}
+
+func Test2_HouseService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	// the service changes the key ring and seal keys used by the following tests
+	stored := ring
+	defer func() { ring, sealKeys, house = stored, nil, nil }()
+	defer stopService(startService(t))
+
+	data, err := request("new", []byte(`{"player":"h1","opponent":"bot:house"}`))
+	require.NoError(t, err)
+	created := struct {
+		Round      string `json:"round"`
+		Commitment string `json:"commitment"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &created))
+	require.NotEmpty(t, created.Commitment)
+
+	_, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":"h1","bet":%q}`,
+		created.Round, saltedHash("h1", "paper"))))
+	require.NoError(t, err)
+	data, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":"h1","bet":"paper","secret":"h1"}`,
+		created.Round)))
+	require.NoError(t, err)
+	resp := struct {
+		House *HouseProof `json:"house"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &resp))
+	require.Equal(t, created.Commitment, resp.House.Commitment)
+
+	get := func(url string) (int, []byte) {
+		resp, err := http.Get("http://localhost:8080" + url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, data
+	}
+	status, data := get("/house/anchor?chain=" + resp.House.Chain)
+	require.Equal(t, http.StatusOK, status)
+	chain := &HouseChain{}
+	require.NoError(t, json.Unmarshal(data, chain))
+	require.True(t, VerifyHouseSeed(chain.Anchor, resp.House.Seed, resp.House.Index))
+	status, _ = get("/house/anchor?chain=unknown")
+	require.Equal(t, http.StatusNotFound, status)
+	status, _ = get("/house/anchor")
+	require.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// idempotencyHeader is the request header with the client generated key of request
+const idempotencyHeader = "Idempotency-Key"
+
+// idemPendingTTL is the lifetime of the reservation of key while the first request is in progress.
+// It is short, so the key isn't blocked for long when the service crashes during the request.
+const idemPendingTTL = time.Minute
+
+// idemRecord is the stored first response of the request made with an idempotency key
+type idemRecord struct {
+	BodyHash    string `json:"hash"`              // hash of the request body
+	Pending     bool   `json:"pending,omitempty"` // the first request is still in progress
+	Status      int    `json:"status,omitempty"`  // response status code
+	ContentType string `json:"type,omitempty"`    // response content type
+	Body        []byte `json:"body,omitempty"`    // response body
+}
+
+// IdempotencyStore is an interface for the storage of responses made for the requests with idempotency keys
+type IdempotencyStore interface {
+	// Reserve marks the key as being in progress. It returns the stored record when the key was already used.
+	Reserve(key, bodyHash string) (*idemRecord, error)
+	// Save stores the response for the reserved key
+	Save(key string, rec *idemRecord) error
+	// Release removes the reservation so the request can be repeated
+	Release(key string) error
+}
+
+// redisIdempotency is a Redis implementation of IdempotencyStore interface
+type redisIdempotency struct {
+	r   redis.UniversalClient
+	ttl time.Duration
+}
+
+// NewIdempotencyStore returns a new instance of IdempotencyStore interface that keeps responses in Redis for ttl
+func NewIdempotencyStore(opt redis.UniversalOptions, ttl time.Duration) (IdempotencyStore, error) {
+	s := &redisIdempotency{redis.NewUniversalClient(&opt), ttl}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reserve stores the pending record for the key when the key is not used yet, otherwise it returns the stored record.
+// The pending record lives for idemPendingTTL, the response is kept for the full ttl when it is saved.
+func (s *redisIdempotency) Reserve(key, bodyHash string) (*idemRecord, error) {
+	data, _ := json.Marshal(idemRecord{BodyHash: bodyHash, Pending: true})
+	ok, err := s.r.SetNX(key, data, idemPendingTTL).Result()
+	if err != nil || ok {
+		return nil, err
+	}
+	stored, err := s.r.Get(key).Bytes()
+	if err == redis.Nil {
+		// the key expired or was released right now: try once again
+		return s.Reserve(key, bodyHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec := &idemRecord{}
+	if err := json.Unmarshal(stored, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Save stores the response for the key
+func (s *redisIdempotency) Save(key string, rec *idemRecord) error {
+	data, _ := json.Marshal(rec)
+	return s.r.Set(key, data, s.ttl).Err()
+}
+
+// Release removes the key
+func (s *redisIdempotency) Release(key string) error {
+	return s.r.Del(key).Err()
+}
+
+// responseRecorder writes the response and keeps its copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idemScope returns the hash of player of request body, so the keys of different players don't collide.
+// The requests without player have the common scope.
+func idemScope(body []byte) string {
+	input := struct {
+		Player string `json:"player"`
+	}{}
+	_ = json.Unmarshal(body, &input)
+	h := sha256.Sum256([]byte(input.Player))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// idempotent wraps the handler of mutating request. The first response to the request with Idempotency-Key header is
+// stored and replayed verbatim for retries with the same key, player and body. The requests without the header and all
+// requests when store is nil are passed to handler as is.
+func idempotent(store IdempotencyStore, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(idempotencyHeader)
+		if store == nil || key == "" {
+			handler(w, req)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			log.Printf("request body reading error: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		h := sha256.Sum256(body)
+		bodyHash := base64.RawURLEncoding.EncodeToString(h[:])
+
+		// keys are individual for each endpoint and player
+		storeKey := "idempotency:" + req.URL.Path + ":" + idemScope(body) + ":" + key
+
+		rec, err := store.Reserve(storeKey, bodyHash)
+		if err != nil {
+			storageError(err, w)
+			return
+		}
+		if rec != nil {
+			switch {
+			case rec.BodyHash != bodyHash:
+				http.Error(w, "Idempotency-Key is already used for another request", http.StatusUnprocessableEntity)
+			case rec.Pending:
+				http.Error(w, "the request with the same Idempotency-Key is in progress", http.StatusConflict)
+			default:
+				log.Printf("replay of %s response for %s: %s", req.URL.Path, idempotencyHeader, key)
+				w.Header().Set("Content-Type", rec.ContentType)
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(rec.Status)
+				if _, err := w.Write(rec.Body); err != nil {
+					log.Printf("response writing error: %v", err)
+				}
+			}
+			return
+		}
+
+		rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if p := recover(); p != nil {
+				// the request can be repeated after the panic
+				if err := store.Release(storeKey); err != nil {
+					log.Printf("idempotency key %s releasing error: %v", key, err)
+				}
+				panic(p)
+			}
+		}()
+		handler(rw, req)
+
+		if rw.status >= http.StatusInternalServerError {
+			// don't remember failures that may disappear on retry
+			err = store.Release(storeKey)
+		} else {
+			err = store.Save(storeKey, &idemRecord{
+				BodyHash:    bodyHash,
+				Status:      rw.status,
+				ContentType: rw.Header().Get("Content-Type"),
+				Body:        rw.body.Bytes(),
+			})
+		}
+		if err != nil {
+			log.Printf("idempotency key %s storing error: %v", key, err)
+		}
+	}
+}
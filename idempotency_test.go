@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_IdempotencyStore(t *testing.T) {
+	_, err := NewIdempotencyStore(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}}, time.Second)
+	require.Error(t, err)
+
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+
+	opt := redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}
+	s, err := NewIdempotencyStore(opt, time.Hour)
+	require.NoError(t, err)
+	r := redis.NewUniversalClient(&opt)
+
+	key := "idempotency:/test:" + NewRound("u1").ID // just a random key
+
+	rec, err := s.Reserve(key, "hash")
+	require.NoError(t, err)
+	require.Nil(t, rec)
+	// the reservation is short
+	require.LessOrEqual(t, r.TTL(key).Val(), idemPendingTTL)
+
+	rec, err = s.Reserve(key, "hash")
+	require.NoError(t, err)
+	require.Equal(t, &idemRecord{BodyHash: "hash", Pending: true}, rec)
+
+	stored := &idemRecord{BodyHash: "hash", Status: 200, ContentType: "application/json", Body: []byte(`{}`)}
+	require.NoError(t, s.Save(key, stored))
+	require.Greater(t, r.TTL(key).Val(), idemPendingTTL)
+
+	rec, err = s.Reserve(key, "other hash")
+	require.NoError(t, err)
+	require.Equal(t, stored, rec)
+
+	require.NoError(t, s.Release(key))
+
+	rec, err = s.Reserve(key, "other hash")
+	require.NoError(t, err)
+	require.Nil(t, rec)
+}
+
+func idemRequest(t *testing.T, path, key, body string) (*http.Response, string) {
+	req, err := http.NewRequest("POST", "http://localhost:8080/"+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set(idempotencyHeader, key)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(buf)
+}
+
+func Test_serviceIdempotency(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	key := NewRound("u1").ID // just a random key
+
+	resp1, body1 := idemRequest(t, "new", key, `{"player":"player1"}`)
+	require.Equal(t, http.StatusOK, resp1.StatusCode)
+	require.Empty(t, resp1.Header.Get("Idempotent-Replayed"))
+
+	// retry returns the same round
+	resp2, body2 := idemRequest(t, "new", key, `{"player":"player1"}`)
+	require.Equal(t, http.StatusOK, resp2.StatusCode)
+	require.Equal(t, "true", resp2.Header.Get("Idempotent-Replayed"))
+	require.Equal(t, "application/json", resp2.Header.Get("Content-Type"))
+	require.Equal(t, body1, body2)
+
+	// the same key with another body is rejected
+	resp3, _ := idemRequest(t, "new", key, `{"player":"player1","game":"pennies"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, resp3.StatusCode)
+
+	// the same key of another player doesn't collide
+	resp3, body3 := idemRequest(t, "new", key, `{"player":"player3"}`)
+	require.Equal(t, http.StatusOK, resp3.StatusCode)
+	require.Empty(t, resp3.Header.Get("Idempotent-Replayed"))
+	require.NotEqual(t, body1, body3)
+
+	// the same key is independent for other endpoints
+	round := strings.Split(strings.TrimPrefix(body1, `{"round":"`), `"`)[0]
+	_, body := idemRequest(t, "attach", key, `{"player":"player2","round":"`+round+`"}`)
+	require.Contains(t, body, `{"response":"place Your bet, please","pseudonym":"`)
+
+	bet := `{"player":"player1","round":"` + round + `","bet":"` + saltedHash("p1 secret", "paper") + `"}`
+	_, body = idemRequest(t, "bet", key, bet)
+	require.Equal(t, `{"response":"wait for the rival to place its bet"}`, body)
+
+	// retried bet is not rejected as already placed
+	resp, body := idemRequest(t, "bet", key, bet)
+	require.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	require.Equal(t, `{"response":"wait for the rival to place its bet"}`, body)
+
+	// bad requests are replayed too
+	resp1, body1 = idemRequest(t, "disclose", key, `{}`)
+	require.Equal(t, http.StatusBadRequest, resp1.StatusCode)
+	resp2, body2 = idemRequest(t, "disclose", key, `{}`)
+	require.Equal(t, http.StatusBadRequest, resp2.StatusCode)
+	require.Equal(t, body1, body2)
+
+	// failures are not stored
+	resp1, _ = idemRequest(t, "attach", key+"1", `{"player":"player2","round":"not_existing"}`)
+	require.Equal(t, http.StatusInternalServerError, resp1.StatusCode)
+	resp2, _ = idemRequest(t, "attach", key+"1", `{"player":"player2","round":"not_existing"}`)
+	require.Equal(t, http.StatusInternalServerError, resp2.StatusCode)
+	require.Empty(t, resp2.Header.Get("Idempotent-Replayed"))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// keyRing is the set of server keys used for players' hashes and round signatures. Each key has its id.
+// The active key is used for new rounds and new signatures, other keys are used only for verification.
+type keyRing struct {
+	keys   map[string]string // server keys by key id
+	active string            // id of the active key
+}
+
+// ring is the server key ring. By default it contains only the legacy key (SSP_SERVER_SALT) with empty id.
+var ring = &keyRing{keys: map[string]string{"": ""}, active: ""}
+
+// newKeyRing returns the key ring with keys and active key id
+func newKeyRing(keys map[string]string, active string) (*keyRing, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active server key %q is not in the key ring", active)
+	}
+	return &keyRing{keys: keys, active: active}, nil
+}
+
+// resignJob migrates the rounds signed by not active keys to the active key every interval until stop is closed
+func resignJob(lister RoundLister, interval time.Duration, stop <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+		n, err := resignRounds(lister)
+		if err != nil {
+			log.Printf("rounds re-signing error: %v", err)
+		}
+		if n > 0 {
+			log.Printf("%d rounds re-signed with the server key %q", n, ring.active)
+		}
+	}
+}
+
+// resignRounds re-signs all stored rounds that are signed by not active key. Rounds with not valid signatures
+// are not touched. It returns the number of re-signed rounds. The rounds are read through the cache, so the round
+// in play is re-signed under its lock, but the rounds that were not cached are evicted after the re-signing
+// to keep the history of rounds out of the memory cache.
+func resignRounds(lister RoundLister) (int, error) {
+	count := 0
+	err := lister.ForEachRound(func(id string) error {
+		if !roundCached(id) {
+			defer evictRound(id)
+		}
+		round, err := db.Retrieve(id)
+		if errors.Is(err, redis.Nil) {
+			return nil // the round was removed after listing
+		}
+		if err != nil {
+			return err
+		}
+		if !round.Resign() {
+			return nil
+		}
+		count++
+		return db.Store(round)
+	})
+	return count, err
+}
+
+// persistentKey returns the secret key stored by name in Redis. The key is generated on the first call and it is
+// never rotated, so the ids made with it don't change after the rotation of server keys.
+func persistentKey(r redis.UniversalClient, name string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	if err := r.SetNX(name, encode64(b), 0).Err(); err != nil {
+		return "", err
+	}
+	return r.Get(name).Result()
+}
+
+// stableID returns the id of obj in the scope id made with the persistent key
+func stableID(key, id string, obj interface{}) string {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(id))
+	h.Write([]byte{0})
+	h.Write(data)
+	return encode64(h.Sum(nil))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func useKeyRing(t *testing.T, keys map[string]string, active string) {
+	stored := ring
+	kr, err := newKeyRing(keys, active)
+	require.NoError(t, err)
+	ring = kr
+	t.Cleanup(func() { ring = stored })
+}
+
+func Test_newKeyRing(t *testing.T) {
+	_, err := newKeyRing(map[string]string{"": "salt", "k1": "key1"}, "k2")
+	require.Error(t, err)
+
+	kr, err := newKeyRing(map[string]string{"": "salt", "k1": "key1"}, "k1")
+	require.NoError(t, err)
+	require.Equal(t, "k1", kr.active)
+}
+
+func Test_keyRotation(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	useKeyRing(t, map[string]string{"": "salt"}, "")
+
+	// legacy round
+	tr := NewRound(player1)
+	tr.Attach(player2)
+	require.Equal(t, "", tr.KeyID)
+	require.Equal(t, "", tr.HashKeyID)
+
+	// new key is added and became active
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "k1")
+
+	require.Equal(t, "place Your bet, please", tr.Result(player1))
+	require.Equal(t, "wait for the rival to place its bet", tr.Bet(tr.saltedHash("my secret", []byte("paper")), player1))
+	// the changed round is signed by the active key but players' hashes are made with the old key
+	require.Equal(t, "k1", tr.KeyID)
+	require.Equal(t, "", tr.HashKeyID)
+
+	tr2 := NewRound(player1)
+	require.Equal(t, "k1", tr2.KeyID)
+	require.Equal(t, "k1", tr2.HashKeyID)
+	require.NotEqual(t, tr.Player1, tr2.roundSaltedHash(player1))
+
+	// the key used for signature is removed: the round isn't falsified, but it can't be checked
+	useKeyRing(t, map[string]string{"": "salt", "k2": "key2"}, "k2")
+	require.Equal(t, msgUnknownKey, tr.Result(player1))
+	require.Equal(t, msgUnknownKey, tr2.Result(player1))
+	require.False(t, tr.Resign())
+
+	// the same key id with another key value
+	useKeyRing(t, map[string]string{"": "salt", "k1": "another key"}, "k1")
+	require.Equal(t, msgFalsificated, tr.Result(player1))
+}
+
+func Test_Resign(t *testing.T) {
+	player1 := "player1"
+
+	useKeyRing(t, map[string]string{"": "salt"}, "")
+	tr := NewRound(player1)
+	require.False(t, tr.Resign())
+
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "k1")
+	require.True(t, tr.Resign())
+	require.Equal(t, "k1", tr.KeyID)
+	require.False(t, tr.Resign())
+	require.Equal(t, "wait for rival attach", tr.Result(player1))
+
+	// falsificated round is not re-signed
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1", "k2": "key2"}, "k2")
+	tr.Bet1 = paper
+	require.False(t, tr.Resign())
+	require.Equal(t, "k1", tr.KeyID)
+}
+
+func Test_resignRounds(t *testing.T) {
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+
+	d, err := NewDatabase(redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword})
+	require.NoError(t, err)
+	stored := db
+	db = NewCache(d, time.Minute, time.Minute)
+	defer func() { db = stored }()
+
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "")
+	tr := NewRound("u1")
+	require.NoError(t, d.Store(tr))
+	cached := NewRound("u2")
+	require.NoError(t, db.Store(cached))
+
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "k1")
+	n, err := resignRounds(d.(RoundLister))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, n, 2)
+	// the round that was not cached is not left in the cache, the cached round is re-signed in place
+	require.False(t, roundCached(tr.ID))
+	require.Equal(t, "k1", cached.KeyID)
+
+	rr, err := db.Retrieve(tr.ID)
+	require.NoError(t, err)
+	require.Equal(t, "k1", rr.KeyID)
+	require.Equal(t, "", rr.HashKeyID)
+	require.Equal(t, "wait for rival attach", rr.Result("u1"))
+
+	n, err = resignRounds(d.(RoundLister))
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// PlayerPoints is the points of finished round from the player's perspective
+type PlayerPoints struct {
+	Your  int `json:"your"`  // points scored by player
+	Rival int `json:"rival"` // points scored by rival
+}
+
+// PlayerPoints returns the points of finished round for player or nil when the round is not finished
+// or can't be played by player
+func (r *Round) PlayerPoints(player string) *PlayerPoints {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.check(player) != "" || r.state() != StateFinished {
+		return nil
+	}
+	if r.roundSaltedHash(player) == r.Player1 {
+		return &PlayerPoints{r.Points1, r.Points2}
+	}
+	return &PlayerPoints{r.Points2, r.Points1}
+}
+
+// LeagueEntry is the standing of league member
+type LeagueEntry struct {
+	Member string `json:"member"` // league member id
+	Points int    `json:"points"` // accumulated points
+	Place  int    `json:"place"`  // place in league starting from 1
+}
+
+// LeagueStore is an interface of the storage of league standings
+type LeagueStore interface {
+	// AddPoints adds the points of rated round to league members. It returns false when the points of the round
+	// are already added.
+	AddPoints(league, round string, points map[string]int) (bool, error)
+	// Standings returns the top limit members of league
+	Standings(league string, limit int) ([]LeagueEntry, error)
+	// Member returns the standing of member or nil when the member has no points in league
+	Member(league, member string) (*LeagueEntry, error)
+	// MemberID returns the member id of player in league
+	MemberID(league, player string) string
+}
+
+// leagues is the storage of league standings. The round points are not accumulated when it is nil.
+var leagues LeagueStore
+
+const (
+	maxLeagueName      = 64  // maximal length of league name
+	defaultLeagueLimit = 10  // default number of members in league standings
+	maxLeagueLimit     = 100 // maximal number of members in league standings
+
+	leagueMemberKey = "leaguekey" // Redis key of the persistent key of league member ids
+)
+
+// leagueKey returns the key of the sorted set of league standings
+func leagueKey(league string) string {
+	return "league:" + league
+}
+
+// leagueCreditedKey returns the key of the mark of round which points are added to the league
+func leagueCreditedKey(league, round string) string {
+	return leagueKey(league) + ":credited:" + round
+}
+
+// creditScript marks the round as credited and increments the scores of members when the round isn't
+// credited yet
+var creditScript = redis.NewScript(`
+if not redis.call('SET', KEYS[2], 1, 'NX', 'PX', ARGV[1]) then
+	return 0
+end
+for i = 2, #ARGV, 2 do
+	redis.call('ZINCRBY', KEYS[1], ARGV[i + 1], ARGV[i])
+end
+return 1
+`)
+
+// leagueMember returns the member id of player in league or empty string when leagues are not supported
+func leagueMember(league, player string) string {
+	if leagues == nil {
+		return ""
+	}
+	return leagues.MemberID(league, player)
+}
+
+// redisLeagues is a Redis implementation of LeagueStore interface
+type redisLeagues struct {
+	r   redis.UniversalClient
+	key string // persistent key of member ids
+}
+
+// NewLeagueStore returns a new instance of LeagueStore interface implementing the storage via Redis sorted sets
+func NewLeagueStore(opt redis.UniversalOptions) (LeagueStore, error) {
+	s := &redisLeagues{r: redis.NewUniversalClient(&opt)}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	key, err := persistentKey(s.r, leagueMemberKey)
+	if err != nil {
+		return nil, err
+	}
+	s.key = key
+	return s, nil
+}
+
+// MemberID returns the member id made with the persistent key, so the player's points are accumulated
+// under the same id after the rotation of server keys
+func (s *redisLeagues) MemberID(league, player string) string {
+	return stableID(s.key, leagueKey(league), player)
+}
+
+// AddPoints increments the scores of members in the league sorted set once per round
+func (s *redisLeagues) AddPoints(league, round string, points map[string]int) (bool, error) {
+	args := []interface{}{int64(time.Hour * 8760 / time.Millisecond)}
+	for member, pts := range points {
+		args = append(args, member, pts)
+	}
+	added, err := creditScript.Run(s.r, []string{leagueKey(league), leagueCreditedKey(league, round)}, args...).Int()
+	return added == 1, err
+}
+
+// Standings returns the members with the highest scores
+func (s *redisLeagues) Standings(league string, limit int) ([]LeagueEntry, error) {
+	list, err := s.r.ZRevRangeWithScores(leagueKey(league), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LeagueEntry, len(list))
+	for i, z := range list {
+		entries[i] = LeagueEntry{Member: z.Member.(string), Points: int(z.Score), Place: i + 1}
+	}
+	return entries, nil
+}
+
+// Member returns the score and the rank of member
+func (s *redisLeagues) Member(league, member string) (*LeagueEntry, error) {
+	var score *redis.FloatCmd
+	var rank *redis.IntCmd
+	_, err := s.r.Pipelined(func(p redis.Pipeliner) error {
+		score = p.ZScore(leagueKey(league), member)
+		rank = p.ZRevRank(leagueKey(league), member)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &LeagueEntry{Member: member, Points: int(score.Val()), Place: int(rank.Val()) + 1}, nil
+}
+
+// creditLeague adds the points of finished round to its league once unless the round is unrated
+func creditLeague(round *Round) {
+	round.mx.Lock()
+	league, unrated := round.League, round.Unrated
+	points := map[string]int{round.Member1: round.Points1, round.Member2: round.Points2}
+	round.mx.Unlock()
+	if leagues == nil || league == "" || unrated {
+		return
+	}
+	if _, err := leagues.AddPoints(league, round.ID, points); err != nil {
+		log.Printf("round: %s - league %s error: %v", round.ID, league, err)
+	}
+}
+
+// League realizes the request for league standings
+func League(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		League string `json:"league"`
+		Player string `json:"player"`
+		Limit  int    `json:"limit"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.League == "" {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if input.Limit <= 0 || input.Limit > maxLeagueLimit {
+		input.Limit = defaultLeagueLimit
+	}
+
+	standings, err := leagues.Standings(input.League, input.Limit)
+	if err != nil {
+		storageError(fmt.Errorf("League standings error: %w", err), w)
+		return
+	}
+	var you *LeagueEntry
+	if input.Player != "" {
+		if you, err = leagues.Member(input.League, leagueMember(input.League, input.Player)); err != nil {
+			storageError(fmt.Errorf("League standings error: %w", err), w)
+			return
+		}
+	}
+	sendResponse(w, struct {
+		Standings []LeagueEntry `json:"standings"`
+		You       *LeagueEntry  `json:"you,omitempty"`
+	}{standings, you})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_GlicoPoints(t *testing.T) {
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "k1")
+
+	for _, c := range []struct {
+		game, bet1, bet2 string
+		points1, points2 int
+	}{
+		{gameGlico, "paper", "stone", 5, 0},
+		{gameGlico, "stone", "paper", 0, 5},
+		{gameGlico, "scissors", "paper", 2, 0},
+		{gameGlico, "stone", "stone", 0, 0},
+		{gameRPS, "paper", "stone", 1, 0},
+		{gamePennies, "heads", "tails", 0, 1},
+	} {
+		tr, err := NewGameRound("player1", c.game)
+		require.NoError(t, err)
+		tr.Attach("player2")
+		require.Nil(t, tr.PlayerPoints("player1"))
+		tr.Bet(tr.saltedHash("s1", []byte(c.bet1)), "player1")
+		tr.Bet(tr.saltedHash("s2", []byte(c.bet2)), "player2")
+		tr.Disclose("s1", c.bet1, "player1")
+		tr.Disclose("s2", c.bet2, "player2")
+		require.Equal(t, &PlayerPoints{c.points1, c.points2}, tr.PlayerPoints("player1"), c)
+		require.Equal(t, &PlayerPoints{c.points2, c.points1}, tr.PlayerPoints("player2"), c)
+		require.Nil(t, tr.PlayerPoints("player3"))
+
+		transcript, _ := tr.Transcript()
+		data, _ := json.Marshal(SignTranscript(transcript))
+		_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+		require.NoError(t, err)
+		transcript.Points1++
+		data, _ = json.Marshal(SignTranscript(transcript))
+		_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+		require.Error(t, err)
+	}
+}
+
+func Test2_LeagueService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	league := uuid.NewString()
+	var last string
+	for _, bets := range [][2]string{{"paper", "stone"}, {"scissors", "paper"}, {"scissors", "stone"}} {
+		data, err := request("new", []byte(fmt.Sprintf(`{"player":"l1","game":"glico","league":%q}`, league)))
+		require.NoError(t, err)
+		created := struct {
+			Round string `json:"round"`
+		}{}
+		require.NoError(t, json.Unmarshal(data, &created))
+		last = created.Round
+		_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":"l2"}`, created.Round)))
+		require.NoError(t, err)
+		for i, player := range []string{"l1", "l2"} {
+			_, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`,
+				created.Round, player, saltedHash(player, bets[i]))))
+			require.NoError(t, err)
+		}
+		for i, player := range []string{"l1", "l2"} {
+			_, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q,"secret":%q}`,
+				created.Round, player, bets[i], player)))
+			require.NoError(t, err)
+		}
+	}
+
+	data, err := request("league", []byte(fmt.Sprintf(`{"league":%q,"player":"l2"}`, league)))
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf(`{"standings":[{"member":%q,"points":7,"place":1},{"member":%q,"points":1,"place":2}],`+
+		`"you":{"member":%q,"points":1,"place":2}}`,
+		leagueMember(league, "l1"), leagueMember(league, "l2"), leagueMember(league, "l2")), string(data))
+
+	standings := string(data)
+
+	// the resolution of round that isn't completed is repeated by the next request, the points are added once
+	round, err := db.Retrieve(last)
+	require.NoError(t, err)
+	require.False(t, round.Resolving)
+	round.mx.Lock()
+	round.Resolving = true
+	round.reSing()
+	round.mx.Unlock()
+	require.NoError(t, db.Store(round))
+	require.True(t, round.claimResolution())
+	require.False(t, round.claimResolution())
+	round.mx.Lock()
+	round.claimed = false
+	round.mx.Unlock()
+	_, err = request("result", []byte(fmt.Sprintf(`{"round":%q,"player":"l1"}`, last)))
+	require.NoError(t, err)
+	round, err = db.Retrieve(last)
+	require.NoError(t, err)
+	require.False(t, round.Resolving)
+	data, err = request("league", []byte(fmt.Sprintf(`{"league":%q,"player":"l2"}`, league)))
+	require.NoError(t, err)
+	require.Equal(t, standings, string(data))
+	added, err := leagues.AddPoints(league, last, map[string]int{leagueMember(league, "l1"): 3})
+	require.NoError(t, err)
+	require.False(t, added)
+
+	data, err = request("league", []byte(fmt.Sprintf(`{"league":%q,"player":"l3"}`, league)))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), `"you"`)
+
+	data, err = request("new", []byte(fmt.Sprintf(`{"player":"l1","league":%q}`, league+league)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "league name is longer than 64")
+
+	_, err = NewLeagueStore(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}})
+	require.Error(t, err)
+
+	// the member id doesn't change after the key rotation
+	member := leagueMember(league, "l1")
+	useKeyRing(t, map[string]string{"": ring.keys[""], "k2": "key2"}, "k2")
+	require.Equal(t, member, leagueMember(league, "l1"))
+}
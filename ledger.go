@@ -0,0 +1,607 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// The ledger is the double-entry book of virtual coins: every transaction moves coins between accounts and the sum
+// of its postings is 0. The stakes of both players are moved to the escrow account of round when the round is
+// filled by Attach; the winner gets both stakes, the stakes are refunded on draw, on cancel and on quarantine of round.
+// The round that isn't resolved in time is forfeited by the player that stalls it. The balances of players' accounts never go negative: the check and the change
+// of balances are made by one Lua script. The system accounts (prefixed by '@') have no such limit.
+
+// Transaction is the transaction of ledger
+type Transaction struct {
+	ID       string           `json:"id"`               // transaction id, the transaction with the same id is applied once
+	Kind     string           `json:"kind"`             // 'credit'|'escrow'|'payout'|'refund'
+	Round    string           `json:"round,omitempty"`  // id of round of the stakes
+	Escrow   string           `json:"escrow,omitempty"` // id of escrow transaction settled by payout or refund
+	Time     int64            `json:"time"`             // server time of transaction (Unix time in milliseconds)
+	Postings map[string]int64 `json:"postings"`         // amounts by accounts, the sum is 0
+}
+
+// Ledger is an interface of the storage of ledger
+type Ledger interface {
+	// Post applies the transaction atomically. It returns errInsufficientFunds when the balance of player's
+	// account would go negative and errTxApplied when the transaction with the same id is already applied.
+	Post(tx *Transaction) error
+	// Transaction returns the transaction by id
+	Transaction(id string) (*Transaction, error)
+	// Balance returns the balance of account
+	Balance(account string) (int64, error)
+	// Statement returns the last limit transactions of account, the last transaction is the first one
+	Statement(account string, limit int) ([]Transaction, error)
+	// Expired returns the ids of escrow transactions that are not settled in time
+	Expired() ([]string, error)
+	// Retry makes the escrow transaction expired, so its settlement is retried by stakeJob
+	Retry(escrow string) error
+	// Account returns the account of player
+	Account(player string) string
+	// Expiry returns the time the escrowed stakes wait for the round result
+	Expiry() time.Duration
+}
+
+// ledger is the ledger of virtual coins. The rounds can't be played for stakes when it is nil.
+var ledger Ledger
+
+const (
+	// transaction kinds
+	txCredit = "credit" // coins are issued to player's account
+	txEscrow = "escrow" // the stakes are moved to the escrow account of round
+	txPayout = "payout" // the stakes are moved from the escrow account to the winner
+	txRefund = "refund" // the stakes are returned to players
+
+	mintAccount = "@mint" // the system account the credited coins are issued from
+
+	ledgerAccountKey = "ledgerkey" // Redis key of the persistent key of account ids
+
+	defaultStatementLimit = 10   // default number of transactions in statement
+	maxStatementLimit     = 100  // maximal number of transactions in statement
+	maxStatement          = 1000 // maximal number of transactions kept in the statement of account
+	stakeCheckInterval    = time.Minute
+)
+
+var (
+	// errInsufficientFunds is returned when the balance of player's account would go negative
+	errInsufficientFunds = errors.New("insufficient funds")
+	// errUnbalanced is returned for the transaction with not zero sum of postings
+	errUnbalanced = errors.New("unbalanced transaction")
+	// errTxApplied is returned for the transaction with already applied id
+	errTxApplied = errors.New("transaction is already applied")
+	// errEscrowSettled is returned for the escrow transaction that is already settled
+	errEscrowSettled = errors.New("escrow is already settled")
+)
+
+const (
+	msgInsufficientFunds = "insufficient funds for the stake"
+	msgLedgerError       = "the stakes can't be escrowed, try again later"
+	msgStakesExpired     = "the stakes of round have expired"
+)
+
+// ledgerAccount returns the ledger account of player or empty string when stakes are not supported
+func ledgerAccount(player string) string {
+	if ledger == nil {
+		return ""
+	}
+	return ledger.Account(player)
+}
+
+// escrowAccount returns the escrow account of round
+func escrowAccount(round string) string {
+	return "escrow:" + round
+}
+
+// escrowTxID returns the id of the escrow transaction of round attached by the player with the account
+func escrowTxID(round, account string) string {
+	return "escrow:" + round + ":" + account
+}
+
+// newTransaction returns new transaction of kind
+func newTransaction(id, kind, round string, postings map[string]int64) *Transaction {
+	return &Transaction{ID: id, Kind: kind, Round: round, Time: nowMilli(), Postings: postings}
+}
+
+// settlement returns the transaction that returns the escrowed postings back to their accounts
+func (tx *Transaction) settlement() *Transaction {
+	s := newTransaction("settle:"+tx.ID, txRefund, tx.Round, map[string]int64{})
+	for account, amount := range tx.Postings {
+		s.Postings[account] = -amount
+	}
+	s.Escrow = tx.ID
+	return s
+}
+
+// escrow moves the stakes of both players of staked round to the escrow account of round when the player attaches
+// the round. It returns the error message when the stakes can't be escrowed.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) escrow(player string) string {
+	if r.Stake == 0 {
+		return ""
+	}
+	account := ledgerAccount(player)
+	tx := newTransaction(escrowTxID(r.ID, account), txEscrow, r.ID, map[string]int64{
+		r.Account1:          -r.Stake,
+		account:             -r.Stake,
+		escrowAccount(r.ID): 2 * r.Stake,
+	})
+	err := ledger.Post(tx)
+	if errors.Is(err, errTxApplied) {
+		// the escrow of the attach that wasn't stored is applied already, but it can be refunded as expired
+		tx, err = appliedEscrow(tx.ID)
+		if errors.Is(err, errEscrowSettled) {
+			return msgStakesExpired
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errInsufficientFunds) {
+			return msgInsufficientFunds
+		}
+		log.Printf("round: %s - escrow error: %v", r.ID, err)
+		return msgLedgerError
+	}
+	r.Account2, r.EscrowExpiry = account, tx.Time+ledger.Expiry().Milliseconds()
+	return ""
+}
+
+// appliedEscrow returns the applied escrow transaction with id. It returns errEscrowSettled when the escrow is settled.
+func appliedEscrow(id string) (*Transaction, error) {
+	_, err := ledger.Transaction("settle:" + id)
+	if err == nil {
+		return nil, errEscrowSettled
+	}
+	if !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	return ledger.Transaction(id)
+}
+
+// stakesExpired reports whether the escrowed stakes of round have expired, so they can be settled as expired
+// already. It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) stakesExpired() bool {
+	return r.EscrowExpiry != 0 && nowMilli() >= r.EscrowExpiry
+}
+
+// PlayerStake returns the stake of round or 0 when the round isn't played for stakes
+func (r *Round) PlayerStake() int64 {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.Stake
+}
+
+// forfeiter returns the player that stalls the round: the rival has placed the bet while the player hasn't, or
+// the rival has disclosed the bet while the player hasn't. It returns nobody when both or none of players have acted.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) forfeiter() int {
+	acted1, acted2 := r.HiddenBet1 != "", r.HiddenBet2 != ""
+	if acted1 && acted2 {
+		acted1, acted2 = r.Bet1 != nothing, r.Bet2 != nothing
+		if r.pairStage() {
+			acted1, acted2 = r.Pairs != nil && r.Pairs.Bet1 != "", r.Pairs != nil && r.Pairs.Bet2 != ""
+		}
+	}
+	switch {
+	case acted1 && !acted2:
+		return second
+	case acted2 && !acted1:
+		return first
+	}
+	return nobody
+}
+
+// stakesSettlement returns the settlement of escrowed stakes of round or nil when the stakes stay escrowed.
+// The finished round is paid out to the winner or refunded on draw, the cancelled round is refunded.
+// The expired round that isn't finished is paid out to the rival of forfeiter or refunded when nobody stalls it,
+// the expired round with invalid signature is refunded.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) stakesSettlement(expired bool) *Transaction {
+	if r.Stake == 0 || r.Account2 == "" {
+		return nil
+	}
+	winner := r.Winner
+	switch {
+	case !r.validSignature():
+		if !expired {
+			return nil
+		}
+		winner = draw
+	case r.state() == StateCancelled:
+		winner = draw
+	case r.state() == StateFinished:
+	case !expired:
+		return nil
+	default:
+		winner = draw
+		switch r.forfeiter() {
+		case first:
+			winner = second
+		case second:
+			winner = first
+		}
+	}
+	escrow := escrowTxID(r.ID, r.Account2)
+	tx := newTransaction("settle:"+escrow, txPayout, r.ID, map[string]int64{escrowAccount(r.ID): -2 * r.Stake})
+	tx.Escrow = escrow
+	switch winner {
+	case first:
+		tx.Postings[r.Account1] = 2 * r.Stake
+	case second:
+		tx.Postings[r.Account2] = 2 * r.Stake
+	default:
+		tx.Kind = txRefund
+		tx.Postings[r.Account1], tx.Postings[r.Account2] = r.Stake, r.Stake
+	}
+	return tx
+}
+
+// postSettlement posts the settlement of escrow. The escrow has the only settlement: it is not an error when
+// the same settlement is applied already (e.g. by the retry), but it is an error when the escrow is settled otherwise.
+func postSettlement(tx *Transaction) error {
+	err := ledger.Post(tx)
+	if !errors.Is(err, errTxApplied) {
+		return err
+	}
+	applied, err := ledger.Transaction(tx.ID)
+	if err != nil {
+		return err
+	}
+	if applied.Kind != tx.Kind || !reflect.DeepEqual(applied.Postings, tx.Postings) {
+		return fmt.Errorf("escrow %s is settled by %s %s already", tx.Escrow, applied.Kind, applied.ID)
+	}
+	return nil
+}
+
+// settleStakes settles the escrowed stakes of finished or cancelled round, the stakes of expired round are settled
+// anyway (see stakesSettlement). The failed settlement is retried by stakeJob.
+func settleStakes(round *Round, expired bool) error {
+	if ledger == nil {
+		return nil
+	}
+	round.mx.Lock()
+	tx := round.stakesSettlement(expired)
+	round.mx.Unlock()
+	if tx == nil {
+		return nil
+	}
+	if err := postSettlement(tx); err != nil {
+		if rErr := ledger.Retry(tx.Escrow); rErr != nil {
+			log.Printf("round: %s - stakes retry error: %v", tx.Round, rErr)
+		}
+		return fmt.Errorf("stakes %s error: %w", tx.Kind, err)
+	}
+	return nil
+}
+
+// refundStakes refunds the escrowed stakes of round. It is used for quarantined rounds.
+func refundStakes(round *Round) {
+	round.mx.Lock()
+	id, stake, account2 := round.ID, round.Stake, round.Account2
+	round.mx.Unlock()
+	if ledger == nil || stake == 0 || account2 == "" {
+		return
+	}
+	if err := refundEscrow(escrowTxID(id, account2)); err != nil {
+		log.Printf("round: %s - stakes refund error: %v", id, err)
+	}
+}
+
+// refundEscrow returns the stakes of escrow transaction to players unless they are already settled
+func refundEscrow(id string) error {
+	tx, err := ledger.Transaction(id)
+	if err != nil {
+		return err
+	}
+	return postSettlement(tx.settlement())
+}
+
+// settleExpired settles the escrow transaction that isn't settled in time by the state of its round.
+// The stakes of quarantined round and the escrow that isn't referred by its round are refunded.
+func settleExpired(id string) error {
+	tx, err := ledger.Transaction(id)
+	if err != nil {
+		return err
+	}
+	round, err := retrieve(tx.Round)
+	if errors.Is(err, errQuarantined) {
+		return postSettlement(tx.settlement())
+	}
+	if err != nil {
+		return err
+	}
+	round.mx.Lock()
+	account2 := round.Account2
+	round.mx.Unlock()
+	if account2 == "" || id != escrowTxID(tx.Round, account2) {
+		// the escrow of the attach that wasn't stored (e.g. the round was attached by another player concurrently)
+		return postSettlement(tx.settlement())
+	}
+	return settleStakes(round, true)
+}
+
+// stakeJob settles the stakes of rounds that are not settled in time until stop is closed
+func stakeJob(stop <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(stakeCheckInterval):
+		case <-stop:
+			return
+		}
+		if ledger == nil {
+			continue
+		}
+		ids, err := ledger.Expired()
+		if err != nil {
+			log.Printf("expired stakes error: %v", err)
+			continue
+		}
+		for _, id := range ids {
+			// the escrow stays expired on error, so it is retried by the next check
+			if err := settleExpired(id); err != nil {
+				log.Printf("%s - expired stakes error: %v", id, err)
+				continue
+			}
+			log.Printf("%s - expired stakes are settled", id)
+		}
+	}
+}
+
+// redisLedger is a Redis implementation of Ledger interface
+type redisLedger struct {
+	r      redis.UniversalClient
+	expiry time.Duration // time to resolve the round after the stakes are escrowed
+	key    string        // persistent key of account ids
+}
+
+// the keys have the same hash tag to be in one slot of Redis cluster
+const (
+	ledgerBalances     = "{ledger}:balances"   // hash of balances by accounts
+	ledgerTransactions = "{ledger}:txs"        // hash of transactions by ids
+	ledgerEscrows      = "{ledger}:escrows"    // sorted set of not settled escrow transactions by expiry time
+	ledgerStatement    = "{ledger}:statement:" // prefix of lists of account transactions
+)
+
+// postScript checks the balances and applies the transaction atomically. It returns 1 when the transaction is
+// applied, 0 when it is already applied and -1 when the balance of player's account would go negative.
+// KEYS: balances, transactions, escrows, statements of the posting accounts;
+// ARGV: transaction id, transaction, escrow to open, escrow expiry, escrow to close, postings as account, amount.
+var postScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then
+	return 0
+end
+for i = 6, #ARGV, 2 do
+	local balance = tonumber(redis.call('HGET', KEYS[1], ARGV[i]) or '0') + tonumber(ARGV[i + 1])
+	if balance < 0 and string.sub(ARGV[i], 1, 1) ~= '@' then
+		return -1
+	end
+end
+for i = 6, #ARGV, 2 do
+	if redis.call('HINCRBY', KEYS[1], ARGV[i], ARGV[i + 1]) == 0 then
+		redis.call('HDEL', KEYS[1], ARGV[i])
+	end
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+for i = 4, #KEYS do
+	redis.call('LPUSH', KEYS[i], ARGV[1])
+	redis.call('LTRIM', KEYS[i], 0, ` + fmt.Sprint(maxStatement-1) + `)
+end
+if ARGV[3] ~= '' then
+	redis.call('ZADD', KEYS[3], ARGV[4], ARGV[3])
+end
+if ARGV[5] ~= '' then
+	redis.call('ZREM', KEYS[3], ARGV[5])
+end
+return 1
+`)
+
+// NewLedger returns a new instance of Ledger interface implementing the storage via Redis.
+// The escrowed stakes are refunded when the round isn't resolved in expiry.
+func NewLedger(opt redis.UniversalOptions, expiry time.Duration) (Ledger, error) {
+	l := &redisLedger{r: redis.NewUniversalClient(&opt), expiry: expiry}
+	// try to ping database
+	if err := l.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	key, err := persistentKey(l.r, ledgerAccountKey)
+	if err != nil {
+		return nil, err
+	}
+	l.key = key
+	return l, nil
+}
+
+// Account returns the account id made with the persistent key, so the player has the same account after
+// the rotation of server keys
+func (l *redisLedger) Account(player string) string {
+	return stableID(l.key, "ledger", player)
+}
+
+// Post applies the transaction by the script
+func (l *redisLedger) Post(tx *Transaction) error {
+	var sum int64
+	keys := []string{ledgerBalances, ledgerTransactions, ledgerEscrows}
+	args := []interface{}{tx.ID, nil, "", 0, tx.Escrow}
+	for account, amount := range tx.Postings {
+		sum += amount
+		keys = append(keys, ledgerStatement+account)
+		args = append(args, account, amount)
+	}
+	if sum != 0 {
+		return errUnbalanced
+	}
+	if tx.Kind == txEscrow {
+		args[2], args[3] = tx.ID, tx.Time+l.expiry.Milliseconds()
+	}
+	args[1], _ = json.Marshal(tx)
+	res, err := postScript.Run(l.r, keys, args...).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case -1:
+		return errInsufficientFunds
+	case 0:
+		return errTxApplied
+	}
+	return nil
+}
+
+// Transaction reads the transaction from the hash of transactions
+func (l *redisLedger) Transaction(id string) (*Transaction, error) {
+	data, err := l.r.HGet(ledgerTransactions, id).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	tx := &Transaction{}
+	if err := json.Unmarshal(data, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Balance reads the balance from the hash of balances, the missed account has zero balance
+func (l *redisLedger) Balance(account string) (int64, error) {
+	balance, err := l.r.HGet(ledgerBalances, account).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return balance, err
+}
+
+// Statement reads the last transaction ids of account and the transactions
+func (l *redisLedger) Statement(account string, limit int) ([]Transaction, error) {
+	ids, err := l.r.LRange(ledgerStatement+account, 0, int64(limit-1)).Result()
+	if err != nil || len(ids) == 0 {
+		return []Transaction{}, err
+	}
+	list, err := l.r.HMGet(ledgerTransactions, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]Transaction, 0, len(list))
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		tx := Transaction{}
+		if err := json.Unmarshal([]byte(s), &tx); err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// Expired returns the escrow transactions with the expiry time in the past
+func (l *redisLedger) Expired() ([]string, error) {
+	return l.r.ZRangeByScore(ledgerEscrows, redis.ZRangeBy{Min: "-inf", Max: fmt.Sprint(nowMilli())}).Result()
+}
+
+// Expiry returns the expiry of escrow transactions
+func (l *redisLedger) Expiry() time.Duration {
+	return l.expiry
+}
+
+// Retry sets the expiry time of escrow transaction to the current time unless it is settled
+func (l *redisLedger) Retry(escrow string) error {
+	return l.r.ZAddXX(ledgerEscrows, redis.Z{Score: float64(nowMilli()), Member: escrow}).Err()
+}
+
+// StatementEntry is the transaction of ledger from the account's perspective
+type StatementEntry struct {
+	ID     string `json:"id"`              // transaction id
+	Kind   string `json:"kind"`            // 'credit'|'escrow'|'payout'|'refund'
+	Round  string `json:"round,omitempty"` // id of round of the stakes
+	Time   int64  `json:"time"`            // server time of transaction (Unix time in milliseconds)
+	Amount int64  `json:"amount"`          // change of the account balance
+}
+
+// LedgerStatement realizes the request for the player's balance and the last transactions
+func LedgerStatement(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		Player string `json:"player"`
+		Limit  int    `json:"limit"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.Player == "" {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if input.Limit <= 0 || input.Limit > maxStatementLimit {
+		input.Limit = defaultStatementLimit
+	}
+
+	account := ledgerAccount(input.Player)
+	balance, err := ledger.Balance(account)
+	if err != nil {
+		storageError(fmt.Errorf("Ledger balance error: %w", err), w)
+		return
+	}
+	txs, err := ledger.Statement(account, input.Limit)
+	if err != nil {
+		storageError(fmt.Errorf("Ledger statement error: %w", err), w)
+		return
+	}
+	entries := make([]StatementEntry, len(txs))
+	for i, tx := range txs {
+		entries[i] = StatementEntry{ID: tx.ID, Kind: tx.Kind, Round: tx.Round, Time: tx.Time, Amount: tx.Postings[account]}
+	}
+	sendResponse(w, struct {
+		Account      string           `json:"account"`
+		Balance      int64            `json:"balance"`
+		Transactions []StatementEntry `json:"transactions"`
+	}{account, balance, entries})
+}
+
+// LedgerCredit realizes the admin request for crediting coins to the player's account
+func LedgerCredit(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		Player string `json:"player"`
+		Amount int64  `json:"amount"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.Player == "" || input.Amount <= 0 {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	account := ledgerAccount(input.Player)
+	tx := newTransaction(uuid.NewString(), txCredit, "", map[string]int64{mintAccount: -input.Amount, account: input.Amount})
+	if err := ledger.Post(tx); err != nil {
+		storageError(fmt.Errorf("Ledger credit error: %w", err), w)
+		return
+	}
+	balance, err := ledger.Balance(account)
+	if err != nil {
+		storageError(fmt.Errorf("Ledger balance error: %w", err), w)
+		return
+	}
+	sendResponse(w, struct {
+		Transaction string `json:"transaction"`
+		Account     string `json:"account"`
+		Balance     int64  `json:"balance"`
+	}{tx.ID, account, balance})
+	log.Printf("ledger: %d coins are credited to %s", input.Amount, account)
+}
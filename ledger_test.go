@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_LedgerStore(t *testing.T) {
+	_, err := NewLedger(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}}, time.Hour)
+	require.Error(t, err)
+
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+	l, err := NewLedger(redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}, time.Hour)
+	require.NoError(t, err)
+
+	account := uuid.NewString()
+	require.ErrorIs(t, l.Post(newTransaction(uuid.NewString(), txCredit, "", map[string]int64{account: 100})),
+		errUnbalanced)
+	credit := newTransaction(uuid.NewString(), txCredit, "", map[string]int64{mintAccount: -100, account: 100})
+	require.NoError(t, l.Post(credit))
+	require.ErrorIs(t, l.Post(credit), errTxApplied) // the retry is not applied
+	balance, err := l.Balance(account)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), balance)
+
+	// the concurrent debits never make the balance negative
+	var done int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := l.Post(newTransaction(uuid.NewString(), txEscrow, "r1", map[string]int64{account: -10, "@sink": 10}))
+			if err == nil {
+				atomic.AddInt32(&done, 1)
+			} else {
+				require.ErrorIs(t, err, errInsufficientFunds)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(10), done)
+	balance, err = l.Balance(account)
+	require.NoError(t, err)
+	require.Zero(t, balance)
+
+	txs, err := l.Statement(account, 20)
+	require.NoError(t, err)
+	require.Len(t, txs, 11)
+	require.Equal(t, credit.ID, txs[10].ID)
+	require.Equal(t, int64(-10), txs[0].Postings[account])
+	txs, err = l.Statement(uuid.NewString(), 20)
+	require.NoError(t, err)
+	require.Empty(t, txs)
+
+	// the escrow is expired when it is not settled in time
+	l.(*redisLedger).expiry = -time.Second
+	escrow := newTransaction(uuid.NewString(), txEscrow, "r2", map[string]int64{mintAccount: -5, escrowAccount("r2"): 5})
+	require.NoError(t, l.Post(escrow))
+	ids, err := l.Expired()
+	require.NoError(t, err)
+	require.Contains(t, ids, escrow.ID)
+	require.NoError(t, l.Post(escrow.settlement()))
+	ids, err = l.Expired()
+	require.NoError(t, err)
+	require.NotContains(t, ids, escrow.ID)
+	// the settled escrow isn't retried
+	require.NoError(t, l.Retry(escrow.ID))
+	ids, err = l.Expired()
+	require.NoError(t, err)
+	require.NotContains(t, ids, escrow.ID)
+
+	// the escrow is expired at once for the retry of settlement
+	l.(*redisLedger).expiry = time.Hour
+	escrow = newTransaction(uuid.NewString(), txEscrow, "r3", map[string]int64{mintAccount: -5, escrowAccount("r3"): 5})
+	require.NoError(t, l.Post(escrow))
+	ids, err = l.Expired()
+	require.NoError(t, err)
+	require.NotContains(t, ids, escrow.ID)
+	require.NoError(t, l.Retry(escrow.ID))
+	ids, err = l.Expired()
+	require.NoError(t, err)
+	require.Contains(t, ids, escrow.ID)
+	require.NoError(t, l.Post(escrow.settlement()))
+
+	// the account id doesn't depend on the server keys
+	l2, err := NewLedger(redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, l.Account("player1"), l2.Account("player1"))
+	require.NotEqual(t, l.Account("player1"), l.Account("player2"))
+}
+
+// failingLedger fails to post the payouts
+type failingLedger struct {
+	Ledger
+}
+
+func (l failingLedger) Post(tx *Transaction) error {
+	if tx.Kind == txPayout {
+		return errors.New("payout failed")
+	}
+	return l.Ledger.Post(tx)
+}
+
+func Test2_Stakes(t *testing.T) {
+	ledger = nil // the ledger is set by the service
+	_, err := NewRoundWithOptions("player1", RoundOptions{Stake: 10})
+	require.EqualError(t, err, "stakes are not supported")
+
+	envSet(t) // load .env file for test environment
+	defer func() { ledger = nil }()
+	defer stopService(startService(t))
+
+	credit := func(player string, amount int64) {
+		data, _ := json.Marshal(map[string]interface{}{"player": player, "amount": amount})
+		req := httptest.NewRequest("POST", "/admin/ledger/credit", bytes.NewReader(data))
+		w := httptest.NewRecorder()
+		LedgerCredit(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	balance := func(player string) int64 {
+		data, err := request("ledger/statement", []byte(fmt.Sprintf(`{"player":%q}`, player)))
+		require.NoError(t, err)
+		res := struct {
+			Balance int64 `json:"balance"`
+		}{}
+		require.NoError(t, json.Unmarshal(data, &res))
+		return res.Balance
+	}
+	player1, player2, player3 := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	credit(player1, 100)
+	credit(player2, 15)
+
+	for body, msg := range map[string]string{
+		`{"player":%q,"stake":-1}`:                         "stake can't be negative",
+		`{"player":%q,"stake":10,"opponent":"bot:random"}`: "bots don't play for stakes",
+		`{"player":%q,"stake":200}`:                        msgInsufficientFunds,
+	} {
+		data, err := request("new", []byte(fmt.Sprintf(body, player1)))
+		require.NoError(t, err)
+		require.Contains(t, string(data), msg)
+	}
+
+	newRound := func() string {
+		data, err := request("new", []byte(fmt.Sprintf(`{"player":%q,"stake":10}`, player1)))
+		require.NoError(t, err)
+		created := struct {
+			Round string `json:"round"`
+		}{}
+		require.NoError(t, json.Unmarshal(data, &created))
+		return created.Round
+	}
+	play := func(round, bet1, bet2 string) string {
+		for player, bet := range map[string]string{player1: bet1, player2: bet2} {
+			_, err := request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`, round, player,
+				saltedHash(player, bet))))
+			require.NoError(t, err)
+		}
+		_, err := request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"secret":%q,"bet":%q}`,
+			round, player1, player1, bet1)))
+		require.NoError(t, err)
+		data, err := request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"secret":%q,"bet":%q}`,
+			round, player2, player2, bet2)))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// the player without coins can't fill the round
+	round := newRound()
+	data, err := request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player3)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"insufficient funds for the stake"}`, string(data))
+
+	// the stakes are escrowed by attach and paid out to the winner
+	data, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `{"response":"place Your bet, please","pseudonym":"`)
+	require.Equal(t, int64(90), balance(player1))
+	require.Equal(t, int64(5), balance(player2))
+	require.Contains(t, play(round, "stone", "paper"), "You won")
+	require.Equal(t, int64(90), balance(player1))
+	require.Equal(t, int64(25), balance(player2))
+
+	// the stakes are refunded on draw
+	round = newRound()
+	_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	require.Equal(t, int64(80), balance(player1))
+	require.Contains(t, play(round, "paper", "paper"), "draw")
+	require.Equal(t, int64(90), balance(player1))
+	require.Equal(t, int64(25), balance(player2))
+	data, err = request("result", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player1)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"stake":10`)
+
+	bet := func(round, player, bet string) {
+		_, err := request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`, round, player,
+			saltedHash(player, bet))))
+		require.NoError(t, err)
+	}
+	cancel := func(round, player string) string {
+		data, err := request("cancel", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player)))
+		require.NoError(t, err)
+		return string(data)
+	}
+	escrow := func(round string) string {
+		r, err := db.Retrieve(round)
+		require.NoError(t, err)
+		return escrowTxID(round, r.Account2)
+	}
+
+	// the expired round is forfeited by the player that hasn't placed the bet
+	round = newRound()
+	_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	require.Equal(t, int64(15), balance(player2))
+	bet(round, player1, "stone")
+	defer func(prev func() time.Time) { now = prev }(now)
+	now = func() time.Time { return time.Now().Add(ledger.Expiry()) }
+	require.NoError(t, settleExpired(escrow(round)))
+	require.Equal(t, int64(100), balance(player1))
+	require.Equal(t, int64(15), balance(player2))
+	// the bets are rejected after the escrow expiry
+	data, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`, round, player2,
+		saltedHash(player2, "paper"))))
+	require.NoError(t, err)
+	require.Contains(t, string(data), msgStakesExpired)
+	now = time.Now
+	// the escrow is settled once
+	require.Contains(t, play(round, "stone", "paper"), "You won")
+	require.Equal(t, int64(100), balance(player1))
+	require.Equal(t, int64(15), balance(player2))
+
+	// the discloses are rejected after the escrow expiry
+	round = newRound()
+	_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	bet(round, player1, "stone")
+	bet(round, player2, "paper")
+	now = func() time.Time { return time.Now().Add(ledger.Expiry()) }
+	data, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"secret":%q,"bet":"paper"}`,
+		round, player2, player2)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), msgStakesExpired)
+	now = time.Now
+	require.NoError(t, settleExpired(escrow(round)))
+	require.Equal(t, int64(100), balance(player1))
+	require.Equal(t, int64(15), balance(player2))
+
+	// the escrow of the attach that wasn't stored is refunded
+	credit(player3, 10)
+	orphan := func(round string) string {
+		account := ledgerAccount(player3)
+		tx := newTransaction(escrowTxID(round, account), txEscrow, round, map[string]int64{
+			ledgerAccount(player1): -10, account: -10, escrowAccount(round): 20})
+		require.NoError(t, ledger.Post(tx))
+		return tx.ID
+	}
+	round = newRound()
+	id := orphan(round)
+	require.Equal(t, int64(90), balance(player1))
+	require.Equal(t, int64(0), balance(player3))
+	require.NoError(t, settleExpired(id))
+	require.Equal(t, int64(100), balance(player1))
+	require.Equal(t, int64(10), balance(player3))
+	// the refunded escrow isn't reused by the following attach
+	data, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player3)))
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf(`{"response":%q}`, msgStakesExpired), string(data))
+	require.Equal(t, int64(100), balance(player1))
+	// the escrow of another player is refunded when the round is attached
+	round = newRound()
+	id = orphan(round)
+	_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	require.Equal(t, int64(80), balance(player1))
+	require.NoError(t, settleExpired(id))
+	require.Equal(t, int64(90), balance(player1))
+	require.Equal(t, int64(10), balance(player3))
+	require.Contains(t, play(round, "paper", "paper"), "draw")
+	require.Equal(t, int64(100), balance(player1))
+	require.Equal(t, int64(15), balance(player2))
+
+	// the failed payout is retried by the check of expired stakes
+	round = newRound()
+	_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	ledger = failingLedger{ledger}
+	require.Contains(t, play(round, "stone", "scissors"), "You lose")
+	ledger = ledger.(failingLedger).Ledger
+	require.Equal(t, int64(90), balance(player1))
+	ids, err := ledger.Expired()
+	require.NoError(t, err)
+	require.Contains(t, ids, escrow(round))
+	require.NoError(t, settleExpired(escrow(round)))
+	require.Equal(t, int64(110), balance(player1))
+	require.Equal(t, int64(5), balance(player2))
+
+	// the stakes are refunded on cancel of round without bets
+	credit(player2, 10)
+	round = newRound()
+	_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	require.Equal(t, int64(100), balance(player1))
+	require.Equal(t, int64(5), balance(player2))
+	require.Equal(t, `{"response":"the round is cancelled"}`, cancel(round, player2))
+	require.Equal(t, int64(110), balance(player1))
+	require.Equal(t, int64(15), balance(player2))
+	require.Equal(t, `{"response":"the round is cancelled"}`, cancel(round, player1))
+	require.Equal(t, int64(15), balance(player2))
+	data, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`, round, player1,
+		saltedHash(player1, "stone"))))
+	require.NoError(t, err)
+	require.Contains(t, string(data), msgCancelled)
+	require.Equal(t, `{"response":"unauthorized"}`, cancel(round, player3))
+
+	data, err = request("ledger/statement", []byte(fmt.Sprintf(`{"player":%q,"limit":2}`, player2)))
+	require.NoError(t, err)
+	statement := struct {
+		Transactions []StatementEntry `json:"transactions"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &statement))
+	require.Len(t, statement.Transactions, 2)
+	require.Equal(t, txRefund, statement.Transactions[0].Kind)
+	require.Equal(t, int64(10), statement.Transactions[0].Amount)
+	require.Equal(t, txEscrow, statement.Transactions[1].Kind)
+	require.Equal(t, int64(-10), statement.Transactions[1].Amount)
+
+	// the open round can be cancelled, the round with bets can't
+	round = newRound()
+	require.Equal(t, `{"response":"the round is cancelled"}`, cancel(round, player1))
+	data, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"the round is cancelled"}`, string(data))
+	round = newRound()
+	_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":%q}`, round, player2)))
+	require.NoError(t, err)
+	bet(round, player2, "paper")
+	require.Equal(t, fmt.Sprintf(`{"response":%q}`, msgCantCancel), cancel(round, player1))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// "Minus one" is the two-stage variant of stone scissors paper. At the first stage each player commits and
+// discloses two gestures (the bet is two gestures separated by comma, e.g. `stone,paper`). At the second stage
+// each player commits and discloses the gesture to withdraw. The remaining gestures are resolved by the normal rules.
+
+// Pairs is the first stage of "minus one" round: the commitments and disclosures of the pairs of gestures
+type Pairs struct {
+	HiddenBet1 string `json:"hiddenbet1,omitempty"` // hidden pair of player1
+	HiddenBet2 string `json:"hiddenbet2,omitempty"` // hidden pair of player2
+	Bet1       string `json:"bet1,omitempty"`       // disclosed pair of player1
+	Bet2       string `json:"bet2,omitempty"`       // disclosed pair of player2
+	Secret1    string `json:"secret1,omitempty"`    // secret of pair of player1
+	Secret2    string `json:"secret2,omitempty"`    // secret of pair of player2
+}
+
+// parsePair returns the pair of gestures of stone scissors paper by the bet like `stone,paper`
+func parsePair(bet string) ([2]Gesture, error) {
+	pair := [2]Gesture{}
+	names := strings.Split(bet, ",")
+	if len(names) != 2 {
+		return pair, fmt.Errorf("pair of gestures expected: %q", bet)
+	}
+	for i, name := range names {
+		g, err := parseMove(games[gameRPS], strings.TrimSpace(name))
+		if err != nil {
+			return pair, err
+		}
+		pair[i] = g
+	}
+	return pair, nil
+}
+
+// remaining returns the gesture of pair that remains after withdrawal
+func remaining(pair [2]Gesture, withdrawn Gesture) Gesture {
+	if pair[0] == withdrawn {
+		return pair[1]
+	}
+	return pair[0]
+}
+
+// minusOneMoves returns the remaining gestures by the disclosed pairs and withdrawn gestures
+func minusOneMoves(pair1, pair2 string, withdrawn1, withdrawn2 Gesture) (Gesture, Gesture, error) {
+	p1, err := parsePair(pair1)
+	if err != nil {
+		return nothing, nothing, err
+	}
+	p2, err := parsePair(pair2)
+	if err != nil {
+		return nothing, nothing, err
+	}
+	return remaining(p1, withdrawn1), remaining(p2, withdrawn2), nil
+}
+
+// pairStage reports whether the "minus one" round waits for the pairs.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) pairStage() bool {
+	return r.Game == gameMinusOne && (r.Pairs == nil || r.Pairs.Bet1 == "" || r.Pairs.Bet2 == "")
+}
+
+// pair returns the disclosed pair of player (hash of token).
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) pair(shPlayer string) [2]Gesture {
+	bet := r.Pairs.Bet2
+	if shPlayer == r.Player1 {
+		bet = r.Pairs.Bet1
+	}
+	pair, _ := parsePair(bet)
+	return pair
+}
+
+// checkBet checks that the open bet can be disclosed at the current stage of round
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) checkBet(bet string) error {
+	if r.pairStage() {
+		_, err := parsePair(bet)
+		return err
+	}
+	_, err := parseMove(r.game(), bet)
+	return err
+}
+
+// disclosePair checks the pair by the hidden bet and stores it. When both pairs are disclosed the round moves
+// to the withdrawal stage: the hidden bets are cleared for the commitments of withdrawn gestures.
+// It returns the error message when bet is incorrect.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) disclosePair(secret, bet, shPlayer string) string {
+	if _, err := parsePair(bet); err != nil {
+		return "unknown bet"
+	}
+
+	if shPlayer == r.Player1 && !r.commitmentMatches(r.HiddenBet1, secret, bet, shPlayer) ||
+		shPlayer == r.Player2 && !r.commitmentMatches(r.HiddenBet2, secret, bet, shPlayer) {
+		return "Your bet is incorrect"
+	}
+
+	if r.Pairs == nil {
+		r.Pairs = &Pairs{}
+	}
+	open := func() {
+		if shPlayer == r.Player1 {
+			r.Pairs.Bet1 = bet
+			r.Pairs.Secret1 = secret
+			r.Sealed1 = ""
+			r.timeline().Disclose1 = nowMilli()
+		} else {
+			r.Pairs.Bet2 = bet
+			r.Pairs.Secret2 = secret
+			r.Sealed2 = ""
+			r.timeline().Disclose2 = nowMilli()
+		}
+	}
+
+	if shPlayer == r.Player1 && r.Pairs.Bet2 != "" || shPlayer == r.Player2 && r.Pairs.Bet1 != "" {
+		// the last disclosure of pair: start the withdrawal stage
+		err := r.transition(StateWithdrawing, func() {
+			open()
+			r.Pairs.HiddenBet1, r.Pairs.HiddenBet2 = r.HiddenBet1, r.HiddenBet2
+			r.HiddenBet1, r.HiddenBet2 = "", ""
+			r.Sealed1, r.Sealed2 = "", ""
+			r.Mode1, r.Mode2 = "", ""
+		})
+		if err != nil {
+			log.Println(err)
+			return "round can't be continued"
+		}
+	} else {
+		open()
+	}
+	// recalculate signature
+	r.reSing()
+	return ""
+}
+
+// pairResult describes the disclosing of pairs of "minus one" round for player.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) pairResult(shPlayer string) string {
+	if r.Pairs == nil || shPlayer == r.Player1 && r.Pairs.Bet1 == "" || shPlayer == r.Player2 && r.Pairs.Bet2 == "" {
+		return "disclose your bet, please"
+	}
+	return "wait for your rival to disclose its bet"
+}
+
+// withdrawalResult describes the withdrawal stage of "minus one" round for player.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) withdrawalResult(shPlayer, shRival, hiddenBet, rHiddenBet string, bet, rBet Gesture, cPlayer int) string {
+	pair, rPair := r.pair(shPlayer), r.pair(shRival)
+	switch {
+	case hiddenBet == "":
+		return fmt.Sprintf("withdraw one of your hands, please: your hands: %s and %s, the rival's hands: %s and %s",
+			pair[0], pair[1], rPair[0], rPair[1])
+	case rHiddenBet == "":
+		return "wait for the rival to withdraw its hand"
+	case bet == nothing:
+		return "disclose your withdrawn hand, please"
+	case rBet == nothing:
+		return "wait for your rival to disclose its withdrawn hand"
+	}
+	return fmt.Sprintf("%s: your hand: %s, the rival's hand: %s",
+		r.outcome(cPlayer), remaining(pair, bet), remaining(rPair, rBet))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_MinusOne(t *testing.T) {
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "k1")
+
+	tr, err := NewGameRound("player1", gameMinusOne)
+	require.NoError(t, err)
+	tr.Attach("player2")
+
+	// the first stage: pairs
+	tr.Bet(tr.saltedHash("s1", []byte("stone,paper")), "player1")
+	require.Equal(t, "disclose your bet, please", tr.Bet(commitmentV2("sha256", tr.ID, tr.Pseudonym("player2"), "scissors,Paper", "s2"), "player2"))
+	require.Equal(t, "unknown bet", tr.Disclose("s1", "stone", "player1"))
+	require.Equal(t, "unknown bet", tr.Disclose("s1", "stone,heads", "player1"))
+	require.Equal(t, "Your bet is incorrect", tr.Disclose("s1", "stone,scissors", "player1"))
+	require.Equal(t, "wait for your rival to disclose its bet", tr.Disclose("s1", "stone,paper", "player1"))
+	require.Equal(t, "withdraw one of your hands, please: your hands: scissors and paper, the rival's hands: stone and paper",
+		tr.Disclose("s2", "scissors,Paper", "player2"))
+	require.Equal(t, StateWithdrawing, tr.State)
+	require.Equal(t, &Pairs{
+		HiddenBet1: tr.saltedHash("s1", []byte("stone,paper")),
+		HiddenBet2: commitmentV2("sha256", tr.ID, tr.Pseudonym("player2"), "scissors,Paper", "s2"),
+		Bet1:       "stone,paper",
+		Bet2:       "scissors,Paper",
+		Secret1:    "s1",
+		Secret2:    "s2",
+	}, tr.Pairs)
+
+	// the second stage: withdrawals
+	require.Equal(t, "wait for the rival to withdraw its hand", tr.Bet(tr.saltedHash("w1", []byte("stone")), "player1"))
+	require.Equal(t, "disclose your withdrawn hand, please", tr.Bet(tr.saltedHash("w2", []byte("scissors")), "player2"))
+	require.Equal(t, "withdraw one of your hands", tr.Disclose("w2", "stone", "player2"))
+	require.Equal(t, "wait for your rival to disclose its withdrawn hand", tr.Disclose("w1", "stone", "player1"))
+	require.Equal(t, "draw: your hand: paper, the rival's hand: paper", tr.Disclose("w2", "scissors", "player2"))
+	require.Equal(t, draw, tr.Winner)
+
+	transcript, res := tr.Transcript()
+	require.Empty(t, res)
+	data, _ := json.Marshal(SignTranscript(transcript))
+	verified, err := VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.NoError(t, err)
+	require.Equal(t, transcript, verified)
+
+	// the remaining hands don't match the winner
+	transcript.Pairs.Bet1 = "stone,scissors"
+	transcript.Pairs.HiddenBet1 = tr.saltedHash("s1", []byte("stone,scissors"))
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.Error(t, err)
+	transcript.Pairs = nil
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.Error(t, err)
+}
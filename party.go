@@ -0,0 +1,559 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// Party is a free-for-all round of stone scissors paper for 3-10 players. Everybody commits the hidden bet
+// and discloses it as in the two-player Round. The party is resolved by the resolution rule:
+// 'elimination' - the losers are eliminated and the rest replay till one player remains,
+// 'points' - every player scores one point per beaten opponent.
+type Party struct {
+	mx         sync.Mutex    // guard for async updates
+	ID         string        `json:"id"`                  // party id
+	Size       int           `json:"size"`                // number of players
+	Resolution string        `json:"resolution"`          // resolution rule
+	Players    []PartyPlayer `json:"players"`             // attached players in order of attaching
+	Stage      int           `json:"stage"`               // number of replay in the elimination party (from 1)
+	State      State         `json:"state"`               // party state
+	Last       string        `json:"last,omitempty"`      // outcome of the last resolved stage
+	Signature  string        `json:"signature"`           // party signature (calculated without itself)
+	KeyID      string        `json:"keyid,omitempty"`     // id of server key used for the signature
+	HashKeyID  string        `json:"hashkeyid,omitempty"` // id of server key used for the players' hashes
+}
+
+// Seat is the commit-reveal state of player in the rounds of more than two players (parties and team rounds).
+// The two-player Round keeps this state in its own fields that are bound by its signature, events and
+// transcripts, so they are not generalized to the list of players.
+type Seat struct {
+	Player    string  `json:"player"`              // hash of player's token
+	HiddenBet string  `json:"hiddenbet,omitempty"` // hidden bet
+	Bet       Gesture `json:"bet,omitempty"`       // open bet
+	Secret    string  `json:"secret,omitempty"`    // disclosed secret
+}
+
+// disclose checks the bet by the hidden one made in the round id and opens it. It returns the error message
+// when the bet can't be opened.
+func (s *Seat) disclose(id, secret, bet string) string {
+	gesture, err := parseMove(games[gameRPS], bet)
+	if err != nil {
+		return "unknown bet"
+	}
+	if !matchCommitment(id, s.HiddenBet, secret, bet, s.Player) {
+		return "Your bet is incorrect"
+	}
+	s.Bet = gesture
+	s.Secret = secret
+	return ""
+}
+
+// PartyPlayer is the player of party, the seat keeps the bet in the current stage
+type PartyPlayer struct {
+	Seat
+	Out    int `json:"out,omitempty"`    // the stage when the player was eliminated
+	Points int `json:"points,omitempty"` // scored points
+}
+
+const (
+	// party resolution rules
+	resolutionElimination = "elimination"
+	resolutionPoints      = "points"
+
+	minPartySize = 3
+	maxPartySize = 10
+)
+
+// NewParty returns new open Party of size players started by player
+func NewParty(player string, size int, resolution string) (*Party, error) {
+	if size < minPartySize || size > maxPartySize {
+		return nil, fmt.Errorf("party size has to be from %d to %d", minPartySize, maxPartySize)
+	}
+	if resolution == "" {
+		resolution = resolutionElimination
+	}
+	if resolution != resolutionElimination && resolution != resolutionPoints {
+		return nil, fmt.Errorf("unknown resolution: %q", resolution)
+	}
+	p := &Party{
+		ID:         uuid.NewString(),
+		Size:       size,
+		Resolution: resolution,
+		Stage:      1,
+		State:      StateOpen,
+		HashKeyID:  ring.active,
+	}
+	p.Players = []PartyPlayer{{Seat: Seat{Player: p.hash(player)}}}
+	p.signing().reSign()
+	return p, nil
+}
+
+// partyTransitions are the allowed transitions between party states, the elimination party returns to betting
+// for the next stage
+var partyTransitions = map[State][]State{
+	StateOpen:       {StateBetting},
+	StateBetting:    {StateDisclosing},
+	StateDisclosing: {StateFinished, StateBetting},
+}
+
+// transition applies the change of party data and moves the party to the state to. Nothing is changed when
+// the transition is not allowed: it returns the error in this case.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (p *Party) transition(to State, change func()) error {
+	if !allowed(partyTransitions, p.State, to) {
+		return fmt.Errorf("party %s: transition from %s to %s is not allowed", p.ID, p.State, to)
+	}
+	change()
+	p.State = to
+	return nil
+}
+
+// hash returns the salted hash of obj made with the server key of players' hashes
+func (p *Party) hash(obj interface{}) string {
+	return keyHash(p.HashKeyID, p.ID, obj)
+}
+
+// signing returns the signature of party
+func (p *Party) signing() signing {
+	return signing{id: p.ID, obj: p, keyID: &p.KeyID, hashKeyID: p.HashKeyID, signature: &p.Signature}
+}
+
+// player returns the index of player in the party or -1 when the player is not attached.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (p *Party) player(player string) int {
+	h := p.hash(player)
+	for i, pp := range p.Players {
+		if h != "" && pp.Player == h {
+			return i
+		}
+	}
+	return -1
+}
+
+// check returns the index of player or the error message when the party can't be played by player
+func (p *Party) check(player string) (int, string) {
+	if res := p.signing().err(); res != "" {
+		return -1, res
+	}
+	i := p.player(player)
+	if i < 0 {
+		return -1, msgUnauthorized
+	}
+	return i, ""
+}
+
+// Join attaches the player to the party
+func (p *Party) Join(player string) string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if res := p.signing().err(); res != "" {
+		return res
+	}
+	if p.player(player) >= 0 {
+		return "You have already joined this party"
+	}
+	if p.State != StateOpen {
+		return "this party is already full"
+	}
+	join := func() { p.Players = append(p.Players, PartyPlayer{Seat: Seat{Player: p.hash(player)}}) }
+	if len(p.Players)+1 < p.Size {
+		join()
+	} else if err := p.transition(StateBetting, join); err != nil {
+		log.Println(err)
+		return "this party is already full"
+	}
+	p.signing().reSign()
+	return p.result(len(p.Players) - 1)
+}
+
+// Bet makes the player's hidden bet in the current stage
+func (p *Party) Bet(hiddenBet, player string) string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	i, res := p.check(player)
+	if res != "" {
+		return res
+	}
+	if !validCommitment(hiddenBet) {
+		return "unsupported commitment format"
+	}
+	if p.State != StateBetting || p.Players[i].Out > 0 || p.Players[i].HiddenBet != "" {
+		return p.result(i)
+	}
+	place := func() { p.Players[i].HiddenBet = hiddenBet }
+	if p.all(func(pp *PartyPlayer) bool { return pp == &p.Players[i] || pp.HiddenBet != "" }) {
+		// the last hidden bet
+		if err := p.transition(StateDisclosing, place); err != nil {
+			log.Println(err)
+			return p.result(i)
+		}
+	} else {
+		place()
+	}
+	p.signing().reSign()
+	return p.result(i)
+}
+
+// Disclose discloses the player's bet in the current stage
+func (p *Party) Disclose(secret, bet, player string) string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	i, res := p.check(player)
+	if res != "" {
+		return res
+	}
+	if p.State != StateDisclosing || p.Players[i].Out > 0 || p.Players[i].Bet != nothing {
+		return p.result(i)
+	}
+	if res := p.Players[i].disclose(p.ID, secret, bet); res != "" {
+		return res
+	}
+	if p.all(func(pp *PartyPlayer) bool { return pp.Bet != nothing }) {
+		if err := p.resolve(); err != nil {
+			log.Println(err)
+		}
+	}
+	p.signing().reSign()
+	return p.result(i)
+}
+
+// Result returns the party result for player
+func (p *Party) Result(player string) string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	i, res := p.check(player)
+	if res != "" {
+		return res
+	}
+	return p.result(i)
+}
+
+// Pseudonym returns the player's pseudonym that binds the v2 commitments, it is empty when the player is not attached
+func (p *Party) Pseudonym(player string) string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if i := p.player(player); i >= 0 {
+		return p.Players[i].Player
+	}
+	return ""
+}
+
+// Standing is the public state of party player
+type Standing struct {
+	You    bool   `json:"you"`              // the requester
+	Bet    string `json:"bet,omitempty"`    // open bet in the last stage (when the party is finished)
+	Out    int    `json:"out,omitempty"`    // the stage when the player was eliminated
+	Points int    `json:"points,omitempty"` // scored points
+}
+
+// Standings returns the states of party players in order of attaching. It returns nil when the player
+// can't get them.
+func (p *Party) Standings(player string) []Standing {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	i, res := p.check(player)
+	if res != "" {
+		return nil
+	}
+	st := make([]Standing, len(p.Players))
+	for j, pp := range p.Players {
+		st[j] = Standing{You: i == j, Out: pp.Out, Points: pp.Points}
+		if p.State == StateFinished {
+			st[j].Bet = pp.Bet.String()
+		}
+	}
+	return st
+}
+
+// all checks that the condition is true for all active players.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (p *Party) all(cond func(pp *PartyPlayer) bool) bool {
+	for i := range p.Players {
+		if p.Players[i].Out == 0 && !cond(&p.Players[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve makes the outcome of stage when all bets are disclosed.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (p *Party) resolve() error {
+	shown := map[Gesture]bool{}
+	for _, pp := range p.Players {
+		if pp.Out == 0 {
+			shown[pp.Bet] = true
+		}
+	}
+	if p.Resolution == resolutionPoints {
+		return p.transition(StateFinished, func() {
+			for i := range p.Players {
+				for j := range p.Players {
+					if rules[p.Players[i].Bet][p.Players[j].Bet] == first {
+						p.Players[i].Points++
+					}
+				}
+			}
+		})
+	}
+	if len(shown) != 2 {
+		// all bets are the same or all gestures are shown: nobody is beaten
+		return p.replay(fmt.Sprintf("stage %d: draw", p.Stage), nothing)
+	}
+	var win Gesture
+	for g := range shown {
+		for l := range shown {
+			if rules[g][l] == first {
+				win = g
+			}
+		}
+	}
+	active := 0
+	for _, pp := range p.Players {
+		if pp.Out == 0 && pp.Bet == win {
+			active++
+		}
+	}
+	last := fmt.Sprintf("stage %d: %s won", p.Stage, win)
+	if active > 1 {
+		return p.replay(last, win)
+	}
+	return p.transition(StateFinished, func() {
+		p.eliminate(win)
+		p.Last = last
+	})
+}
+
+// eliminate marks the active players that didn't show the winning gesture win as eliminated at the current stage.
+// Nobody is eliminated when win is nothing.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (p *Party) eliminate(win Gesture) {
+	for i := range p.Players {
+		if p.Players[i].Out == 0 && win != nothing && p.Players[i].Bet != win {
+			p.Players[i].Out = p.Stage
+		}
+	}
+}
+
+// replay starts the next stage for active players with the outcome last of the resolved stage. The players
+// that didn't show the winning gesture win are eliminated before.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (p *Party) replay(last string, win Gesture) error {
+	return p.transition(StateBetting, func() {
+		p.eliminate(win)
+		p.Last = last
+		p.Stage++
+		for i := range p.Players {
+			if p.Players[i].Out == 0 {
+				p.Players[i].Seat = Seat{Player: p.Players[i].Player}
+			}
+		}
+	})
+}
+
+// result describes the party state for the player with index i.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (p *Party) result(i int) string {
+	me := p.Players[i]
+	prefix := ""
+	if p.Last != "" {
+		prefix = p.Last + "; "
+	}
+	switch {
+	case p.State == StateOpen:
+		return fmt.Sprintf("wait for other players to join (%d of %d)", len(p.Players), p.Size)
+	case p.State == StateFinished && p.Resolution == resolutionPoints:
+		place := 1
+		for _, pp := range p.Players {
+			if pp.Points > me.Points {
+				place++
+			}
+		}
+		return fmt.Sprintf("You scored %d points: place %d of %d, your bet: %s", me.Points, place, len(p.Players), me.Bet)
+	case p.State == StateFinished && me.Out == 0:
+		return prefix + "You won the party"
+	case me.Out > 0:
+		return fmt.Sprintf("%sYou lose: eliminated at stage %d", prefix, me.Out)
+	case p.State == StateBetting && me.HiddenBet == "":
+		return prefix + "place Your bet, please"
+	case p.State == StateBetting:
+		return prefix + "wait for other players to place their bets"
+	case me.Bet == nothing:
+		return prefix + "disclose your bet, please"
+	default:
+		return prefix + "wait for other players to disclose their bets"
+	}
+}
+
+// PartyStore is an interface of the persistence layer of parties
+type PartyStore interface {
+	StoreParty(*Party) error
+	RetrieveParty(id string) (*Party, error)
+	// UpdateParty retrieves the party, makes the move and stores the changed party when it is not changed
+	// concurrently, otherwise the move is repeated for the new party. The party is not stored when the move
+	// reports the falsification or the unknown server key.
+	UpdateParty(id string, move func(p *Party) string) (*Party, string, error)
+}
+
+// parties is the storage of parties
+var parties PartyStore
+
+// redisParties is a Redis implementation of PartyStore interface
+type redisParties struct {
+	r redis.UniversalClient
+}
+
+// NewPartyStore returns a new instance of PartyStore interface implementing the persistence layer via Redis
+func NewPartyStore(opt redis.UniversalOptions) (PartyStore, error) {
+	s := &redisParties{redis.NewUniversalClient(&opt)}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StoreParty stores the party
+func (s *redisParties) StoreParty(p *Party) error {
+	p.mx.Lock()
+	data, _ := json.Marshal(p)
+	p.mx.Unlock()
+	return s.r.Set("party:"+p.ID, data, time.Hour*8760).Err()
+}
+
+// RetrieveParty reads the party
+func (s *redisParties) RetrieveParty(id string) (*Party, error) {
+	data, err := s.r.Get("party:" + id).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	p := &Party{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdateParty makes the move of party with the compare-and-set of the stored party
+func (s *redisParties) UpdateParty(id string, move func(p *Party) string) (p *Party, res string, err error) {
+	err = casUpdate(s.r, "party:"+id, time.Hour*8760, func(data []byte) ([]byte, error) {
+		p = &Party{}
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, err
+		}
+		res = move(p)
+		if res == msgFalsificated || res == msgUnknownKey {
+			return nil, nil
+		}
+		p.mx.Lock()
+		defer p.mx.Unlock()
+		return json.Marshal(p)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return p, res, nil
+}
+
+// playParty retrieves the party and makes the move. The changed party is stored when store is true.
+func playParty(id string, store bool, move func(p *Party) string) (*Party, string, error) {
+	if store {
+		p, res, err := parties.UpdateParty(id, move)
+		if err != nil {
+			return nil, "", fmt.Errorf("Party update error: %w", err)
+		}
+		return p, res, nil
+	}
+	p, err := parties.RetrieveParty(id)
+	if err != nil {
+		return nil, "", fmt.Errorf("Party retrieve error: %w", err)
+	}
+	return p, move(p), nil
+}
+
+// PartyRequests realizes the requests for parties:
+// /party/new, /party/join, /party/bet, /party/disclose and /party/result
+func PartyRequests(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		Party      string `json:"party"`
+		Player     string `json:"player"`
+		Size       int    `json:"size"`
+		Resolution string `json:"resolution"`
+		Bet        string `json:"bet"`
+		Secret     string `json:"secret"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := strings.TrimPrefix(req.URL.Path, "/party/")
+	missed := input.Player == "" ||
+		action != "new" && input.Party == "" ||
+		(action == "bet" || action == "disclose") && input.Bet == "" ||
+		action == "disclose" && input.Secret == ""
+	if missed {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	var move func(p *Party) string
+	switch action {
+	case "new":
+		p, err := NewParty(input.Player, input.Size, input.Resolution)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := parties.StoreParty(p); err != nil {
+			storageError(fmt.Errorf("Party store error: %w", err), w)
+			return
+		}
+		sendResponse(w, struct {
+			Party     string `json:"party"`
+			Pseudonym string `json:"pseudonym"`
+		}{p.ID, p.Players[0].Player})
+		log.Printf("new party: %s for %d players started by %s", p.ID, p.Size, input.Player)
+		return
+	case "join":
+		move = func(p *Party) string { return p.Join(input.Player) }
+	case "bet":
+		move = func(p *Party) string { return p.Bet(input.Bet, input.Player) }
+	case "disclose":
+		move = func(p *Party) string { return p.Disclose(input.Secret, input.Bet, input.Player) }
+	case "result":
+		move = func(p *Party) string { return p.Result(input.Player) }
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	p, res, err := playParty(input.Party, action != "result", move)
+	if err != nil {
+		storageError(err, w)
+		return
+	}
+	pseudonym := ""
+	if action == "join" {
+		pseudonym = p.Pseudonym(input.Player)
+	}
+	sendResponse(w, struct {
+		Response  string     `json:"response"`
+		Stage     int        `json:"stage"`
+		Pseudonym string     `json:"pseudonym,omitempty"`
+		Players   []Standing `json:"players,omitempty"`
+	}{res, p.Stage, pseudonym, p.Standings(input.Player)})
+	log.Printf("party: %s:%s - %s result: %s", p.ID, input.Player, action, res)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// playStage makes the bets and disclosures of players
+func playStage(t *testing.T, p *Party, bets map[string]string) map[string]string {
+	for player, bet := range bets {
+		p.Bet(saltedHash(player+" secret", bet), player)
+	}
+	res := map[string]string{}
+	for player, bet := range bets {
+		res[player] = p.Disclose(player+" secret", bet, player)
+	}
+	for player := range bets {
+		res[player] = p.Result(player)
+	}
+	return res
+}
+
+func Test1_PartyElimination(t *testing.T) {
+	_, err := NewParty("p1", 2, "")
+	require.Error(t, err)
+	_, err = NewParty("p1", 3, "knockout")
+	require.Error(t, err)
+
+	p, err := NewParty("p1", 4, "")
+	require.NoError(t, err)
+	require.Equal(t, "wait for other players to join (1 of 4)", p.Result("p1"))
+	require.Equal(t, "You have already joined this party", p.Join("p1"))
+	require.Equal(t, "wait for other players to join (2 of 4)", p.Join("p2"))
+	p.Join("p3")
+	require.Equal(t, "place Your bet, please", p.Join("p4"))
+	require.Equal(t, "this party is already full", p.Join("p5"))
+	require.Equal(t, msgUnauthorized, p.Result("p5"))
+
+	// all gestures are shown: draw
+	res := playStage(t, p, map[string]string{"p1": "stone", "p2": "paper", "p3": "scissors", "p4": "stone"})
+	require.Equal(t, "stage 1: draw; place Your bet, please", res["p1"])
+	require.Equal(t, 2, p.Stage)
+
+	p.Bet(saltedHash("p1 secret", "paper"), "p1")
+	require.Equal(t, "stage 1: draw; wait for other players to place their bets", p.Result("p1"))
+
+	res = playStage(t, p, map[string]string{"p1": "paper", "p2": "stone", "p3": "paper", "p4": "paper"})
+	require.Equal(t, "stage 2: paper won; You lose: eliminated at stage 2", res["p2"])
+	require.Equal(t, "stage 2: paper won; place Your bet, please", res["p3"])
+	// eliminated player can't bet
+	require.Equal(t, "stage 2: paper won; You lose: eliminated at stage 2", p.Bet(saltedHash("s", "paper"), "p2"))
+
+	p.Bet(saltedHash("p1 secret", "paper"), "p1")
+	require.Equal(t, "Your bet is incorrect", func() string {
+		p.Bet(saltedHash("p3 secret", "scissors"), "p3")
+		p.Bet(saltedHash("p4 secret", "paper"), "p4")
+		return p.Disclose("p1 secret", "stone", "p1")
+	}())
+	require.Equal(t, "unknown bet", p.Disclose("p1 secret", "rock", "p1"))
+	p.Disclose("p1 secret", "paper", "p1")
+	p.Disclose("p3 secret", "scissors", "p3")
+	require.Equal(t, "stage 3: scissors won; You lose: eliminated at stage 3", p.Disclose("p4 secret", "paper", "p4"))
+	require.Equal(t, "stage 3: scissors won; You won the party", p.Result("p3"))
+	require.Equal(t, StateFinished, p.State)
+
+	st := p.Standings("p3")
+	require.Equal(t, []Standing{
+		{Bet: "paper", Out: 3},
+		{Bet: "stone", Out: 2},
+		{You: true, Bet: "scissors"},
+		{Bet: "paper", Out: 3},
+	}, st)
+
+	p.Players[2].Out = 1
+	require.Equal(t, msgFalsificated, p.Result("p3"))
+}
+
+func Test2_PartyPoints(t *testing.T) {
+	p, err := NewParty("p1", 3, resolutionPoints)
+	require.NoError(t, err)
+	p.Join("p2")
+	p.Join("p3")
+	res := playStage(t, p, map[string]string{"p1": "stone", "p2": "scissors", "p3": "scissors"})
+	require.Equal(t, "You scored 2 points: place 1 of 3, your bet: stone", res["p1"])
+	require.Equal(t, "You scored 0 points: place 2 of 3, your bet: scissors", res["p2"])
+	require.Equal(t, StateFinished, p.State)
+
+	// the finished party isn't changed by the transition
+	require.Error(t, p.transition(StateBetting, func() { p.Stage++ }))
+	require.Equal(t, StateFinished, p.State)
+	require.Equal(t, 1, p.Stage)
+}
+
+func Test3_PartyService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	data, err := request("party/new", []byte(`{"player":"p1","size":3}`))
+	require.NoError(t, err)
+	created := struct {
+		Party string `json:"party"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &created))
+
+	for _, player := range []string{"p2", "p3"} {
+		_, err = request("party/join", []byte(fmt.Sprintf(`{"party":%q,"player":%q}`, created.Party, player)))
+		require.NoError(t, err)
+	}
+	for player, bet := range map[string]string{"p1": "paper", "p2": "stone", "p3": "stone"} {
+		_, err = request("party/bet", []byte(fmt.Sprintf(`{"party":%q,"player":%q,"bet":%q}`,
+			created.Party, player, saltedHash(player, bet))))
+		require.NoError(t, err)
+	}
+	for player, bet := range map[string]string{"p1": "paper", "p2": "stone", "p3": "stone"} {
+		_, err = request("party/disclose", []byte(fmt.Sprintf(`{"party":%q,"player":%q,"bet":%q,"secret":%q}`,
+			created.Party, player, bet, player)))
+		require.NoError(t, err)
+	}
+	data, err = request("party/result", []byte(fmt.Sprintf(`{"party":%q,"player":"p1"}`, created.Party)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"stage 1: paper won; You won the party","stage":1,"players":[`+
+		`{"you":true,"bet":"paper"},{"you":false,"bet":"stone","out":1},{"you":false,"bet":"stone","out":1}]}`, string(data))
+
+	data, err = request("party/new", []byte(`{"player":"p1","size":11}`))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "party size has to be from 3 to 10")
+
+	_, err = NewPartyStore(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}})
+	require.Error(t, err)
+
+	// the concurrent joins are not lost
+	data, err = request("party/new", []byte(`{"player":"p1","size":10}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &created))
+	wg := sync.WaitGroup{}
+	for i := 2; i <= 10; i++ {
+		wg.Add(1)
+		go func(player string) {
+			defer wg.Done()
+			_, err := request("party/join", []byte(fmt.Sprintf(`{"party":%q,"player":%q}`, created.Party, player)))
+			require.NoError(t, err)
+		}(fmt.Sprintf("p%d", i))
+	}
+	wg.Wait()
+	p, err := parties.RetrieveParty(created.Party)
+	require.NoError(t, err)
+	require.Len(t, p.Players, 10)
+	require.Equal(t, StateBetting, p.State)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// The linked rounds (rematches) share the players' pseudonyms: the players' hashes of the linked round are made
+// with the id of the first round of the chain, so the rematch can be created without players' identifications.
+
+// hashID returns the id used for the players' hashes of round
+func (r *Round) hashID() string {
+	if r.Link != "" {
+		return r.Link
+	}
+	return r.ID
+}
+
+// linked returns new round linked to the round. The new round has the game, league, replay option, bot and
+// spectators of round.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) linked(id string) *Round {
+	return &Round{
+		ID:           id,
+		Link:         r.hashID(),
+		Prev:         r.ID,
+		HashKeyID:    r.HashKeyID,
+		State:        StateOpen,
+		Times:        &Timeline{Created: nowMilli()},
+		Game:         r.Game,
+		League:       r.League,
+		ReplayOnDraw: r.ReplayOnDraw,
+		Bot:          r.Bot,
+		BotRival:     r.BotRival,
+		Spectators:   r.Spectators,
+		Spectator:    r.Spectator,
+	}
+}
+
+// NextLinked returns the id of the next linked round (replay or rematch) for player.
+// It returns empty string when there is no next round or the round can't be played by player.
+func (r *Round) NextLinked(player string) string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.check(player) != "" {
+		return ""
+	}
+	return r.Next
+}
+
+// Replay returns the replay of the round with automatic replay that ended in a draw or nil when there is no replay.
+// Both players are already attached to the replay. The round is not changed: the stored replay is linked by LinkNext.
+func (r *Round) Replay() *Round {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.Next != "" || !r.ReplayOnDraw || r.state() != StateFinished || r.Winner != draw || !r.validSignature() {
+		return nil
+	}
+	n := r.linked(uuid.NewString())
+	n.Player1, n.Player2 = r.Player1, r.Player2
+	n.Member1, n.Member2 = r.Member1, r.Member2
+	n.State = StateBetting
+	n.Times.Attached = n.Times.Created
+	n.reSing()
+	n.record(eventCreated, "", nil, map[string]json.RawMessage{}, nil)
+	return n
+}
+
+// Rematch offers the rematch of finished round to the rival. It returns the new linked round where the player is
+// the first player and only the rival can attach. The round is not changed: the stored rematch is linked by LinkNext.
+// It returns nil round and empty response when the rematch is already linked: the player has to attach it.
+func (r *Round) Rematch(player string) (*Round, string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if res := r.check(player); res != "" {
+		return nil, res
+	}
+	if r.state() != StateFinished {
+		return nil, "round is not finished"
+	}
+	if r.Series != "" {
+		return nil, "the series round can't be rematched"
+	}
+	if r.Next != "" {
+		return nil, ""
+	}
+	n := r.linked(uuid.NewString())
+	n.Player1, n.Rival, n.Member1 = r.Player1, r.Player2, r.Member1
+	if r.roundSaltedHash(player) == r.Player2 {
+		n.Player1, n.Rival, n.Member1 = r.Player2, r.Player1, r.Member2
+	}
+	n.reSing()
+	n.record(eventCreated, player, nil, map[string]json.RawMessage{}, nil)
+	return n, n.result(player)
+}
+
+// LinkNext links the stored next round (the rematch offered by player or the replay when player is empty)
+// to the round. It returns false when the round already has the next round.
+func (r *Round) LinkNext(next, player string) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	typ := eventRematch
+	if player == "" {
+		typ = eventReplay
+	}
+	defer r.record(typ, player, nil, r.eventFields(), nil)
+	if r.Next != "" || !r.validSignature() {
+		return false
+	}
+	r.Next = next
+	r.reSing()
+	return true
+}
+
+// storeReplay stores the replay of resolved round and links it to the round, so the round is never stored
+// with the id of not existing replay
+func storeReplay(round *Round) error {
+	replay := round.Replay()
+	if replay == nil {
+		return nil
+	}
+	if err := botPlay(replay); err != nil {
+		return err
+	}
+	if err := db.Store(replay); err != nil {
+		return fmt.Errorf("Round store error: %w", err)
+	}
+	round.LinkNext(replay.ID, "")
+	log.Printf("round: %s - replay on draw: %s", round.ID, replay.ID)
+	return nil
+}
+
+// Rematch realizes the request for rematch of finished round. The first request of players creates the linked
+// round, the request of the rival attaches it.
+func Rematch(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		Round  string `json:"round"`
+		Player string `json:"player"`
+	}{}
+
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.Round == "" || input.Player == "" {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	var next *Round
+	round, res, err := play(input.Round, false, func(round *Round) string {
+		var res string
+		next, res = round.Rematch(input.Player)
+		return res
+	})
+	if err != nil {
+		storageError(err, w)
+		return
+	}
+	if next != nil {
+		// the rematch is stored before it is linked to the round
+		if err := botPlay(next); err != nil {
+			storageError(err, w)
+			return
+		}
+		if err := db.Store(next); err != nil {
+			storageError(fmt.Errorf("Round store error: %w", err), w)
+			return
+		}
+		linked := false
+		_, _, err = play(round.ID, true, func(round *Round) string {
+			linked = round.LinkNext(next.ID, input.Player)
+			return ""
+		})
+		if err != nil {
+			storageError(err, w)
+			return
+		}
+		if linked {
+			res = next.Result(input.Player)
+			log.Printf("round: %s:%s - rematch offered: %s", round.ID, input.Player, next.ID)
+		} else {
+			// the rival's rematch is linked concurrently: it has to be attached
+			next, res = nil, ""
+		}
+	}
+	if next == nil && res == "" {
+		next, res, err = play(round.NextLinked(input.Player), true, func(next *Round) string {
+			res := next.Attach(input.Player)
+			if res == "You can't play with yourself" || res == "this round is already full" {
+				return next.Result(input.Player)
+			}
+			return res
+		})
+		if err != nil {
+			storageError(err, w)
+			return
+		}
+		log.Printf("round: %s:%s - rematch accepted: %s", round.ID, input.Player, next.ID)
+	}
+
+	id := ""
+	if next != nil {
+		id = next.ID
+	}
+	sendResponse(w, struct {
+		Round    string `json:"round,omitempty"`
+		Response string `json:"response"`
+	}{id, res})
+}
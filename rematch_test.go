@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// playRound makes the bets and disclosures of players in the round and returns the last response
+func playRound(t *testing.T, tr *Round, bet1, bet2 string) string {
+	tr.Bet(tr.saltedHash("s1", []byte(bet1)), "player1")
+	tr.Bet(tr.saltedHash("s2", []byte(bet2)), "player2")
+	tr.Disclose("s1", bet1, "player1")
+	return tr.Disclose("s2", bet2, "player2")
+}
+
+func Test1_ReplayOnDraw(t *testing.T) {
+	tr, err := NewRoundWithOptions("player1", RoundOptions{ReplayOnDraw: true})
+	require.NoError(t, err)
+	tr.Attach("player2")
+	require.Nil(t, tr.Replay())
+	require.Equal(t, "draw: your bet: stone, the rival's bet: stone", playRound(t, tr, "stone", "stone"))
+	// the replay is linked after it is made
+	require.Empty(t, tr.NextLinked("player1"))
+	replay := tr.Replay()
+	require.True(t, tr.LinkNext(replay.ID, ""))
+	require.False(t, tr.LinkNext("another", ""))
+	require.Nil(t, tr.Replay())
+	require.Equal(t, replay.ID, tr.NextLinked("player1"))
+	require.Empty(t, tr.NextLinked("player3"))
+
+	require.Equal(t, tr.Next, replay.ID)
+	require.Equal(t, tr.ID, replay.Link)
+	require.Equal(t, tr.ID, replay.Prev)
+	require.Equal(t, tr.Player1, replay.Player1)
+	require.Equal(t, tr.Player2, replay.Player2)
+	require.True(t, replay.Valid())
+	require.Equal(t, "place Your bet, please", replay.Result("player2"))
+
+	// the replay of replay has the same link
+	require.Equal(t, "draw: your bet: paper, the rival's bet: paper", playRound(t, replay, "paper", "paper"))
+	second := replay.Replay()
+	require.Equal(t, tr.ID, second.Link)
+	require.Equal(t, "You lose: your bet: stone, the rival's bet: paper", playRound(t, second, "paper", "stone"))
+	require.Nil(t, second.Replay())
+	require.Empty(t, second.NextLinked("player1"))
+}
+
+func Test2_Rematch(t *testing.T) {
+	tr := NewRound("player1")
+	tr.Attach("player2")
+	_, res := tr.Rematch("player1")
+	require.Equal(t, "round is not finished", res)
+	playRound(t, tr, "stone", "paper")
+	_, res = tr.Rematch("player3")
+	require.Equal(t, msgUnauthorized, res)
+
+	next, res := tr.Rematch("player2")
+	require.Equal(t, "wait for rival attach", res)
+	// the rematch is linked after it is stored
+	require.Empty(t, tr.Next)
+	require.True(t, tr.LinkNext(next.ID, "player2"))
+	require.Equal(t, tr.Next, next.ID)
+	require.Equal(t, tr.Player2, next.Player1)
+	require.Equal(t, tr.Player1, next.Rival)
+	require.True(t, tr.Valid())
+
+	// the second request accepts the existing rematch
+	accepted, res := tr.Rematch("player1")
+	require.Nil(t, accepted)
+	require.Empty(t, res)
+
+	require.Equal(t, "this round is a rematch for another player", next.Attach("player3"))
+	require.Equal(t, "place Your bet, please", next.Attach("player1"))
+	require.Equal(t, tr.Player1, next.Player2)
+}
+
+func Test3_RematchService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	data, err := request("new", []byte(`{"player":"r1","replay_on_draw":true}`))
+	require.NoError(t, err)
+	created := struct {
+		Round string `json:"round"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &created))
+	_, err = request("attach", []byte(fmt.Sprintf(`{"round":%q,"player":"r2"}`, created.Round)))
+	require.NoError(t, err)
+	for _, player := range []string{"r1", "r2"} {
+		_, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`,
+			created.Round, player, saltedHash(player, "paper"))))
+		require.NoError(t, err)
+	}
+	_, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":"r1","bet":"paper","secret":"r1"}`, created.Round)))
+	require.NoError(t, err)
+	data, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":"r2","bet":"paper","secret":"r2"}`, created.Round)))
+	require.NoError(t, err)
+	resp := struct {
+		Response string `json:"response"`
+		Next     string `json:"next"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &resp))
+	require.Equal(t, "draw: your bet: paper, the rival's bet: paper", resp.Response)
+	require.NotEmpty(t, resp.Next)
+
+	// the replay is ready for bets of both players
+	data, err = request("result", []byte(fmt.Sprintf(`{"round":%q,"player":"r1"}`, resp.Next)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"response":"place Your bet, please"`)
+
+	// the rematch of the finished round is the replay
+	data, err = request("rematch", []byte(fmt.Sprintf(`{"round":%q,"player":"r2"}`, created.Round)))
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf(`{"round":%q,"response":"place Your bet, please"}`, resp.Next), string(data))
+
+	// the replay is won, so the rematch has to be offered and accepted
+	round := resp.Next
+	bets := map[string]string{"r1": "stone", "r2": "scissors"}
+	for player, bet := range bets {
+		_, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`,
+			round, player, saltedHash(player, bet))))
+		require.NoError(t, err)
+	}
+	for player, bet := range bets {
+		_, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q,"secret":%q}`,
+			round, player, bet, player)))
+		require.NoError(t, err)
+	}
+	data, err = request("rematch", []byte(fmt.Sprintf(`{"round":%q,"player":"r2"}`, round)))
+	require.NoError(t, err)
+	offer := struct {
+		Round    string `json:"round"`
+		Response string `json:"response"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &offer))
+	require.Equal(t, "wait for rival attach", offer.Response)
+	data, err = request("rematch", []byte(fmt.Sprintf(`{"round":%q,"player":"r1"}`, round)))
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf(`{"round":%q,"response":"place Your bet, please"}`, offer.Round), string(data))
+
+	data, err = request("rematch", []byte(fmt.Sprintf(`{"round":%q,"player":"r1"}`, offer.Round)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"round is not finished"}`, string(data))
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// The arena scripts are compiled with the memory limit enforced by the interpreter: the operators that make new
+// values (+, *, %, |, <<, slices and the augmented assignments) are replaced by the calls of checked builtins, the
+// attributes are replaced by the checked methods and the builtins that make new values are replaced by the checked
+// ones. The checks add the size of the new value to the budget of execution before the value is made when the size
+// can exceed its arguments (e.g. the repetition of string or the join of list), so the execution fails with
+// errArenaMemory before the memory is allocated. The other values are bounded by the number of interpreter steps.
+// The names of checked builtins can't be written in the script, so the script can't redefine them.
+
+const (
+	maxArenaAlloc = 16 << 20 // maximal size of values made during one execution
+	arenaItemSize = 16       // size charged for the item of list, tuple and dict
+
+	arenaBudgetKey = "arena.budget" // key of the budget in the thread locals
+
+	arenaBinaryName  = "@binary"  // checked binary operator
+	arenaInplaceName = "@inplace" // checked augmented assignment
+	arenaChargeName  = "@charge"  // charges the size of the sliced value
+	arenaAttrName    = "@attr"    // checked attribute
+)
+
+// errArenaMemory is returned when the values made during the execution exceed maxArenaAlloc
+var errArenaMemory = errors.New("memory limit exceeded")
+
+// arenaBudget is the size of values made during the execution
+type arenaBudget struct {
+	used int
+}
+
+// arenaCharge adds size to the budget of thread. It returns errArenaMemory when the budget is exceeded.
+func arenaCharge(thread *starlark.Thread, size int) error {
+	b, _ := thread.Local(arenaBudgetKey).(*arenaBudget)
+	if b == nil {
+		return nil
+	}
+	if size < 0 || size > maxArenaAlloc-b.used {
+		b.used = maxArenaAlloc
+		return errArenaMemory
+	}
+	b.used += size
+	return nil
+}
+
+// arenaSize returns the size of value: the length of strings and bytes, the number of items of containers
+// multiplied by arenaItemSize and the bytes of integers. The items are charged when they are made.
+func arenaSize(v starlark.Value) int {
+	switch v := v.(type) {
+	case starlark.String:
+		return len(v)
+	case starlark.Bytes:
+		return len(v)
+	case starlark.Int:
+		if _, ok := v.Int64(); ok {
+			return 8
+		}
+		return (v.BigInt().BitLen() + 7) / 8
+	case starlark.Sequence:
+		if v.Type() != "range" {
+			return v.Len() * arenaItemSize
+		}
+	}
+	return arenaItemSize
+}
+
+// arenaItems returns the size of items of the iterable value, the range is counted too
+func arenaItems(v starlark.Value) int {
+	if n := starlark.Len(v); n > 0 {
+		if _, ok := v.(starlark.String); !ok {
+			return n * arenaItemSize
+		}
+	}
+	return 0
+}
+
+// arenaReprSize returns the upper bound of the length of string representation of value. It stops counting
+// when the size exceeds limit. The values in path are represented as cycles.
+func arenaReprSize(v starlark.Value, limit int, path map[starlark.Value]bool) int {
+	switch v := v.(type) {
+	case starlark.String:
+		// the escaped byte takes 4 symbols at most
+		return 4*len(v) + 2
+	case starlark.Bytes:
+		return 4*len(v) + 3
+	case starlark.Int:
+		return 3*arenaSize(v) + 2
+	case *starlark.List, starlark.Tuple, *starlark.Dict, *starlark.Set:
+		if v, ok := v.(*starlark.List); ok && path[v] {
+			return 5
+		}
+		if v, ok := v.(*starlark.Dict); ok && path[v] {
+			return 5
+		}
+		if _, ok := v.(starlark.Tuple); !ok {
+			path[v] = true
+			defer delete(path, v)
+		}
+		size := 7
+		iter := starlark.Iterate(v)
+		defer iter.Done()
+		var item starlark.Value
+		for size <= limit && iter.Next(&item) {
+			size += 2 + arenaReprSize(item, limit-size, path)
+			if d, ok := v.(*starlark.Dict); ok {
+				value, _, _ := d.Get(item)
+				size += 2 + arenaReprSize(value, limit-size, path)
+			}
+		}
+		return size
+	}
+	return len(v.String())
+}
+
+// arenaArgsReprSize returns the upper bound of the length of string representation of arguments
+func arenaArgsReprSize(args starlark.Tuple, kwargs []starlark.Tuple, limit int) int {
+	values := append(starlark.Tuple{}, args...)
+	for _, kv := range kwargs {
+		values = append(values, kv[1])
+	}
+	return arenaReprSize(values, limit, map[starlark.Value]bool{})
+}
+
+// arenaBinarySize returns the upper bound of the size of result of binary operator
+func arenaBinarySize(op syntax.Token, x, y starlark.Value) int {
+	switch op {
+	case syntax.STAR:
+		for _, v := range [][2]starlark.Value{{x, y}, {y, x}} {
+			if n, ok := v[0].(starlark.Int); ok {
+				if _, isInt := v[1].(starlark.Int); isInt {
+					break
+				}
+				times, ok := n.Int64()
+				if !ok || times > maxArenaAlloc {
+					return -1
+				}
+				if times < 0 {
+					times = 0
+				}
+				if size := int64(arenaSize(v[1])) * times; size <= maxArenaAlloc {
+					return int(size)
+				}
+				return -1
+			}
+		}
+	case syntax.PERCENT:
+		if format, ok := x.(starlark.String); ok {
+			// every directive can take the whole representation of arguments
+			directives := strings.Count(string(format), "%")
+			return len(format) + directives*arenaReprSize(y, maxArenaAlloc, map[starlark.Value]bool{})
+		}
+	case syntax.LTLT:
+		// the shift count is limited by the interpreter
+		return arenaSize(x) + 64
+	}
+	return arenaSize(x) + arenaSize(y)
+}
+
+// arenaBinary is the checked binary operator: @binary(op, x, y)
+func arenaBinary(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+	op, x, y := arenaOpToken(args[0]), args[1], args[2]
+	if err := arenaCharge(thread, arenaBinarySize(op, x, y)); err != nil {
+		return nil, err
+	}
+	return starlark.Binary(op, x, y)
+}
+
+// arenaInplace is the checked augmented assignment: x op= y is replaced by x = @inplace(op, x, y). The list and
+// the dict are changed in place like by the interpreter.
+func arenaInplace(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	op, x, y := arenaOpToken(args[0]), args[1], args[2]
+	method := ""
+	switch x.(type) {
+	case *starlark.List:
+		if _, ok := y.(starlark.Iterable); ok && op == syntax.PLUS {
+			method = "extend"
+		}
+	case *starlark.Dict:
+		if _, ok := y.(*starlark.Dict); ok && op == syntax.PIPE {
+			method = "update"
+		}
+	}
+	if method == "" {
+		return arenaBinary(thread, b, args, kwargs)
+	}
+	if err := arenaCharge(thread, arenaItems(y)); err != nil {
+		return nil, err
+	}
+	fn, err := x.(starlark.HasAttrs).Attr(method)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := starlark.Call(thread, fn, starlark.Tuple{y}, nil); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// arenaOpToken returns the operator token passed to the checked builtin
+func arenaOpToken(v starlark.Value) syntax.Token {
+	n, _ := v.(starlark.Int).Int64()
+	return syntax.Token(n)
+}
+
+// arenaChargeValue charges the size of value that is sliced: @charge(x)[i:j]
+func arenaChargeValue(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+	if err := arenaCharge(thread, arenaSize(args[0])); err != nil {
+		return nil, err
+	}
+	return args[0], nil
+}
+
+// arenaMethodSize returns the size charged before the call of method name of x
+func arenaMethodSize(x starlark.Value, name string, args starlark.Tuple, kwargs []starlark.Tuple) int {
+	s, _ := x.(starlark.String)
+	switch name {
+	case "join":
+		size := 0
+		if len(args) == 1 {
+			if iter := starlark.Iterate(args[0]); iter != nil {
+				defer iter.Done()
+				var item starlark.Value
+				for size <= maxArenaAlloc && iter.Next(&item) {
+					size += len(s) + arenaSize(item)
+				}
+			}
+		}
+		return size
+	case "replace":
+		if len(args) < 2 {
+			return len(s)
+		}
+		old, _ := args[0].(starlark.String)
+		repl, _ := args[1].(starlark.String)
+		n := strings.Count(string(s), string(old))
+		if old == "" {
+			n = len(s) + 1
+		}
+		if len(args) > 2 {
+			if limit, ok := args[2].(starlark.Int); ok {
+				if l, ok := limit.Int64(); ok && l >= 0 && int(l) < n {
+					n = int(l)
+				}
+			}
+		}
+		return len(s) + n*len(repl)
+	case "format":
+		directives := strings.Count(string(s), "{")
+		return len(s) + directives*arenaArgsReprSize(args, kwargs, maxArenaAlloc)
+	case "split", "rsplit", "splitlines", "elems", "codepoints", "partition", "rpartition":
+		// the parts are made by one call
+		return (len(s) + 1) * arenaItemSize
+	case "extend", "update", "union":
+		size := 0
+		for _, arg := range args {
+			size += arenaItems(arg)
+		}
+		return size
+	}
+	return 0
+}
+
+// arenaMethod returns the checked method of x
+func arenaMethod(x starlark.Value, method *starlark.Builtin) *starlark.Builtin {
+	return starlark.NewBuiltin(method.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple,
+		kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := arenaCharge(thread, arenaMethodSize(x, method.Name(), args, kwargs)); err != nil {
+			return nil, err
+		}
+		v, err := starlark.Call(thread, method, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		return v, arenaCharge(thread, arenaSize(v))
+	})
+}
+
+// arenaAttr is the checked attribute: x.name is replaced by @attr(x, "name"). The methods are checked.
+func arenaAttr(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	v, err := starlark.Call(thread, starlark.Universe["getattr"], args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if method, ok := v.(*starlark.Builtin); ok && method.Receiver() != nil {
+		return arenaMethod(method.Receiver(), method), nil
+	}
+	return v, nil
+}
+
+// arenaBuiltin returns the checked builtin of universe: size returns the size charged before the call
+func arenaBuiltin(name string, size func(args starlark.Tuple, kwargs []starlark.Tuple) int) *starlark.Builtin {
+	fn := starlark.Universe[name]
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple,
+		kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := arenaCharge(thread, size(args, kwargs)); err != nil {
+			return nil, err
+		}
+		v, err := starlark.Call(thread, fn, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		return v, arenaCharge(thread, arenaSize(v))
+	})
+}
+
+// arenaPredeclared are the checked builtins of arena scripts
+var arenaPredeclared = func() starlark.StringDict {
+	items := func(args starlark.Tuple, kwargs []starlark.Tuple) int {
+		size := len(kwargs) * arenaItemSize
+		for _, arg := range args {
+			size += arenaItems(arg)
+		}
+		return size
+	}
+	repr := func(args starlark.Tuple, kwargs []starlark.Tuple) int {
+		return arenaArgsReprSize(args, kwargs, maxArenaAlloc)
+	}
+	d := starlark.StringDict{
+		arenaBinaryName:  starlark.NewBuiltin(arenaBinaryName, arenaBinary),
+		arenaInplaceName: starlark.NewBuiltin(arenaInplaceName, arenaInplace),
+		arenaChargeName:  starlark.NewBuiltin(arenaChargeName, arenaChargeValue),
+		arenaAttrName:    starlark.NewBuiltin(arenaAttrName, arenaAttr),
+		// the output is discarded, so the message isn't made
+		"print": starlark.NewBuiltin("print", func(*starlark.Thread, *starlark.Builtin, starlark.Tuple,
+			[]starlark.Tuple) (starlark.Value, error) {
+			return starlark.None, nil
+		}),
+		"getattr": starlark.NewBuiltin("getattr", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple,
+			kwargs []starlark.Tuple) (starlark.Value, error) {
+			return arenaAttr(thread, b, args, kwargs)
+		}),
+	}
+	for _, name := range []string{"list", "tuple", "dict", "sorted", "reversed", "enumerate", "zip"} {
+		d[name] = arenaBuiltin(name, items)
+	}
+	for _, name := range []string{"str", "repr", "fail"} {
+		d[name] = arenaBuiltin(name, repr)
+	}
+	d["bytes"] = arenaBuiltin("bytes", func(args starlark.Tuple, _ []starlark.Tuple) int {
+		size := 0
+		for _, arg := range args {
+			size += arenaSize(arg) + arenaItems(arg)
+		}
+		return size
+	})
+	return d
+}()
+
+// arenaCompile compiles the script with the checked operators and builtins
+func arenaCompile(filename, source string) (*starlark.Program, error) {
+	f, err := syntax.LegacyFileOptions().Parse(filename, source, 0)
+	if err != nil {
+		return nil, err
+	}
+	f.Stmts = arenaStmts(f.Stmts)
+	return starlark.FileProgram(f, arenaPredeclared.Has)
+}
+
+// arenaCall returns the call of checked builtin name at pos
+func arenaCall(name string, pos syntax.Position, args ...syntax.Expr) *syntax.CallExpr {
+	return &syntax.CallExpr{Fn: &syntax.Ident{NamePos: pos, Name: name}, Lparen: pos, Args: args, Rparen: pos}
+}
+
+// arenaTokenLiteral returns the literal of operator token passed to the checked builtin
+func arenaTokenLiteral(op syntax.Token, pos syntax.Position) *syntax.Literal {
+	return &syntax.Literal{Token: syntax.INT, TokenPos: pos, Raw: strconv.Itoa(int(op)), Value: int64(op)}
+}
+
+// arenaOperators are the checked operators and the operators of augmented assignments
+var arenaOperators = map[syntax.Token]syntax.Token{
+	syntax.PLUS:    syntax.PLUS,
+	syntax.STAR:    syntax.STAR,
+	syntax.PERCENT: syntax.PERCENT,
+	syntax.PIPE:    syntax.PIPE,
+	syntax.LTLT:    syntax.LTLT,
+
+	syntax.PLUS_EQ:    syntax.PLUS,
+	syntax.STAR_EQ:    syntax.STAR,
+	syntax.PERCENT_EQ: syntax.PERCENT,
+	syntax.PIPE_EQ:    syntax.PIPE,
+	syntax.LTLT_EQ:    syntax.LTLT,
+}
+
+// arenaStmts replaces the operators and the attributes in statements by the checked builtins
+func arenaStmts(stmts []syntax.Stmt) []syntax.Stmt {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *syntax.AssignStmt:
+			s.RHS = arenaExpr(s.RHS)
+			s.LHS = arenaTarget(s.LHS)
+			op, checked := arenaOperators[s.Op]
+			if !checked || s.Op == op {
+				break
+			}
+			switch lhs := syntax.Expr(s.LHS).(type) {
+			case *syntax.Ident, *syntax.IndexExpr, *syntax.DotExpr:
+				// the target is read by its copy
+				s.Op, s.RHS = syntax.EQ, arenaCall(arenaInplaceName, s.OpPos, arenaTokenLiteral(op, s.OpPos),
+					arenaExpr(arenaCopy(lhs)), s.RHS)
+			}
+		case *syntax.DefStmt:
+			arenaParams(s.Params)
+			s.Body = arenaStmts(s.Body)
+		case *syntax.ExprStmt:
+			s.X = arenaExpr(s.X)
+		case *syntax.IfStmt:
+			s.Cond = arenaExpr(s.Cond)
+			s.True, s.False = arenaStmts(s.True), arenaStmts(s.False)
+		case *syntax.ForStmt:
+			s.Vars, s.X = arenaTarget(s.Vars), arenaExpr(s.X)
+			s.Body = arenaStmts(s.Body)
+		case *syntax.WhileStmt:
+			s.Cond = arenaExpr(s.Cond)
+			s.Body = arenaStmts(s.Body)
+		case *syntax.ReturnStmt:
+			if s.Result != nil {
+				s.Result = arenaExpr(s.Result)
+			}
+		}
+	}
+	return stmts
+}
+
+// arenaParams replaces the operators and the attributes in default values of parameters
+func arenaParams(params []syntax.Expr) {
+	for _, p := range params {
+		if b, ok := p.(*syntax.BinaryExpr); ok && b.Op == syntax.EQ {
+			b.Y = arenaExpr(b.Y)
+		}
+	}
+}
+
+// arenaTarget replaces the operators and the attributes in the expressions of assignment target.
+// The attribute assigned is kept.
+func arenaTarget(e syntax.Expr) syntax.Expr {
+	switch t := e.(type) {
+	case *syntax.IndexExpr:
+		t.X, t.Y = arenaExpr(t.X), arenaExpr(t.Y)
+	case *syntax.DotExpr:
+		t.X = arenaExpr(t.X)
+	case *syntax.ParenExpr:
+		t.X = arenaTarget(t.X)
+	case *syntax.TupleExpr:
+		for i := range t.List {
+			t.List[i] = arenaTarget(t.List[i])
+		}
+	case *syntax.ListExpr:
+		for i := range t.List {
+			t.List[i] = arenaTarget(t.List[i])
+		}
+	}
+	return e
+}
+
+// arenaExpr replaces the operators and the attributes in expression by the checked builtins
+func arenaExpr(e syntax.Expr) syntax.Expr {
+	switch x := e.(type) {
+	case *syntax.BinaryExpr:
+		x.X, x.Y = arenaExpr(x.X), arenaExpr(x.Y)
+		if op, checked := arenaOperators[x.Op]; checked && x.Op == op {
+			return arenaCall(arenaBinaryName, x.OpPos, arenaTokenLiteral(x.Op, x.OpPos), x.X, x.Y)
+		}
+	case *syntax.DotExpr:
+		name := &syntax.Literal{Token: syntax.STRING, TokenPos: x.NamePos, Raw: strconv.Quote(x.Name.Name),
+			Value: x.Name.Name}
+		return arenaCall(arenaAttrName, x.Dot, arenaExpr(x.X), name)
+	case *syntax.SliceExpr:
+		x.X = arenaCall(arenaChargeName, x.Lbrack, arenaExpr(x.X))
+		for _, bound := range []*syntax.Expr{&x.Lo, &x.Hi, &x.Step} {
+			if *bound != nil {
+				*bound = arenaExpr(*bound)
+			}
+		}
+	case *syntax.CallExpr:
+		x.Fn = arenaExpr(x.Fn)
+		for i, arg := range x.Args {
+			switch a := arg.(type) {
+			case *syntax.BinaryExpr:
+				if a.Op == syntax.EQ {
+					// named argument
+					a.Y = arenaExpr(a.Y)
+					continue
+				}
+			case *syntax.UnaryExpr:
+				if a.Op == syntax.STAR || a.Op == syntax.STARSTAR {
+					a.X = arenaExpr(a.X)
+					continue
+				}
+			}
+			x.Args[i] = arenaExpr(arg)
+		}
+	case *syntax.Comprehension:
+		x.Body = arenaExpr(x.Body)
+		for _, clause := range x.Clauses {
+			switch c := clause.(type) {
+			case *syntax.ForClause:
+				c.Vars, c.X = arenaTarget(c.Vars), arenaExpr(c.X)
+			case *syntax.IfClause:
+				c.Cond = arenaExpr(c.Cond)
+			}
+		}
+	case *syntax.CondExpr:
+		x.Cond, x.True, x.False = arenaExpr(x.Cond), arenaExpr(x.True), arenaExpr(x.False)
+	case *syntax.DictExpr:
+		for i := range x.List {
+			x.List[i] = arenaExpr(x.List[i])
+		}
+	case *syntax.DictEntry:
+		x.Key, x.Value = arenaExpr(x.Key), arenaExpr(x.Value)
+	case *syntax.ListExpr:
+		for i := range x.List {
+			x.List[i] = arenaExpr(x.List[i])
+		}
+	case *syntax.TupleExpr:
+		for i := range x.List {
+			x.List[i] = arenaExpr(x.List[i])
+		}
+	case *syntax.ParenExpr:
+		x.X = arenaExpr(x.X)
+	case *syntax.UnaryExpr:
+		if x.X != nil {
+			x.X = arenaExpr(x.X)
+		}
+	case *syntax.IndexExpr:
+		x.X, x.Y = arenaExpr(x.X), arenaExpr(x.Y)
+	case *syntax.LambdaExpr:
+		arenaParams(x.Params)
+		x.Body = arenaExpr(x.Body)
+	}
+	return e
+}
+
+// arenaCopy returns the copy of the target of augmented assignment that is read by the checked builtin.
+// The target is made of identifiers, literals, indexes and attributes, other expressions are copied by reference.
+func arenaCopy(e syntax.Expr) syntax.Expr {
+	switch x := e.(type) {
+	case *syntax.Ident:
+		return &syntax.Ident{NamePos: x.NamePos, Name: x.Name}
+	case *syntax.IndexExpr:
+		c := *x
+		c.X, c.Y = arenaCopy(x.X), arenaCopy(x.Y)
+		return &c
+	case *syntax.DotExpr:
+		c := *x
+		c.X, c.Name = arenaCopy(x.X), &syntax.Ident{NamePos: x.Name.NamePos, Name: x.Name.Name}
+		return &c
+	case *syntax.ParenExpr:
+		c := *x
+		c.X = arenaCopy(x.X)
+		return &c
+	case *syntax.BinaryExpr:
+		c := *x
+		c.X, c.Y = arenaCopy(x.X), arenaCopy(x.Y)
+		return &c
+	case *syntax.UnaryExpr:
+		c := *x
+		if x.X != nil {
+			c.X = arenaCopy(x.X)
+		}
+		return &c
+	case *syntax.CallExpr:
+		c := *x
+		c.Fn, c.Args = arenaCopy(x.Fn), make([]syntax.Expr, len(x.Args))
+		for i, arg := range x.Args {
+			c.Args[i] = arenaCopy(arg)
+		}
+		return &c
+	case *syntax.TupleExpr:
+		c := *x
+		c.List = make([]syntax.Expr, len(x.List))
+		for i, item := range x.List {
+			c.List[i] = arenaCopy(item)
+		}
+		return &c
+	}
+	return e
+}
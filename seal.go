@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// sealKeyDomain is the domain of keys that encrypt the private seal keys at rest
+const sealKeyDomain = "stone_scissors_paper/seal-key/v1"
+
+// Sealed disclosure is the NaCl anonymous sealed box (X25519, XSalsa20-Poly1305) with the JSON encoded sealedReveal
+// encrypted to the server public key. Player can send it with the hidden bet, and the server opens it and discloses
+// the bet automatically as soon as both hidden bets are placed. The private keys of server are encrypted at rest
+// by the key derived from the server key (see keyRing).
+
+// sealedReveal is the content of sealed disclosure
+type sealedReveal struct {
+	Player string `json:"player"` // pseudonym of player that placed the bet (the hash of player's token)
+	Bet    string `json:"bet"`    // open bet
+	Secret string `json:"secret"` // secret that was used for preparing the hidden bet
+}
+
+// sealKey is a server key pair for sealed disclosures
+type sealKey struct {
+	ID      string    // key id
+	Private [32]byte  // private key
+	Public  [32]byte  // public key
+	Expires time.Time // time when the next key becomes current
+}
+
+// SealKeys is an interface for the server keys of sealed disclosures
+type SealKeys interface {
+	// Current returns the key that have to be used for new sealed disclosures
+	Current() (*sealKey, error)
+	// Get returns the key by id
+	Get(id string) (*sealKey, error)
+}
+
+// sealKeys is the instance of SealKeys used by rounds. Sealed disclosures are not supported when it is nil.
+var sealKeys SealKeys
+
+// redisSealKeys is a Redis implementation of SealKeys interface. The new key is generated for each period
+// and stored in database, so all service instances use the same keys.
+type redisSealKeys struct {
+	r      redis.UniversalClient
+	period time.Duration
+	keys   map[string]*sealKey // memory cache of keys
+	mux    sync.RWMutex
+}
+
+// NewSealKeys returns a new instance of SealKeys interface that rotates keys every period
+func NewSealKeys(opt redis.UniversalOptions, period time.Duration) (SealKeys, error) {
+	k := &redisSealKeys{
+		r:      redis.NewUniversalClient(&opt),
+		period: period,
+		keys:   map[string]*sealKey{},
+	}
+	// try to ping database
+	if err := k.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// newSealKey returns the key pair made from private key
+func newSealKey(id string, private []byte, expires time.Time) (*sealKey, error) {
+	if len(private) != 32 {
+		return nil, errors.New("wrong private key length")
+	}
+	k := &sealKey{ID: id, Expires: expires}
+	copy(k.Private[:], private)
+	public, err := curve25519.X25519(k.Private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	copy(k.Public[:], public)
+	return k, nil
+}
+
+// Current returns the key of current period. The key is generated when it doesn't exist yet.
+func (k *redisSealKeys) Current() (*sealKey, error) {
+	n := time.Now().UnixNano() / int64(k.period)
+	id := strconv.FormatInt(n, 10)
+	if key, err := k.Get(id); err != redis.Nil {
+		return key, err
+	}
+	private := make([]byte, 32)
+	if _, err := rand.Read(private); err != nil {
+		return nil, err
+	}
+	stored, err := encryptSealKey(private)
+	if err != nil {
+		return nil, err
+	}
+	// only one of concurrently generated keys is stored
+	if err := k.r.SetNX("seal:key:"+id, stored, time.Hour*8760).Err(); err != nil {
+		return nil, err
+	}
+	return k.Get(id)
+}
+
+// Get returns the key by id from memory cache or database
+func (k *redisSealKeys) Get(id string) (*sealKey, error) {
+	k.mux.RLock()
+	key, ok := k.keys[id]
+	k.mux.RUnlock()
+	if ok {
+		return key, nil
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	data, err := k.r.Get("seal:key:" + id).Result()
+	if err != nil {
+		return nil, err
+	}
+	private, err := decryptSealKey(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err = newSealKey(id, private, time.Unix(0, (n+1)*int64(k.period)))
+	if err != nil {
+		return nil, err
+	}
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.keys[id] = key
+	return key, nil
+}
+
+// sealKeyWrap returns the key that encrypts the private seal keys derived from the server key keyID
+func sealKeyWrap(keyID string) (*[32]byte, error) {
+	key, ok := ring.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("server key %q is not in the key ring", keyID)
+	}
+	wrap := sha256.Sum256([]byte(sealKeyDomain + key))
+	return &wrap, nil
+}
+
+// encryptSealKey encrypts the private key by the active server key: "<server key id>:<base64url of nonce and box>"
+func encryptSealKey(private []byte) (string, error) {
+	wrap, err := sealKeyWrap(ring.active)
+	if err != nil {
+		return "", err
+	}
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", err
+	}
+	return ring.active + ":" + encode64(secretbox.Seal(nonce[:], private, &nonce, wrap)), nil
+}
+
+// decryptSealKey decrypts the stored private key
+func decryptSealKey(data string) ([]byte, error) {
+	i := strings.LastIndex(data, ":")
+	if i < 0 {
+		return nil, errors.New("seal key isn't encrypted")
+	}
+	wrap, err := sealKeyWrap(data[:i])
+	if err != nil {
+		return nil, err
+	}
+	enc, err := base64.RawURLEncoding.DecodeString(data[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(enc) < 24 {
+		return nil, errors.New("wrong encrypted seal key")
+	}
+	var nonce [24]byte
+	copy(nonce[:], enc)
+	private, ok := secretbox.Open(nil, enc[24:], &nonce, wrap)
+	if !ok {
+		return nil, errors.New("seal key can't be decrypted")
+	}
+	return private, nil
+}
+
+// validSealed checks the format of sealed disclosure: "<key id>:<base64url of sealed box>"
+func validSealed(sealed string) bool {
+	parts := strings.SplitN(sealed, ":", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(data) <= box.AnonymousOverhead {
+		return false
+	}
+	_, err = sealKeys.Get(parts[0])
+	return err == nil
+}
+
+// openSealed decrypts the sealed disclosure
+func openSealed(sealed string) (*sealedReveal, error) {
+	parts := strings.SplitN(sealed, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("wrong sealed disclosure format")
+	}
+	key, err := sealKeys.Get(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	msg, ok := box.OpenAnonymous(nil, data, &key.Public, &key.Private)
+	if !ok {
+		return nil, errors.New("sealed disclosure can't be opened")
+	}
+	reveal := &sealedReveal{}
+	if err := json.Unmarshal(msg, reveal); err != nil {
+		return nil, err
+	}
+	return reveal, nil
+}
+
+// sealReveal makes the sealed disclosure by key. It is the client side part of protocol.
+func sealReveal(key *sealKey, reveal sealedReveal) (string, error) {
+	msg, _ := json.Marshal(reveal)
+	data, err := box.SealAnonymous(nil, msg, &key.Public, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return key.ID + ":" + encode64(data), nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// memSealKeys is a memory implementation of SealKeys interface for tests
+type memSealKeys struct {
+	key *sealKey
+}
+
+func newMemSealKeys(t *testing.T) *memSealKeys {
+	private := make([]byte, 32)
+	_, err := rand.Read(private)
+	require.NoError(t, err)
+	key, err := newSealKey("1", private, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	return &memSealKeys{key}
+}
+
+func (k *memSealKeys) Current() (*sealKey, error) {
+	return k.key, nil
+}
+
+func (k *memSealKeys) Get(id string) (*sealKey, error) {
+	if id != k.key.ID {
+		return nil, redis.Nil
+	}
+	return k.key, nil
+}
+
+func useMemSealKeys(t *testing.T) *sealKey {
+	keys := newMemSealKeys(t)
+	sealKeys = keys
+	t.Cleanup(func() { sealKeys = nil })
+	return keys.key
+}
+
+func Test_SealKeys(t *testing.T) {
+	_, err := NewSealKeys(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}}, time.Hour)
+	require.Error(t, err)
+
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+
+	opt := redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}
+	k1, err := NewSealKeys(opt, time.Second)
+	require.NoError(t, err)
+	k2, err := NewSealKeys(opt, time.Second)
+	require.NoError(t, err)
+
+	key1, err := k1.Current()
+	require.NoError(t, err)
+	require.True(t, key1.Expires.After(time.Now()))
+	// another instance uses the same key
+	key2, err := k2.Current()
+	require.NoError(t, err)
+	require.Equal(t, key1, key2)
+
+	time.Sleep(time.Until(key1.Expires))
+
+	// the key is rotated, but the previous one is still available
+	key3, err := k2.Current()
+	require.NoError(t, err)
+	require.NotEqual(t, key1.ID, key3.ID)
+	require.NotEqual(t, key1.Public, key3.Public)
+	key, err := k2.Get(key1.ID)
+	require.NoError(t, err)
+	require.Equal(t, key1.Private, key.Private)
+
+	// the private key is encrypted at rest, the plain key is rejected
+	stored, err := k1.(*redisSealKeys).r.Get("seal:key:" + key1.ID).Result()
+	require.NoError(t, err)
+	require.NotContains(t, stored, encode64(key1.Private[:]))
+	private, err := decryptSealKey(stored)
+	require.NoError(t, err)
+	require.Equal(t, key1.Private[:], private)
+	_, err = decryptSealKey(encode64(key1.Private[:]))
+	require.EqualError(t, err, "seal key isn't encrypted")
+	_, err = decryptSealKey("unknown:" + stored[strings.LastIndex(stored, ":")+1:])
+	require.Error(t, err)
+
+	_, err = k1.Get("123")
+	require.Error(t, err)
+	_, err = k1.Get("wrong id")
+	require.Error(t, err)
+}
+
+func Test_sealOpen(t *testing.T) {
+	key := useMemSealKeys(t)
+
+	sealed, err := sealReveal(key, sealedReveal{Player: "player1", Bet: "paper", Secret: "my secret"})
+	require.NoError(t, err)
+	require.True(t, validSealed(sealed))
+
+	reveal, err := openSealed(sealed)
+	require.NoError(t, err)
+	require.Equal(t, &sealedReveal{Player: "player1", Bet: "paper", Secret: "my secret"}, reveal)
+
+	require.False(t, validSealed("1"))
+	require.False(t, validSealed("1:short"))
+	require.False(t, validSealed("2"+sealed[1:]))
+	_, err = openSealed("2" + sealed[1:])
+	require.Error(t, err)
+	_, err = openSealed(sealed[:len(sealed)-2])
+	require.Error(t, err)
+}
+
+func Test_sealedRound(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	tr := NewRound(player1)
+	tr.Attach(player2)
+
+	res := tr.SealedBet(tr.saltedHash("my secret", []byte("paper")), "1:abc", player1)
+	require.Equal(t, "sealed disclosures are not supported", res)
+
+	key := useMemSealKeys(t)
+
+	res = tr.SealedBet(tr.saltedHash("my secret", []byte("paper")), "1:abc", player1)
+	require.Equal(t, "unsupported sealed disclosure format", res)
+
+	sealed1, _ := sealReveal(key, sealedReveal{Player: tr.Pseudonym(player1), Bet: "paper", Secret: "my secret"})
+	res = tr.SealedBet(tr.saltedHash("my secret", []byte("paper")), sealed1, player1)
+	require.Equal(t, "wait for the rival to place its bet", res)
+
+	sealed2, _ := sealReveal(key, sealedReveal{Player: tr.Pseudonym(player2), Bet: "stone", Secret: "my 2 secret"})
+	res = tr.SealedBet(commitmentV2("sha256", tr.ID, tr.Pseudonym(player2), "stone", "my 2 secret"), sealed2, player2)
+	require.Equal(t, "You lose: your bet: stone, the rival's bet: paper", res)
+
+	res = tr.Result(player1)
+	require.Equal(t, "You won: your bet: paper, the rival's bet: stone", res)
+	// the sealed disclosures are dropped after disclosure
+	require.Empty(t, tr.Sealed1+tr.Sealed2)
+}
+
+func Test_sealedRoundMixed(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+	key := useMemSealKeys(t)
+
+	tr := NewRound(player1)
+	tr.Attach(player2)
+
+	// sealed disclosure copied by rival is ignored
+	sealed1, _ := sealReveal(key, sealedReveal{Player: tr.Pseudonym(player1), Bet: "paper", Secret: "my secret"})
+	res := tr.SealedBet(tr.saltedHash("my secret", []byte("paper")), sealed1, player2)
+	require.Equal(t, "wait for the rival to place its bet", res)
+
+	res = tr.SealedBet(tr.saltedHash("my secret", []byte("paper")), sealed1, player1)
+	require.Equal(t, "wait for your rival to disclose its bet", res)
+
+	res = tr.Result(player2)
+	require.Equal(t, "disclose your bet, please", res)
+
+	res = tr.Disclose("my secret", "paper", player2)
+	require.Equal(t, "draw: your bet: paper, the rival's bet: paper", res)
+
+	// sealed disclosure that doesn't match the hidden bet is ignored
+	tr = NewRound(player1)
+	tr.Attach(player2)
+	sealed1, _ = sealReveal(key, sealedReveal{Player: tr.Pseudonym(player1), Bet: "stone", Secret: "my secret"})
+	tr.SealedBet(tr.saltedHash("my secret", []byte("paper")), sealed1, player1)
+	res = tr.Bet(tr.saltedHash("my secret", []byte("paper")), player2)
+	require.Equal(t, "disclose your bet, please", res)
+	require.Equal(t, nothing, tr.Bet1)
+}
+
+func Test_serviceSealedBets(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+	defer func() { sealKeys = nil }()
+
+	resp, err := http.Get("http://localhost:8080/keys")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	keys := struct {
+		Seal struct {
+			ID      string    `json:"id"`
+			Public  string    `json:"public"`
+			Expires time.Time `json:"expires"`
+		} `json:"seal"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &keys))
+	require.True(t, keys.Seal.Expires.After(time.Now()))
+
+	key, err := sealKeys.Get(keys.Seal.ID)
+	require.NoError(t, err)
+	require.Equal(t, keys.Seal.Public, encode64(key.Public[:]))
+	key = &sealKey{ID: key.ID, Public: key.Public} // client knows only public key
+
+	data, err = request("new", []byte(`{"player":"player1"}`))
+	require.NoError(t, err)
+	round := struct {
+		Round     string `json:"round"`
+		Pseudonym string `json:"pseudonym"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &round))
+	pseudonyms := map[string]string{"player1": round.Pseudonym}
+
+	data, err = request("attach", []byte(`{"player":"player2","round":"`+round.Round+`"}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &round))
+	pseudonyms["player2"] = round.Pseudonym
+
+	for i, p := range []struct{ player, bet, response string }{
+		{"player1", "scissors", "wait for the rival to place its bet"},
+		{"player2", "paper", "You lose: your bet: paper, the rival's bet: scissors"},
+	} {
+		sealed, err := sealReveal(key, sealedReveal{Player: pseudonyms[p.player], Bet: p.bet, Secret: "secret"})
+		require.NoError(t, err)
+		req, _ := json.Marshal(map[string]string{
+			"round":  round.Round,
+			"player": p.player,
+			"bet":    commitmentV2("sha3-256", round.Round, pseudonyms[p.player], p.bet, "secret"),
+			"sealed": sealed,
+		})
+		data, err = request("bet", req)
+		require.NoError(t, err, i)
+		require.Equal(t, `{"response":"`+p.response+`"}`, string(data))
+	}
+
+	data, err = request("result", []byte(`{"player":"player1","round":"`+round.Round+`"}`))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), `{"response":"You won`))
+
+	resp, err = http.Post("http://localhost:8080/keys", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
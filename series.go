@@ -0,0 +1,527 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// Hand is the set of gestures available to player in the series
+type Hand struct {
+	Stone    int `json:"stone"`
+	Scissors int `json:"scissors"`
+	Paper    int `json:"paper"`
+}
+
+// counter returns the counter of gesture in hand or nil for the gestures of other games
+func (h *Hand) counter(g Gesture) *int {
+	switch g {
+	case stone:
+		return &h.Stone
+	case scissors:
+		return &h.Scissors
+	case paper:
+		return &h.Paper
+	}
+	return nil
+}
+
+// Count returns the number of available gestures g
+func (h *Hand) Count(g Gesture) int {
+	if c := h.counter(g); c != nil {
+		return *c
+	}
+	return 0
+}
+
+// take consumes the gesture g
+func (h *Hand) take(g Gesture) {
+	if c := h.counter(g); c != nil && *c > 0 {
+		*c--
+	}
+}
+
+// empty checks that there are no gestures in hand
+func (h *Hand) empty() bool {
+	return h.Stone+h.Scissors+h.Paper == 0
+}
+
+// hand returns the hand of player (hash of token) in the series round or nil when the round is not limited.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) hand(shPlayer string) *Hand {
+	switch shPlayer {
+	case r.Player1:
+		return r.Hand1
+	case r.Player2:
+		return r.Hand2
+	}
+	return nil
+}
+
+// Series is the series of stone scissors paper rounds between two players with limited hands.
+// Each player starts with the same number of every gesture and each round consumes the disclosed gestures.
+// The series ends when the hands are empty or when a player wins the target number of rounds.
+type Series struct {
+	mx        sync.Mutex    // guard for async updates
+	ID        string        `json:"id"`                  // series id
+	Players   [2]string     `json:"players"`             // hashes of players' tokens
+	Hands     [2]Hand       `json:"hands"`               // available gestures of players
+	Wins      [2]int        `json:"wins"`                // number of won rounds
+	Points    [2]int        `json:"points"`              // accumulated points of rounds
+	Target    int           `json:"target,omitempty"`    // number of wins to win the series, 0 - play all cards
+	Rounds    []SeriesRound `json:"rounds"`              // rounds of series
+	State     State         `json:"state"`               // series state
+	Winner    int           `json:"winner"`              // 'nobody' - not finished, 'first'|'second'|'draw' - winner of series
+	Signature string        `json:"signature"`           // series signature (calculated without itself)
+	KeyID     string        `json:"keyid,omitempty"`     // id of server key used for the signature
+	HashKeyID string        `json:"hashkeyid,omitempty"` // id of server key used for the players' hashes
+}
+
+// SeriesRound is the round of series
+type SeriesRound struct {
+	ID      string `json:"id"`      // round id
+	First   int    `json:"first"`   // index of series player that is player1 of round
+	Counted bool   `json:"counted"` // the round result is counted in series
+}
+
+const (
+	// default and maximal number of every gesture in hand
+	defaultCards = 4
+	maxCards     = 20
+)
+
+// NewSeries returns new open Series for the player with cards of every gesture and the target number of wins
+func NewSeries(player string, cards, target int) (*Series, error) {
+	if cards == 0 {
+		cards = defaultCards
+	}
+	if cards < 1 || cards > maxCards {
+		return nil, fmt.Errorf("number of cards has to be from 1 to %d", maxCards)
+	}
+	if target < 0 || target > 3*cards {
+		return nil, fmt.Errorf("target has to be from 0 to %d", 3*cards)
+	}
+	s := &Series{
+		ID:        uuid.NewString(),
+		Target:    target,
+		Rounds:    []SeriesRound{},
+		State:     StateOpen,
+		HashKeyID: ring.active,
+	}
+	hand := Hand{Stone: cards, Scissors: cards, Paper: cards}
+	s.Hands = [2]Hand{hand, hand}
+	s.Players[0] = s.hash(player)
+	s.signing().reSign()
+	return s, nil
+}
+
+// seriesTransitions are the allowed transitions between series states, the rounds are played in the betting state
+var seriesTransitions = map[State][]State{
+	StateOpen:    {StateBetting},
+	StateBetting: {StateFinished},
+}
+
+// transition applies the change of series data and moves the series to the state to. Nothing is changed when
+// the transition is not allowed: it returns the error in this case.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (s *Series) transition(to State, change func()) error {
+	if !allowed(seriesTransitions, s.State, to) {
+		return fmt.Errorf("series %s: transition from %s to %s is not allowed", s.ID, s.State, to)
+	}
+	change()
+	s.State = to
+	return nil
+}
+
+// hash returns the salted hash of obj made with the server key of players' hashes
+func (s *Series) hash(obj interface{}) string {
+	return keyHash(s.HashKeyID, s.ID, obj)
+}
+
+// signing returns the signature of series
+func (s *Series) signing() signing {
+	return signing{id: s.ID, obj: s, keyID: &s.KeyID, hashKeyID: s.HashKeyID, signature: &s.Signature}
+}
+
+// player returns the index of player or -1 when the player is not in series
+func (s *Series) player(player string) int {
+	h := s.hash(player)
+	for i, p := range s.Players {
+		if h != "" && p == h {
+			return i
+		}
+	}
+	return -1
+}
+
+// check returns the index of player or the error message when the series can't be played by player
+func (s *Series) check(player string) (int, string) {
+	if res := s.signing().err(); res != "" {
+		return -1, res
+	}
+	i := s.player(player)
+	if i < 0 {
+		return -1, msgUnauthorized
+	}
+	return i, ""
+}
+
+// current returns the last round of series or nil
+func (s *Series) current() *SeriesRound {
+	if len(s.Rounds) == 0 {
+		return nil
+	}
+	return &s.Rounds[len(s.Rounds)-1]
+}
+
+// Join adds the second player to series
+func (s *Series) Join(player string) string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if res := s.signing().err(); res != "" {
+		return res
+	}
+	if s.player(player) >= 0 {
+		return "You have already joined this series"
+	}
+	if s.Players[1] != "" {
+		return "this series is already full"
+	}
+	if err := s.transition(StateBetting, func() { s.Players[1] = s.hash(player) }); err != nil {
+		log.Println(err)
+		return "this series is already full"
+	}
+	s.signing().reSign()
+	return s.result(1)
+}
+
+// Account counts the result of the finished current round of series: the disclosed gestures are taken from
+// the hands and the win is added to the winner. It returns true when the series was changed.
+func (s *Series) Account(round *Round) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	cur := s.current()
+	if cur == nil || cur.Counted || round == nil || round.ID != cur.ID || round.Series != s.ID {
+		return false
+	}
+	if !s.signing().valid() {
+		return false
+	}
+	round.mx.Lock()
+	defer round.mx.Unlock()
+	if !round.validSignature() || round.state() != StateFinished {
+		return false
+	}
+	p1, p2 := cur.First, 1-cur.First
+	s.Hands[p1].take(round.Bet1)
+	s.Hands[p2].take(round.Bet2)
+	s.Points[p1] += round.Points1
+	s.Points[p2] += round.Points2
+	switch round.Winner {
+	case first:
+		s.Wins[p1]++
+	case second:
+		s.Wins[p2]++
+	}
+	cur.Counted = true
+	if s.Hands[0].empty() || s.Hands[1].empty() ||
+		s.Target > 0 && (s.Wins[0] >= s.Target || s.Wins[1] >= s.Target) {
+		err := s.transition(StateFinished, func() {
+			switch {
+			case s.Wins[0] > s.Wins[1]:
+				s.Winner = first
+			case s.Wins[0] < s.Wins[1]:
+				s.Winner = second
+			default:
+				s.Winner = draw
+			}
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	s.signing().reSign()
+	return true
+}
+
+// NextRound returns the round of series to be played by player: the current round is attached by the rival
+// of its creator, the new round is created when the current one is counted.
+// It returns nil round when there is no round to play, the response for player and true when the round was
+// created or attached.
+func (s *Series) NextRound(player string, current *Round) (*Round, string, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	i, res := s.check(player)
+	if res != "" {
+		return nil, res, false
+	}
+	if s.State != StateBetting {
+		return nil, s.result(i), false
+	}
+	cur := s.current()
+	if cur == nil || cur.Counted {
+		hand := s.Hands[i]
+		round, err := newRound(player, "", func(r *Round) {
+			r.Series = s.ID
+			r.Hand1 = &hand
+		})
+		if err != nil {
+			log.Println(err)
+			return nil, "round can't be created", false
+		}
+		s.Rounds = append(s.Rounds, SeriesRound{ID: round.ID, First: i})
+		s.signing().reSign()
+		return round, round.Result(player), true
+	}
+	if current == nil || current.ID != cur.ID {
+		return nil, "round can't be found", false
+	}
+	if cur.First != i && !current.Attached() {
+		hand := s.Hands[i]
+		res := current.AttachHand(player, &hand)
+		return current, res, res != msgFalsificated
+	}
+	return current, current.Result(player), false
+}
+
+// Result returns the series result for player
+func (s *Series) Result(player string) (SeriesResult, string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	i, res := s.check(player)
+	if res != "" {
+		return SeriesResult{}, res
+	}
+	sr := SeriesResult{
+		Response:  s.result(i),
+		Rounds:    len(s.Rounds),
+		Wins:      s.Wins[i],
+		RivalWins: s.Wins[1-i],
+		Points:    s.Points[i],
+		RivalPts:  s.Points[1-i],
+		Hand:      s.Hands[i],
+		RivalHand: s.Hands[1-i],
+	}
+	if cur := s.current(); cur != nil && !cur.Counted {
+		sr.Round = cur.ID
+	}
+	return sr, ""
+}
+
+// SeriesResult is the series state for player
+type SeriesResult struct {
+	Response  string `json:"response"`        // series state
+	Round     string `json:"round,omitempty"` // id of the current round in play
+	Rounds    int    `json:"rounds"`          // number of rounds
+	Wins      int    `json:"wins"`            // rounds won by player
+	RivalWins int    `json:"rival_wins"`      // rounds won by rival
+	Points    int    `json:"points"`          // points accumulated by player
+	RivalPts  int    `json:"rival_points"`    // points accumulated by rival
+	Hand      Hand   `json:"hand"`            // available gestures of player
+	RivalHand Hand   `json:"rival_hand"`      // available gestures of rival
+}
+
+// result describes the series state for player i.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (s *Series) result(i int) string {
+	switch {
+	case s.State == StateOpen:
+		return "wait for rival join"
+	case s.State != StateFinished:
+		return fmt.Sprintf("play the round, please (score %d:%d)", s.Wins[i], s.Wins[1-i])
+	case s.Winner == draw:
+		return fmt.Sprintf("draw: score %d:%d", s.Wins[i], s.Wins[1-i])
+	case s.Winner == i+1:
+		return fmt.Sprintf("You won the series: score %d:%d", s.Wins[i], s.Wins[1-i])
+	}
+	return fmt.Sprintf("You lose the series: score %d:%d", s.Wins[i], s.Wins[1-i])
+}
+
+// msgNotInHand is the response for the gesture that is not available in the player's hand
+const msgNotInHand = "this gesture is not available in your hand"
+
+// seriesExpiry is the time the series is kept after the last change, so the abandoned series is removed
+const seriesExpiry = time.Hour * 24 * 30
+
+// SeriesStore is an interface of the persistence layer of series
+type SeriesStore interface {
+	StoreSeries(*Series) error
+	RetrieveSeries(id string) (*Series, error)
+	// UpdateSeries retrieves the series, makes the update and stores the series changed by update when it is
+	// not changed concurrently, otherwise the update is repeated for the new series.
+	UpdateSeries(id string, update func(s *Series) (bool, error)) (*Series, error)
+}
+
+// seriesStore is the storage of series
+var seriesStore SeriesStore
+
+// redisSeries is a Redis implementation of SeriesStore interface
+type redisSeries struct {
+	r redis.UniversalClient
+}
+
+// NewSeriesStore returns a new instance of SeriesStore interface implementing the persistence layer via Redis
+func NewSeriesStore(opt redis.UniversalOptions) (SeriesStore, error) {
+	s := &redisSeries{redis.NewUniversalClient(&opt)}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StoreSeries stores the series
+func (s *redisSeries) StoreSeries(series *Series) error {
+	series.mx.Lock()
+	data, _ := json.Marshal(series)
+	series.mx.Unlock()
+	return s.r.Set("series:"+series.ID, data, seriesExpiry).Err()
+}
+
+// RetrieveSeries reads the series
+func (s *redisSeries) RetrieveSeries(id string) (*Series, error) {
+	data, err := s.r.Get("series:" + id).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	series := &Series{}
+	if err := json.Unmarshal(data, series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// UpdateSeries makes the update of series with the compare-and-set of the stored series
+func (s *redisSeries) UpdateSeries(id string, update func(s *Series) (bool, error)) (series *Series, err error) {
+	err = casUpdate(s.r, "series:"+id, seriesExpiry, func(data []byte) ([]byte, error) {
+		series = &Series{}
+		if err := json.Unmarshal(data, series); err != nil {
+			return nil, err
+		}
+		changed, err := update(series)
+		if err != nil || !changed {
+			return nil, err
+		}
+		series.mx.Lock()
+		defer series.mx.Unlock()
+		return json.Marshal(series)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// SeriesRequests realizes the requests for series:
+// /series/new, /series/join, /series/round and /series/result
+func SeriesRequests(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		Series string `json:"series"`
+		Player string `json:"player"`
+		Cards  int    `json:"cards"`
+		Target int    `json:"target"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := strings.TrimPrefix(req.URL.Path, "/series/")
+	if input.Player == "" || action != "new" && input.Series == "" {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	if action == "new" {
+		s, err := NewSeries(input.Player, input.Cards, input.Target)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := seriesStore.StoreSeries(s); err != nil {
+			storageError(fmt.Errorf("Series store error: %w", err), w)
+			return
+		}
+		sendResponse(w, struct {
+			Series string `json:"series"`
+		}{s.ID})
+		log.Printf("new series: %s started by %s", s.ID, input.Player)
+		return
+	}
+	if action != "join" && action != "round" && action != "result" {
+		http.NotFound(w, req)
+		return
+	}
+
+	var res string
+	var round *Round
+	s, err := seriesStore.UpdateSeries(input.Series, func(s *Series) (bool, error) {
+		res, round = "", nil
+		// count the result of the current round before any action
+		var current *Round
+		if cur := s.current(); cur != nil && !cur.Counted {
+			var err error
+			current, err = db.Retrieve(cur.ID)
+			if err != nil && err != redis.Nil {
+				return false, fmt.Errorf("Round retrieve error: %w", err)
+			}
+		}
+		changed := s.Account(current)
+
+		switch action {
+		case "join":
+			res = s.Join(input.Player)
+			changed = changed || res != msgFalsificated && res != msgUnknownKey
+		case "round":
+			var played bool
+			round, res, played = s.NextRound(input.Player, current)
+			if played {
+				// the round created in the attempt that lost the series update is not linked
+				// to the series and its id is not sent to anybody
+				if err := db.Store(round); err != nil {
+					return false, fmt.Errorf("Round store error: %w", err)
+				}
+				changed = true
+			}
+		}
+		return changed, nil
+	})
+	if err != nil {
+		storageError(fmt.Errorf("Series update error: %w", err), w)
+		return
+	}
+	log.Printf("series: %s:%s - %s result: %s", s.ID, input.Player, action, res)
+
+	switch action {
+	case "join":
+		sendResponse(w, struct {
+			Response string `json:"response"`
+		}{res})
+	case "round":
+		id := ""
+		if round != nil {
+			id = round.ID
+		}
+		sendResponse(w, struct {
+			Round    string `json:"round,omitempty"`
+			Response string `json:"response"`
+		}{id, res})
+	default:
+		sr, res := s.Result(input.Player)
+		if res != "" {
+			sr.Response = res
+		}
+		sendResponse(w, sr)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// playSeriesRound plays the next round of series with bets of players
+func playSeriesRound(t *testing.T, s *Series, bet1, bet2 string) *Round {
+	round, _, created := s.NextRound("s1", nil)
+	require.True(t, created)
+	_, res, attached := s.NextRound("s2", round)
+	require.True(t, attached)
+	require.Equal(t, "place Your bet, please", res)
+	round.Bet(saltedHash("secret1", bet1), "s1")
+	round.Bet(saltedHash("secret2", bet2), "s2")
+	round.Disclose("secret1", bet1, "s1")
+	round.Disclose("secret2", bet2, "s2")
+	require.True(t, s.Account(round))
+	return round
+}
+
+func Test1_SeriesLimitedHands(t *testing.T) {
+	_, err := NewSeries("s1", 21, 0)
+	require.Error(t, err)
+	_, err = NewSeries("s1", 1, 4)
+	require.Error(t, err)
+
+	s, err := NewSeries("s1", 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, Hand{Stone: 1, Scissors: 1, Paper: 1}, s.Hands[0])
+	_, res, _ := s.NextRound("s1", nil)
+	require.Equal(t, "wait for rival join", res)
+	require.Equal(t, "play the round, please (score 0:0)", s.Join("s2"))
+	require.Equal(t, "this series is already full", s.Join("s3"))
+	_, res, _ = s.NextRound("s3", nil)
+	require.Equal(t, msgUnauthorized, res)
+
+	round := playSeriesRound(t, s, "stone", "scissors")
+	require.Equal(t, Hand{Scissors: 1, Paper: 1}, s.Hands[0])
+	require.Equal(t, Hand{Stone: 1, Paper: 1}, s.Hands[1])
+	require.False(t, s.Account(round))
+
+	// the series round can't be attached without the hand
+	round, _, _ = s.NextRound("s2", nil)
+	require.Equal(t, "this round is a part of series", round.Attach("s3"))
+	s.NextRound("s1", round)
+	require.Equal(t, &Hand{Scissors: 1, Paper: 1}, round.Hand2)
+	round.Bet(saltedHash("secret1", "paper"), "s1")
+	round.Bet(saltedHash("secret2", "stone"), "s2")
+	require.Equal(t, "this gesture is not available in your hand", round.Disclose("secret1", "stone", "s1"))
+	require.Equal(t, "wait for your rival to disclose its bet", round.Disclose("secret2", "stone", "s2"))
+	// the round is not finished
+	require.False(t, s.Account(round))
+	require.False(t, s.Account(nil))
+
+	// the next round can't be played till the current one is finished
+	_, res, created := s.NextRound("s1", round)
+	require.False(t, created)
+	require.Equal(t, "disclose your bet, please", res)
+
+	round.Disclose("secret1", "paper", "s1")
+	require.True(t, s.Account(round))
+	playSeriesRound(t, s, "scissors", "paper")
+	sr, res := s.Result("s1")
+	require.Empty(t, res)
+	require.Equal(t, SeriesResult{
+		Response: "You won the series: score 3:0",
+		Rounds:   3,
+		Wins:     3,
+		Points:   3,
+	}, sr)
+	_, res, _ = s.NextRound("s2", nil)
+	require.Equal(t, "You lose the series: score 0:3", res)
+
+	s.Wins[0] = 2
+	_, res = s.Result("s1")
+	require.Equal(t, msgFalsificated, res)
+}
+
+func Test2_SeriesTarget(t *testing.T) {
+	s, err := NewSeries("s1", 0, 2)
+	require.NoError(t, err)
+	s.Join("s2")
+	playSeriesRound(t, s, "stone", "scissors")
+	playSeriesRound(t, s, "stone", "stone")
+	require.Equal(t, StateBetting, s.State)
+	playSeriesRound(t, s, "paper", "stone")
+	require.Equal(t, StateFinished, s.State)
+	require.Equal(t, first, s.Winner)
+	require.Equal(t, Hand{Stone: 2, Scissors: 4, Paper: 3}, s.Hands[0])
+	// the finished series isn't changed by the transition
+	require.Error(t, s.transition(StateBetting, func() { s.Winner = draw }))
+	require.Equal(t, first, s.Winner)
+
+	// the open bet outside the hand is rejected
+	useMemSealKeys(t)
+	s, err = NewSeries("s1", 1, 0)
+	require.NoError(t, err)
+	s.Join("s2")
+	playSeriesRound(t, s, "stone", "scissors")
+	round, _, _ := s.NextRound("s1", nil)
+	s.NextRound("s2", round)
+	res, secret := round.AssistedBet("stone", "s1")
+	require.Equal(t, msgNotInHand, res)
+	require.Empty(t, secret)
+	res, _ = round.AssistedBet("paper", "s1")
+	require.Equal(t, "wait for the rival to place its bet", res)
+}
+
+func Test3_SeriesService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	data, err := request("series/new", []byte(`{"player":"s1","cards":1,"target":1}`))
+	require.NoError(t, err)
+	created := struct {
+		Series string `json:"series"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &created))
+
+	data, err = request("series/join", []byte(fmt.Sprintf(`{"series":%q,"player":"s2"}`, created.Series)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"play the round, please (score 0:0)"}`, string(data))
+
+	next := struct {
+		Round    string `json:"round"`
+		Response string `json:"response"`
+	}{}
+	data, err = request("series/round", []byte(fmt.Sprintf(`{"series":%q,"player":"s2"}`, created.Series)))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &next))
+	require.Equal(t, "wait for rival attach", next.Response)
+	data, err = request("series/round", []byte(fmt.Sprintf(`{"series":%q,"player":"s1"}`, created.Series)))
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf(`{"round":%q,"response":"place Your bet, please"}`, next.Round), string(data))
+
+	for player, bet := range map[string]string{"s1": "scissors", "s2": "paper"} {
+		_, err = request("bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`,
+			next.Round, player, saltedHash(player, bet))))
+		require.NoError(t, err)
+	}
+	for player, bet := range map[string]string{"s1": "scissors", "s2": "paper"} {
+		_, err = request("disclose", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q,"secret":%q}`,
+			next.Round, player, bet, player)))
+		require.NoError(t, err)
+	}
+
+	data, err = request("series/result", []byte(fmt.Sprintf(`{"series":%q,"player":"s1"}`, created.Series)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"You won the series: score 1:0","rounds":1,"wins":1,"rival_wins":0,"points":1,"rival_points":0,`+
+		`"hand":{"stone":1,"scissors":0,"paper":1},"rival_hand":{"stone":1,"scissors":1,"paper":0}}`, string(data))
+
+	_, err = NewSeriesStore(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}})
+	require.Error(t, err)
+
+	// the concurrent requests for the next round get the same round
+	data, err = request("series/new", []byte(`{"player":"s1"}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &created))
+	_, err = request("series/join", []byte(fmt.Sprintf(`{"series":%q,"player":"s2"}`, created.Series)))
+	require.NoError(t, err)
+	rounds := make([]string, 2)
+	wg := sync.WaitGroup{}
+	for i, player := range []string{"s1", "s2"} {
+		wg.Add(1)
+		go func(i int, player string) {
+			defer wg.Done()
+			data, err := request("series/round", []byte(fmt.Sprintf(`{"series":%q,"player":%q}`, created.Series, player)))
+			require.NoError(t, err)
+			next := struct {
+				Round string `json:"round"`
+			}{}
+			require.NoError(t, json.Unmarshal(data, &next))
+			rounds[i] = next.Round
+		}(i, player)
+	}
+	wg.Wait()
+	require.Equal(t, rounds[0], rounds[1])
+	s, err := seriesStore.RetrieveSeries(created.Series)
+	require.NoError(t, err)
+	require.Len(t, s.Rounds, 1)
+	require.Equal(t, rounds[0], s.Rounds[0].ID)
+	// the series expires after the last change
+	ttl := seriesStore.(*redisSeries).r.TTL("series:" + created.Series).Val()
+	require.InDelta(t, seriesExpiry.Seconds(), ttl.Seconds(), 5)
+}
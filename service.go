@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,12 +22,17 @@ import (
 )
 
 var (
-	db         Database
-	version    = "test_version"
-	serverSalt = ""
+	db      Database
+	version = "test_version"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		if err := verifyCmd(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	cfg, err := newConfig()
 	if err != nil {
 		log.Fatal(err)
@@ -33,31 +44,156 @@ func main() {
 }
 
 func doMain(cfg *config) error {
-	serverSalt = cfg.ServerSalt
+	keys := cfg.ServerKeys
+	if len(keys) == 0 {
+		keys = map[string]string{"": cfg.ServerSalt}
+	}
+	kr, err := newKeyRing(keys, cfg.ServerKeyID)
+	if err != nil {
+		return err
+	}
+	ring = kr
+
+	redisOpt := redis.UniversalOptions{Addrs: cfg.RedisAddrs, Password: cfg.RedisPassword}
 
-	d, err := NewDatabase(redis.UniversalOptions{Addrs: cfg.RedisAddrs, Password: cfg.RedisPassword})
+	var d Database
+	recordEvents = cfg.StorageMode == storageEvents
+	if recordEvents {
+		d, err = NewEventDatabase(redisOpt, cfg.SnapshotEvery)
+	} else {
+		d, err = NewDatabase(redisOpt)
+	}
+	if err != nil {
+		return err
+	}
+
+	idem, err := NewIdempotencyStore(redisOpt, cfg.IdempotencyTTL)
 	if err != nil {
 		return err
 	}
 
 	db = NewCache(d, 40*time.Second, 1*time.Second)
 
+	tlog, err = NewTransparencyLog(redisOpt)
+	if err != nil {
+		return err
+	}
+
+	parties, err = NewPartyStore(redisOpt)
+	if err != nil {
+		return err
+	}
+
+	leagues, err = NewLeagueStore(redisOpt)
+	if err != nil {
+		return err
+	}
+
+	seriesStore, err = NewSeriesStore(redisOpt)
+	if err != nil {
+		return err
+	}
+
+	teams, err = NewTeamStore(redisOpt)
+	if err != nil {
+		return err
+	}
+
+	botHistory, err = NewBotHistoryStore(redisOpt)
+	if err != nil {
+		return err
+	}
+
+	house, err = NewHouseChains(redisOpt, houseChainLength)
+	if err != nil {
+		return err
+	}
+
+	arena, err = NewArenaStore(redisOpt)
+	if err != nil {
+		return err
+	}
+
+	fallbackAfter, fallbackUnrated = cfg.FallbackBotAfter, cfg.FallbackBotUnrated
+
+	ledger, err = NewLedger(redisOpt, cfg.StakeExpiry)
+	if err != nil {
+		return err
+	}
+
+	tamper, err = NewTamperStore(redisOpt)
+	if err != nil {
+		return err
+	}
+	tamperHooks = nil
+	if cfg.TamperWebhook != "" {
+		tamperHooks = append(tamperHooks, webhook(cfg.TamperWebhook))
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if lister, ok := d.(RoundLister); ok && len(ring.keys) > 1 {
+		go resignJob(lister, cfg.ResignInterval, stop)
+	}
+	go arenaJob(cfg.ArenaInterval, stop)
+	go arenaCheckJob(stop)
+	go stakeJob(stop)
+	go tlogJob(stop)
+
+	sealKeys, err = NewSealKeys(redisOpt, cfg.SealKeyPeriod)
+	if err != nil {
+		return err
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/new", New)
-	mux.HandleFunc("/attach", Attach)
-	mux.HandleFunc("/bet", Bet)
-	mux.HandleFunc("/disclose", Disclose)
+	mux.HandleFunc("/new", idempotent(idem, New))
+	mux.HandleFunc("/attach", idempotent(idem, Attach))
+	mux.HandleFunc("/bet", idempotent(idem, Bet))
+	mux.HandleFunc("/disclose", idempotent(idem, Disclose))
+	mux.HandleFunc("/cancel", idempotent(idem, Cancel))
 	mux.HandleFunc("/result", Result)
+	mux.HandleFunc("/spectate", Spectate)
+	mux.HandleFunc("/party/", idempotent(idem, PartyRequests))
+	mux.HandleFunc("/team/", idempotent(idem, TeamRequests))
+	mux.HandleFunc("/series/", idempotent(idem, SeriesRequests))
+	mux.HandleFunc("/league", League)
+	mux.HandleFunc("/rematch", idempotent(idem, Rematch))
+	mux.HandleFunc("/house/anchor", HouseAnchor)
+	mux.HandleFunc("/arena/", ArenaRequests)
+	mux.HandleFunc("/arena/upload", admin(cfg.ArenaToken, idempotent(idem, ArenaUpload)))
+	mux.HandleFunc("/ledger/statement", LedgerStatement)
+	mux.HandleFunc("/keys", Keys)
+	mux.HandleFunc("/rounds/", Rounds)
+	mux.HandleFunc("/log/", Log)
+	mux.HandleFunc("/admin/tamper", admin(cfg.AdminToken, Tamper))
+	mux.HandleFunc("/admin/tamper/", admin(cfg.AdminToken, Tamper))
+	mux.HandleFunc("/admin/rounds/", admin(cfg.AdminToken, AdminRounds(d)))
+	mux.HandleFunc("/admin/arena/run", admin(cfg.AdminToken, ArenaRun))
+	mux.HandleFunc("/admin/arena/scripts/", admin(cfg.AdminToken, ArenaDelete))
+	mux.HandleFunc("/admin/ledger/credit", admin(cfg.AdminToken, idempotent(idem, LedgerCredit)))
+	mux.HandleFunc("/debug/vars", admin(cfg.AdminToken, expvar.Handler().ServeHTTP))
 
 	server := http.Server{
 		Addr:    cfg.HostPort,
 		Handler: mux,
 	}
 
+	lis, err := net.Listen("tcp", cfg.GRPCHostPort)
+	if err != nil {
+		return err
+	}
+	grpcServer, grpcShutdown := NewGRPCServer(500 * time.Millisecond)
+
 	log.Printf("Stone Scissors Paper game service v.%s\n", version)
 	log.Printf("Starting service at %s\n", cfg.HostPort)
+	log.Printf("Starting gRPC service at %s\n", cfg.GRPCHostPort)
 
 	go func() { log.Println(server.ListenAndServe()) }()
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Printf("gRPC server error: %v", err)
+		}
+	}()
 
 	sig := make(chan (os.Signal), 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM)
@@ -69,6 +205,8 @@ func doMain(cfg *config) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
 
+	grpcShutdown(ctx)
+
 	err = server.Shutdown(ctx)
 	if err != nil {
 		log.Printf("Shutdown error:%v", err)
@@ -114,7 +252,14 @@ func sendResponse(w http.ResponseWriter, response interface{}) {
 func New(w http.ResponseWriter, req *http.Request) {
 
 	input := struct {
-		Player string `json:"player"`
+		Player       string `json:"player"`
+		Game         string `json:"game"`
+		League       string `json:"league"`
+		ReplayOnDraw bool   `json:"replay_on_draw"`
+		Opponent     string `json:"opponent"`
+		Fallback     string `json:"fallback_after"`
+		Spectators   string `json:"spectators"`
+		Stake        int64  `json:"stake"`
 	}{}
 	if err := getInput(req, &input); err != nil {
 		log.Println(err)
@@ -129,18 +274,60 @@ func New(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	round := NewRound(input.Player)
+	if (input.Stake != 0 || input.Game == gameMinusOne) && input.Fallback == "" {
+		// the round played for stakes and the minus-one round have no fallback bot by default
+		input.Fallback = "0"
+	}
+	fallback, err := parseFallback(input.Fallback)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	err := db.Store(round)
+	opt := RoundOptions{
+		Game:         input.Game,
+		League:       input.League,
+		ReplayOnDraw: input.ReplayOnDraw,
+		Opponent:     input.Opponent,
+		Fallback:     fallback,
+		Spectators:   input.Spectators,
+		Stake:        input.Stake,
+	}
+	if err := opt.validate(); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opt.Stake > 0 {
+		balance, err := ledger.Balance(ledgerAccount(input.Player))
+		if err != nil {
+			storageError(fmt.Errorf("Ledger balance error: %w", err), w)
+			return
+		}
+		if balance < opt.Stake {
+			log.Printf("%s: %s", input.Player, msgInsufficientFunds)
+			http.Error(w, msgInsufficientFunds, http.StatusPaymentRequired)
+			return
+		}
+	}
+
+	round, err := startRound(input.Player, opt)
 	if err != nil {
-		storageError("Round store error", err, w)
+		storageError(err, w)
 		return
 	}
 
 	sendResponse(w, struct {
-		Round string `json:"round"`
+		Round          string `json:"round"`
+		Pseudonym      string `json:"pseudonym"`
+		Commitment     string `json:"commitment,omitempty"`
+		SpectatorToken string `json:"spectator_token,omitempty"`
 	}{
-		Round: round.ID,
+		Round:          round.ID,
+		Pseudonym:      round.Pseudonym(input.Player),
+		Commitment:     round.BotCommitment(),
+		SpectatorToken: round.SpectatorToken(),
 	})
 
 	log.Printf("new round: %s started by %s", round.ID, input.Player)
@@ -166,24 +353,20 @@ func Attach(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	round, err := db.Retrieve(input.Round)
-	if err != nil {
-		storageError("Round retrieve error", err, w)
-		return
-	}
-
-	res := round.Attach(input.Player)
-
-	err = db.Store(round)
+	round, res, err := play(input.Round, true, func(round *Round) string {
+		return round.Attach(input.Player)
+	})
 	if err != nil {
-		storageError("Round store error", err, w)
+		storageError(err, w)
 		return
 	}
 
 	sendResponse(w, struct {
-		Response string `json:"response"`
+		Response  string `json:"response"`
+		Pseudonym string `json:"pseudonym,omitempty"`
 	}{
-		Response: res,
+		Response:  res,
+		Pseudonym: round.Pseudonym(input.Player),
 	})
 	log.Printf("round: %s: %s attached", round.ID, input.Player)
 
@@ -193,9 +376,11 @@ func Attach(w http.ResponseWriter, req *http.Request) {
 func Bet(w http.ResponseWriter, req *http.Request) {
 
 	input := struct {
-		Round  string `json:"round"`
-		Player string `json:"player"`
-		Bet    string `json:"bet"`
+		Round   string `json:"round"`
+		Player  string `json:"player"`
+		Bet     string `json:"bet"`
+		Sealed  string `json:"sealed"`
+		Gesture string `json:"gesture"`
 	}{}
 	if err := getInput(req, &input); err != nil {
 		log.Print(err)
@@ -203,31 +388,28 @@ func Bet(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if input.Round == "" || input.Player == "" || input.Bet == "" {
+	if input.Round == "" || input.Player == "" || input.Bet == "" && input.Gesture == "" {
 		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
 		log.Println(errMsg)
 		http.Error(w, errMsg, http.StatusBadRequest)
 		return
 	}
 
-	round, err := db.Retrieve(input.Round)
-	if err != nil {
-		storageError("Round retrieve error", err, w)
-		return
-	}
-
-	res := round.Bet(input.Bet, input.Player)
-
-	err = db.Store(round)
+	secret := ""
+	round, res, err := play(input.Round, true, func(round *Round) string {
+		return placeBet(round, input.Bet, input.Sealed, input.Gesture, input.Player, &secret)
+	})
 	if err != nil {
-		storageError("Round store error", err, w)
+		storageError(err, w)
 		return
 	}
 
 	sendResponse(w, struct {
 		Response string `json:"response"`
+		Secret   string `json:"secret,omitempty"`
 	}{
 		Response: res,
+		Secret:   secret,
 	})
 	log.Printf("round: %s:%s - bet result: %s", round.ID, input.Player, res)
 }
@@ -254,26 +436,64 @@ func Disclose(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	round, err := db.Retrieve(input.Round)
+	round, res, err := play(input.Round, true, func(round *Round) string {
+		return round.Disclose(input.Secret, input.Bet, input.Player)
+	})
 	if err != nil {
-		storageError("Round retrieve error", err, w)
+		storageError(err, w)
 		return
 	}
 
-	res := round.Disclose(input.Secret, input.Bet, input.Player)
+	sendResponse(w, struct {
+		Response string      `json:"response"`
+		Next     string      `json:"next,omitempty"`
+		House    *HouseProof `json:"house,omitempty"`
+	}{
+		Response: res,
+		Next:     round.NextLinked(input.Player),
+		House:    round.HouseProof(input.Player),
+	})
+	log.Printf("round: %s:%s - disclose result: %s", round.ID, input.Player, res)
+}
+
+// Cancel realizes the request for cancel of round before the bets. The escrowed stakes are refunded.
+func Cancel(w http.ResponseWriter, req *http.Request) {
+
+	input := struct {
+		Round  string `json:"round"`
+		Player string `json:"player"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.Round == "" || input.Player == "" {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
 
-	err = db.Store(round)
+	round, res, err := play(input.Round, true, func(round *Round) string {
+		return round.Cancel(input.Player)
+	})
 	if err != nil {
-		storageError("Round store error", err, w)
+		storageError(err, w)
 		return
 	}
+	// the repeated request retries the refund
+	if res == msgCancelled {
+		if err := settleStakes(round, false); err != nil {
+			log.Printf("round: %s - %v", round.ID, err)
+		}
+	}
 
 	sendResponse(w, struct {
 		Response string `json:"response"`
-	}{
-		Response: res,
-	})
-	log.Printf("round: %s:%s - disclose result: %s", round.ID, input.Player, res)
+	}{res})
+	log.Printf("round: %s:%s - cancel result: %s", round.ID, input.Player, res)
 }
 
 // Result realizes the request for result of round
@@ -297,23 +517,346 @@ func Result(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	round, err := db.Retrieve(input.Round)
+	round, res, err := play(input.Round, false, func(round *Round) string {
+		return round.Result(input.Player)
+	})
 	if err != nil {
-		storageError("Round retrieve error", err, w)
+		storageError(err, w)
 		return
 	}
 
-	res := round.Result(input.Player)
-
 	sendResponse(w, struct {
-		Response string `json:"response"`
+		Response   string          `json:"response"`
+		Timeline   *PlayerTimeline `json:"timeline,omitempty"`
+		Points     *PlayerPoints   `json:"points,omitempty"`
+		Next       string          `json:"next,omitempty"`
+		House      *HouseProof     `json:"house,omitempty"`
+		Substitute bool            `json:"substitute,omitempty"`
+		Stake      int64           `json:"stake,omitempty"`
 	}{
-		Response: res,
+		Response:   res,
+		Timeline:   round.PlayerTimeline(input.Player),
+		Points:     round.PlayerPoints(input.Player),
+		Next:       round.NextLinked(input.Player),
+		House:      round.HouseProof(input.Player),
+		Substitute: round.Substituted(),
+		Stake:      round.PlayerStake(),
 	})
 	log.Printf("round: %s:%s - result: %s", round.ID, input.Player, res)
 }
 
-func storageError(msg string, err error, w http.ResponseWriter) {
-	log.Printf("%s: %v", msg, err)
+// Keys publishes the public keys of the service
+func Keys(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, err := sealKeys.Current()
+	if err != nil {
+		storageError(fmt.Errorf("Seal key error: %w", err), w)
+		return
+	}
+
+	type publicKey struct {
+		ID      string     `json:"id"`
+		Public  string     `json:"public"`
+		Expires *time.Time `json:"expires,omitempty"`
+	}
+
+	expires := key.Expires.UTC()
+	transcript := []publicKey{}
+	for id := range ring.keys {
+		tKey, _ := transcriptKey(id)
+		pk := publicKey{ID: id, Public: encode64(tKey.Public().(ed25519.PublicKey))}
+		if id == ring.active {
+			// the key used for new transcripts goes first
+			transcript = append([]publicKey{pk}, transcript...)
+		} else {
+			transcript = append(transcript, pk)
+		}
+	}
+
+	sendResponse(w, struct {
+		Seal       publicKey   `json:"seal"`
+		Transcript []publicKey `json:"transcript"`
+	}{
+		Seal: publicKey{
+			ID:      key.ID,
+			Public:  encode64(key.Public[:]),
+			Expires: &expires,
+		},
+		Transcript: transcript,
+	})
+}
+
+// Rounds realizes the requests for the round resources: /rounds/{id}/{resource}
+func Rounds(w http.ResponseWriter, req *http.Request) {
+	path := strings.Split(strings.TrimPrefix(req.URL.Path, "/rounds/"), "/")
+	if len(path) != 2 || path[0] == "" {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != "GET" {
+		http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	switch path[1] {
+	case "transcript":
+		RoundTranscript(w, path[0])
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// RoundTranscript realizes the request for the signed transcript of finished round
+func RoundTranscript(w http.ResponseWriter, id string) {
+	var transcript *Transcript
+	_, res, err := play(id, false, func(round *Round) string {
+		t, res := round.Transcript()
+		transcript = t
+		return res
+	})
+	if err != nil {
+		storageError(err, w)
+		return
+	}
+	if res != "" {
+		log.Printf("round: %s - transcript error: %s", id, res)
+		http.Error(w, res, http.StatusConflict)
+		return
+	}
+	sendResponse(w, SignTranscript(transcript))
+}
+
+// placeBet makes the bet in the mode selected by provided parameters: the server-assisted bet when the open
+// gesture is provided, the bet with sealed disclosure when it is provided, or the hidden bet only.
+// The secret generated for server-assisted bet is returned via secret.
+func placeBet(round *Round, bet, sealed, gesture, player string, secret *string) string {
+	switch {
+	case gesture != "":
+		res, s := round.AssistedBet(gesture, player)
+		*secret = s
+		return res
+	case sealed != "":
+		return round.SealedBet(bet, sealed, player)
+	default:
+		return round.Bet(bet, player)
+	}
+}
+
+// Log realizes the requests to transparency log:
+// /log/sth[?tree_size=<size>] - the signed tree head (the current one or the head of size signed before),
+// /log/inclusion?round=<round id>[&tree_size=<size>] - the inclusion proof of round,
+// /log/consistency?first=<size1>&second=<size2> - the consistency proof between tree heads.
+func Log(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	sizes := map[string]int64{}
+	for _, name := range []string{"tree_size", "first", "second"} {
+		if val := query.Get(name); val != "" {
+			size, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || size < 0 {
+				http.Error(w, fmt.Sprintf("wrong %s: %s", name, val), http.StatusBadRequest)
+				return
+			}
+			sizes[name] = size
+		}
+	}
+	switch strings.TrimPrefix(req.URL.Path, "/log/") {
+	case "sth":
+		var sth *TreeHead
+		var err error
+		if size := sizes["tree_size"]; size > 0 {
+			sth, err = tlog.TreeHead(size)
+		} else {
+			sth, err = SignedTreeHead(tlog)
+		}
+		if errors.Is(err, redis.Nil) {
+			http.Error(w, "tree head of requested size wasn't signed", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			storageError(fmt.Errorf("Transparency log error: %w", err), w)
+			return
+		}
+		sendResponse(w, sth)
+	case "inclusion":
+		round := query.Get("round")
+		if round == "" {
+			http.Error(w, "Some mandatory parameters are missed: round", http.StatusBadRequest)
+			return
+		}
+		idx, entry, path, size, err := InclusionProof(tlog, round, sizes["tree_size"])
+		if errors.Is(err, redis.Nil) {
+			http.Error(w, "round is not in the log", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Transparency log error: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sendResponse(w, struct {
+			LeafIndex int64    `json:"leaf_index"`
+			TreeSize  int64    `json:"tree_size"`
+			Entry     []byte   `json:"entry"`
+			AuditPath [][]byte `json:"audit_path"`
+		}{idx, size, entry, path})
+	case "consistency":
+		proof, err := ConsistencyProof(tlog, sizes["first"], sizes["second"])
+		if err != nil {
+			log.Printf("Transparency log error: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sendResponse(w, struct {
+			Consistency [][]byte `json:"consistency"`
+		}{proof})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// AdminRounds returns the handler of administrator's requests for the round resources:
+// GET /admin/rounds/{id}/events - the events of round (only in the event-sourced storage mode)
+func AdminRounds(d Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		path := strings.Split(strings.TrimPrefix(req.URL.Path, "/admin/rounds/"), "/")
+		store, ok := d.(RoundEvents)
+		if !ok || len(path) != 2 || path[0] == "" || path[1] != "events" {
+			http.NotFound(w, req)
+			return
+		}
+		if req.Method != "GET" {
+			http.Error(w, fmt.Sprintf("wrong method: %s", req.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		events, err := store.Events(path[0])
+		if errors.Is(err, redis.Nil) {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			storageError(fmt.Errorf("Round events error: %w", err), w)
+			return
+		}
+		sendResponse(w, struct {
+			Events []RoundEvent `json:"events"`
+		}{events})
+	}
+}
+
+// startRound creates a new round of game started by player and stores it. The bot opponent attaches
+// the round and places its bet before the round is stored.
+func startRound(player string, opt RoundOptions) (*Round, error) {
+	round, err := NewRoundWithOptions(player, opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := botPlay(round); err != nil {
+		return nil, err
+	}
+	if err := db.Store(round); err != nil {
+		return nil, fmt.Errorf("Round store error: %w", err)
+	}
+	return round, nil
+}
+
+// retrieve retrieves the round. The quarantined round is reported with errQuarantined.
+func retrieve(id string) (*Round, error) {
+	round, err := db.Retrieve(id)
+	if errors.Is(err, redis.Nil) && tamper != nil {
+		if quarantined, qErr := tamper.Quarantined(id); qErr == nil && quarantined {
+			err = errQuarantined
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Round retrieve error: %w", err)
+	}
+	return round, nil
+}
+
+// play retrieves the round, makes the move and stores the changed round when store is true.
+// The fallback bot attaches the round before the move when the wait of rival is over, then the round is stored anyway.
+// The falsified round is quarantined instead of storing.
+// It is the common part of HTTP and gRPC requests processing.
+func play(id string, store bool, move func(round *Round) string) (*Round, string, error) {
+	round, err := retrieve(id)
+	if err != nil {
+		return nil, "", err
+	}
+	round, substituted, err := substitute(round)
+	if err != nil {
+		return nil, "", err
+	}
+	res := move(round)
+	if res == msgFalsificated {
+		reportTamper(round)
+		return round, res, nil
+	}
+	if res == msgUnknownKey {
+		// the round isn't falsified: its server key was removed from the key ring
+		log.Printf("round: %s - %s: %q", round.ID, res, round.KeyID)
+		return round, res, nil
+	}
+	// the finished round is stored as resolving until its resolution hooks are completed, so the hooks
+	// are run again by the next request to the round when the service fails in the middle
+	resolving := round.claimResolution()
+	if store || substituted || resolving {
+		if resolving {
+			if err = storeReplay(round); err != nil {
+				// the round is read from db again, so the resolution is repeated by the next request
+				evictRound(round.ID)
+				return nil, "", err
+			}
+		}
+		if err = db.Store(round); err != nil {
+			// the round is read from db again, so the move that isn't stored is dropped
+			evictRound(round.ID)
+			return nil, "", fmt.Errorf("Round store error: %w", err)
+		}
+		if resolving {
+			onResolved(round)
+			round.completeResolution()
+			if err = db.Store(round); err != nil {
+				evictRound(round.ID)
+				log.Printf("round: %s - resolved round store error: %v", round.ID, err)
+			}
+		}
+	}
+	return round, res, nil
+}
+
+// onResolved is called when the round gets the result. It is called again when the service fails before
+// the resolved round is stored, so the hooks have to be idempotent. It adds the round points to the league, settles
+// the stakes, adds the human's move to its history against bots and appends the round transcript to transparency log.
+// The replay of round that ended in a draw is stored before the round.
+func onResolved(round *Round) {
+	creditLeague(round)
+	if err := settleStakes(round, false); err != nil {
+		log.Printf("round: %s - %v", round.ID, err)
+	}
+	learnBot(round)
+	if tlog == nil {
+		return
+	}
+	t, res := round.Transcript()
+	if res != "" {
+		log.Printf("round: %s - transcript error: %s", round.ID, res)
+		return
+	}
+	appendTranscript(t)
+}
+
+func storageError(err error, w http.ResponseWriter) {
+	log.Println(err)
+	if errors.Is(err, errQuarantined) {
+		http.Error(w, err.Error(), http.StatusLocked)
+		return
+	}
 	http.Error(w, err.Error(), http.StatusInternalServerError)
 }
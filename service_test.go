@@ -108,6 +108,10 @@ func Test_serviceFullGame(t *testing.T) {
 	envSet(t) // load .env file for test environment
 	defer stopService(startService(t))
 
+	// fixed server time for predictable timeline
+	defer func(prev func() time.Time) { now = prev }(now)
+	now = func() time.Time { return time.UnixMilli(1000) }
+
 	player1 := "player1"
 	player2 := "player2"
 
@@ -137,7 +141,7 @@ func Test_serviceFullGame(t *testing.T) {
 
 	data, err = request("attach", req)
 
-	require.Equal(t, `{"response":"place Your bet, please"}`, string(data))
+	require.Contains(t, string(data), `{"response":"place Your bet, please","pseudonym":"`)
 
 	// place bets
 	req, _ = json.Marshal(struct {
@@ -180,7 +184,8 @@ func Test_serviceFullGame(t *testing.T) {
 
 	data, err = request("result", req)
 
-	require.Equal(t, `{"response":"disclose your bet, please"}`, string(data))
+	require.Equal(t, `{"response":"disclose your bet, please",`+
+		`"timeline":{"created":1000,"attached":1000,"your_bet":1000,"rival_bet":1000}}`, string(data))
 
 	// Disclose
 	req, _ = json.Marshal(struct {
@@ -227,7 +232,48 @@ func Test_serviceFullGame(t *testing.T) {
 
 	data, err = request("result", req)
 
-	require.Equal(t, `{"response":"You won: your bet: paper, the rival's bet: stone"}`, string(data))
+	require.Equal(t, `{"response":"You won: your bet: paper, the rival's bet: stone",`+
+		`"timeline":{"created":1000,"attached":1000,"your_bet":1000,"rival_bet":1000,`+
+		`"your_disclose":1000,"rival_disclose":1000,"resolved":1000},"points":{"your":1,"rival":0}}`, string(data))
+}
+
+func Test_serviceAssistedBets(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+	defer func() { sealKeys = nil }()
+
+	data, err := request("new", []byte(`{"player":"player1"}`))
+	require.NoError(t, err)
+	res := struct {
+		Round string `json:"round"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &res))
+
+	_, err = request("attach", []byte(`{"player":"player2","round":"`+res.Round+`"}`))
+	require.NoError(t, err)
+
+	bet := struct {
+		Response string `json:"response"`
+		Secret   string `json:"secret"`
+	}{}
+	data, err = request("bet", []byte(`{"player":"player1","round":"`+res.Round+`","gesture":"stone"}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &bet))
+	require.Equal(t, "wait for the rival to place its bet", bet.Response)
+	require.NotEmpty(t, bet.Secret)
+
+	data, err = request("bet", []byte(`{"player":"player2","round":"`+res.Round+`","gesture":"scissors"}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &bet))
+	require.Equal(t, "You lose: your bet: scissors, the rival's bet: stone", bet.Response)
+	require.NotEmpty(t, bet.Secret)
+
+	round, err := db.Retrieve(res.Round)
+	require.NoError(t, err)
+	require.Equal(t, modeAssisted, round.Mode1)
+	require.Equal(t, modeAssisted, round.Mode2)
+	// the player can check the commitment by received secret
+	require.Equal(t, saltedHash(bet.Secret, "scissors"), round.HiddenBet2)
 }
 
 func Test_BadRequests(t *testing.T) {
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Spectators watch the round without playing it. The spectator's view has the round phase and timing, but it never
+// has the hidden bets; the open bets are shown only when the round is finished. The spectator token is checked
+// separately from the players' tokens, so it doesn't give any access to the round actions.
+
+const (
+	spectatorsPublic = "public" // anybody knowing the round id can watch the round
+	spectatorsToken  = "token"  // only the holders of spectator token can watch the round
+)
+
+// SpectatorView is the public view of round for spectators
+type SpectatorView struct {
+	Round    string    `json:"round"`              // round id
+	Game     string    `json:"game,omitempty"`     // game name, empty - stone scissors paper
+	State    State     `json:"state"`              // round phase
+	Timeline *Timeline `json:"timeline,omitempty"` // server times of round events
+	Bet1     string    `json:"bet1,omitempty"`     // gesture of player1 resolved by the game, only in finished round
+	Bet2     string    `json:"bet2,omitempty"`     // gesture of player2 resolved by the game, only in finished round
+	Winner   string    `json:"winner,omitempty"`   // 'first'|'second'|'draw', only in finished round
+}
+
+// checkSpectators checks the spectators option of new round
+func checkSpectators(spectators string) error {
+	switch spectators {
+	case "", spectatorsPublic, spectatorsToken:
+		return nil
+	}
+	return fmt.Errorf("unknown spectators: %q", spectators)
+}
+
+// spectatorHash returns the hash of spectator token. The linked rounds share the spectator token.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) spectatorHash(token string) string {
+	return keyHash(r.HashKeyID, "spectator:"+r.hashID(), token)
+}
+
+// setSpectators allows spectators to watch the round. It returns the spectator token for the token access.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) setSpectators(spectators string) string {
+	r.Spectators = spectators
+	if spectators != spectatorsToken {
+		return ""
+	}
+	token := newSecret()
+	r.Spectator = r.spectatorHash(token)
+	return token
+}
+
+// SpectatorToken returns the spectator token of new round, it is empty when the round has no token access
+func (r *Round) SpectatorToken() string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.specToken
+}
+
+// Spectate returns the spectator's view of round. It returns the error message when the round can't be watched
+// with the token.
+func (r *Round) Spectate(token string) (*SpectatorView, string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if res := r.signatureError(); res != "" {
+		return nil, res
+	}
+	switch r.Spectators {
+	case spectatorsPublic:
+	case spectatorsToken:
+		if subtle.ConstantTimeCompare([]byte(r.spectatorHash(token)), []byte(r.Spectator)) != 1 {
+			return nil, msgUnauthorized
+		}
+	default:
+		return nil, "spectators are not allowed"
+	}
+	v := &SpectatorView{Round: r.ID, Game: r.Game, State: r.state(), Timeline: r.copyTimeline()}
+	if v.State == StateFinished {
+		bet1, bet2 := r.moves()
+		v.Bet1, v.Bet2, v.Winner = bet1.String(), bet2.String(), winners[r.Winner]
+	}
+	return v, ""
+}
+
+// spectate retrieves the round and returns its spectator's view. The round is not changed and not stored.
+// It is the common part of HTTP and gRPC requests processing.
+func spectate(id, token string) (*SpectatorView, string, error) {
+	round, err := retrieve(id)
+	if err != nil {
+		return nil, "", err
+	}
+	view, res := round.Spectate(token)
+	if res == msgFalsificated {
+		reportTamper(round)
+	}
+	return view, res, nil
+}
+
+// Spectate realizes the spectator's request for the round view
+func Spectate(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		Round string `json:"round"`
+		Token string `json:"token"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.Round == "" {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	view, res, err := spectate(input.Round, input.Token)
+	if err != nil {
+		storageError(err, w)
+		return
+	}
+	if view == nil {
+		sendResponse(w, struct {
+			Response string `json:"response"`
+		}{res})
+		return
+	}
+	sendResponse(w, view)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test1_Spectate(t *testing.T) {
+	_, err := NewRoundWithOptions("player1", RoundOptions{Spectators: "everybody"})
+	require.EqualError(t, err, `unknown spectators: "everybody"`)
+
+	tr, err := NewRoundWithOptions("player1", RoundOptions{})
+	require.NoError(t, err)
+	require.Empty(t, tr.SpectatorToken())
+	_, res := tr.Spectate("")
+	require.Equal(t, "spectators are not allowed", res)
+
+	tr, err = NewRoundWithOptions("player1", RoundOptions{Spectators: spectatorsToken, ReplayOnDraw: true})
+	require.NoError(t, err)
+	token := tr.SpectatorToken()
+	require.NotEmpty(t, token)
+	for _, wrong := range []string{"", "player1", "wrong"} {
+		_, res = tr.Spectate(wrong)
+		require.Equal(t, msgUnauthorized, res)
+	}
+	view, res := tr.Spectate(token)
+	require.Empty(t, res)
+	require.Equal(t, StateOpen, view.State)
+
+	// the spectator doesn't get any player's access
+	tr.Attach("player2")
+	require.Equal(t, msgUnauthorized, tr.Result(token))
+	require.Equal(t, msgUnauthorized, tr.Bet(tr.saltedHash("s3", []byte("paper")), token))
+
+	// the gestures are hidden until the round is finished
+	tr.Bet(tr.saltedHash("s1", []byte("stone")), "player1")
+	tr.Bet(tr.saltedHash("s2", []byte("stone")), "player2")
+	tr.Disclose("s1", "stone", "player1")
+	view, _ = tr.Spectate(token)
+	require.Equal(t, StateDisclosing, view.State)
+	require.NotZero(t, view.Timeline.Disclose1)
+	// the view has the copy of timeline that isn't changed by the following actions
+	require.NotSame(t, tr.Times, view.Timeline)
+	require.Empty(t, view.Bet1+view.Bet2+view.Winner)
+	data, err := json.Marshal(view)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), tr.HiddenBet1)
+	require.NotContains(t, string(data), "stone")
+
+	tr.Disclose("s2", "stone", "player2")
+	view, _ = tr.Spectate(token)
+	require.Equal(t, SpectatorView{Round: tr.ID, State: StateFinished, Timeline: tr.Times, Bet1: "stone",
+		Bet2: "stone", Winner: "draw"}, *view)
+
+	// the replay has the same spectator token
+	replay := tr.Replay()
+	_, res = replay.Spectate(token)
+	require.Empty(t, res)
+
+	tr.Spectators = spectatorsPublic
+	_, res = tr.Spectate("")
+	require.Equal(t, msgFalsificated, res)
+}
+
+func Test2_SpectateService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	data, err := request("new", []byte(`{"player":"s1","spectators":"token"}`))
+	require.NoError(t, err)
+	created := struct {
+		Round          string `json:"round"`
+		SpectatorToken string `json:"spectator_token"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &created))
+	require.NotEmpty(t, created.SpectatorToken)
+
+	data, err = request("spectate", []byte(fmt.Sprintf(`{"round":%q,"token":"wrong"}`, created.Round)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"unauthorized"}`, string(data))
+	data, err = request("spectate", []byte(fmt.Sprintf(`{"round":%q,"token":%q}`, created.Round,
+		created.SpectatorToken)))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"state":"open"`)
+
+	data, err = request("new", []byte(`{"player":"s1","spectators":"everybody"}`))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `unknown spectators: "everybody"`)
+
+	// the gRPC spectator gets the changes until the round is finished
+	c := grpcClient(t)
+	ctx := context.Background()
+	nr, err := c.NewRound(ctx, &NewRoundRequest{Player: "s1", Spectators: spectatorsPublic})
+	require.NoError(t, err)
+	require.Empty(t, nr.SpectatorToken)
+	watch, err := c.Spectate(ctx, &SpectateRequest{Round: nr.Round})
+	require.NoError(t, err)
+	_, err = c.Attach(ctx, &AttachRequest{Round: nr.Round, Player: "s2"})
+	require.NoError(t, err)
+	_, err = c.Bet(ctx, &BetRequest{Round: nr.Round, Player: "s1", Bet: saltedHash("s1", "paper")})
+	require.NoError(t, err)
+	_, err = c.Bet(ctx, &BetRequest{Round: nr.Round, Player: "s2", Bet: saltedHash("s2", "stone")})
+	require.NoError(t, err)
+	_, err = c.Disclose(ctx, &DiscloseRequest{Round: nr.Round, Player: "s1", Secret: "s1", Bet: "paper"})
+	require.NoError(t, err)
+	_, err = c.Disclose(ctx, &DiscloseRequest{Round: nr.Round, Player: "s2", Secret: "s2", Bet: "stone"})
+	require.NoError(t, err)
+	var last *SpectateResponse
+	for {
+		r, err := watch.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if r.State != string(StateFinished) {
+			require.Empty(t, r.Bet1+r.Bet2+r.Winner)
+		}
+		last = r
+	}
+	require.Equal(t, string(StateFinished), last.State)
+	require.Equal(t, "paper", last.Bet1)
+	require.Equal(t, "stone", last.Bet2)
+	require.Equal(t, "first", last.Winner)
+
+	// the round without spectators can't be watched
+	nr, err = c.NewRound(ctx, &NewRoundRequest{Player: "s1"})
+	require.NoError(t, err)
+	watch, err = c.Spectate(ctx, &SpectateRequest{Round: nr.Round})
+	require.NoError(t, err)
+	_, err = watch.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
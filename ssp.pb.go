@@ -0,0 +1,1150 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        (unknown)
+// source: ssp.proto
+
+package main
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type NewRoundRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Player     string `protobuf:"bytes,1,opt,name=player,proto3" json:"player,omitempty"`         // identification for first player
+	Game       string `protobuf:"bytes,2,opt,name=game,proto3" json:"game,omitempty"`             // game name: rps (default), pennies, odd-even
+	Spectators string `protobuf:"bytes,3,opt,name=spectators,proto3" json:"spectators,omitempty"` // public|token - spectators can watch the round, empty - no spectators
+}
+
+func (x *NewRoundRequest) Reset() {
+	*x = NewRoundRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NewRoundRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NewRoundRequest) ProtoMessage() {}
+
+func (x *NewRoundRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NewRoundRequest.ProtoReflect.Descriptor instead.
+func (*NewRoundRequest) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *NewRoundRequest) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *NewRoundRequest) GetGame() string {
+	if x != nil {
+		return x.Game
+	}
+	return ""
+}
+
+func (x *NewRoundRequest) GetSpectators() string {
+	if x != nil {
+		return x.Spectators
+	}
+	return ""
+}
+
+type NewRoundResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Round          string `protobuf:"bytes,1,opt,name=round,proto3" json:"round,omitempty"`                                         // round id
+	SpectatorToken string `protobuf:"bytes,2,opt,name=spectator_token,json=spectatorToken,proto3" json:"spectator_token,omitempty"` // token of spectators for the token access
+	Pseudonym      string `protobuf:"bytes,3,opt,name=pseudonym,proto3" json:"pseudonym,omitempty"`                                 // player's pseudonym that binds the v2 commitments
+}
+
+func (x *NewRoundResponse) Reset() {
+	*x = NewRoundResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NewRoundResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NewRoundResponse) ProtoMessage() {}
+
+func (x *NewRoundResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NewRoundResponse.ProtoReflect.Descriptor instead.
+func (*NewRoundResponse) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *NewRoundResponse) GetRound() string {
+	if x != nil {
+		return x.Round
+	}
+	return ""
+}
+
+func (x *NewRoundResponse) GetSpectatorToken() string {
+	if x != nil {
+		return x.SpectatorToken
+	}
+	return ""
+}
+
+func (x *NewRoundResponse) GetPseudonym() string {
+	if x != nil {
+		return x.Pseudonym
+	}
+	return ""
+}
+
+type AttachRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Round  string `protobuf:"bytes,1,opt,name=round,proto3" json:"round,omitempty"`   // round id
+	Player string `protobuf:"bytes,2,opt,name=player,proto3" json:"player,omitempty"` // identification of second player
+}
+
+func (x *AttachRequest) Reset() {
+	*x = AttachRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AttachRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AttachRequest) ProtoMessage() {}
+
+func (x *AttachRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AttachRequest.ProtoReflect.Descriptor instead.
+func (*AttachRequest) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AttachRequest) GetRound() string {
+	if x != nil {
+		return x.Round
+	}
+	return ""
+}
+
+func (x *AttachRequest) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+type BetRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Round   string `protobuf:"bytes,1,opt,name=round,proto3" json:"round,omitempty"`     // round id
+	Player  string `protobuf:"bytes,2,opt,name=player,proto3" json:"player,omitempty"`   // identification of player that places the bet
+	Bet     string `protobuf:"bytes,3,opt,name=bet,proto3" json:"bet,omitempty"`         // hidden bet
+	Sealed  string `protobuf:"bytes,4,opt,name=sealed,proto3" json:"sealed,omitempty"`   // optional sealed disclosure of bet
+	Gesture string `protobuf:"bytes,5,opt,name=gesture,proto3" json:"gesture,omitempty"` // open bet for server-assisted bet (instead of hidden bet)
+}
+
+func (x *BetRequest) Reset() {
+	*x = BetRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BetRequest) ProtoMessage() {}
+
+func (x *BetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BetRequest.ProtoReflect.Descriptor instead.
+func (*BetRequest) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BetRequest) GetRound() string {
+	if x != nil {
+		return x.Round
+	}
+	return ""
+}
+
+func (x *BetRequest) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *BetRequest) GetBet() string {
+	if x != nil {
+		return x.Bet
+	}
+	return ""
+}
+
+func (x *BetRequest) GetSealed() string {
+	if x != nil {
+		return x.Sealed
+	}
+	return ""
+}
+
+func (x *BetRequest) GetGesture() string {
+	if x != nil {
+		return x.Gesture
+	}
+	return ""
+}
+
+type DiscloseRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Round  string `protobuf:"bytes,1,opt,name=round,proto3" json:"round,omitempty"`   // round id
+	Player string `protobuf:"bytes,2,opt,name=player,proto3" json:"player,omitempty"` // identification of player that discloses the bet
+	Secret string `protobuf:"bytes,3,opt,name=secret,proto3" json:"secret,omitempty"` // secret that was used for preparing the hidden bet
+	Bet    string `protobuf:"bytes,4,opt,name=bet,proto3" json:"bet,omitempty"`       // open bet
+}
+
+func (x *DiscloseRequest) Reset() {
+	*x = DiscloseRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DiscloseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiscloseRequest) ProtoMessage() {}
+
+func (x *DiscloseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiscloseRequest.ProtoReflect.Descriptor instead.
+func (*DiscloseRequest) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DiscloseRequest) GetRound() string {
+	if x != nil {
+		return x.Round
+	}
+	return ""
+}
+
+func (x *DiscloseRequest) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *DiscloseRequest) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *DiscloseRequest) GetBet() string {
+	if x != nil {
+		return x.Bet
+	}
+	return ""
+}
+
+type ResultRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Round  string `protobuf:"bytes,1,opt,name=round,proto3" json:"round,omitempty"`   // round id
+	Player string `protobuf:"bytes,2,opt,name=player,proto3" json:"player,omitempty"` // identification of player that asks for result
+}
+
+func (x *ResultRequest) Reset() {
+	*x = ResultRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ResultRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResultRequest) ProtoMessage() {}
+
+func (x *ResultRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResultRequest.ProtoReflect.Descriptor instead.
+func (*ResultRequest) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ResultRequest) GetRound() string {
+	if x != nil {
+		return x.Round
+	}
+	return ""
+}
+
+func (x *ResultRequest) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+type RoundResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Response  string         `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`   // the same value as in HTTP API responses
+	Secret    string         `protobuf:"bytes,2,opt,name=secret,proto3" json:"secret,omitempty"`       // the secret generated for server-assisted bet
+	Timeline  *RoundTimeline `protobuf:"bytes,3,opt,name=timeline,proto3" json:"timeline,omitempty"`   // the round timeline for requester (in Result and WatchRound responses)
+	Pseudonym string         `protobuf:"bytes,4,opt,name=pseudonym,proto3" json:"pseudonym,omitempty"` // player's pseudonym that binds the v2 commitments (in Attach response)
+}
+
+func (x *RoundResponse) Reset() {
+	*x = RoundResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RoundResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoundResponse) ProtoMessage() {}
+
+func (x *RoundResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoundResponse.ProtoReflect.Descriptor instead.
+func (*RoundResponse) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RoundResponse) GetResponse() string {
+	if x != nil {
+		return x.Response
+	}
+	return ""
+}
+
+func (x *RoundResponse) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *RoundResponse) GetTimeline() *RoundTimeline {
+	if x != nil {
+		return x.Timeline
+	}
+	return nil
+}
+
+func (x *RoundResponse) GetPseudonym() string {
+	if x != nil {
+		return x.Pseudonym
+	}
+	return ""
+}
+
+// RoundTimeline is the server times of round events (Unix time in milliseconds, 0 - the event didn't happen)
+type RoundTimeline struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Created       int64 `protobuf:"varint,1,opt,name=created,proto3" json:"created,omitempty"`
+	Attached      int64 `protobuf:"varint,2,opt,name=attached,proto3" json:"attached,omitempty"`
+	YourBet       int64 `protobuf:"varint,3,opt,name=your_bet,json=yourBet,proto3" json:"your_bet,omitempty"`
+	RivalBet      int64 `protobuf:"varint,4,opt,name=rival_bet,json=rivalBet,proto3" json:"rival_bet,omitempty"`
+	YourDisclose  int64 `protobuf:"varint,5,opt,name=your_disclose,json=yourDisclose,proto3" json:"your_disclose,omitempty"`
+	RivalDisclose int64 `protobuf:"varint,6,opt,name=rival_disclose,json=rivalDisclose,proto3" json:"rival_disclose,omitempty"`
+	Resolved      int64 `protobuf:"varint,7,opt,name=resolved,proto3" json:"resolved,omitempty"`
+}
+
+func (x *RoundTimeline) Reset() {
+	*x = RoundTimeline{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RoundTimeline) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoundTimeline) ProtoMessage() {}
+
+func (x *RoundTimeline) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoundTimeline.ProtoReflect.Descriptor instead.
+func (*RoundTimeline) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *RoundTimeline) GetCreated() int64 {
+	if x != nil {
+		return x.Created
+	}
+	return 0
+}
+
+func (x *RoundTimeline) GetAttached() int64 {
+	if x != nil {
+		return x.Attached
+	}
+	return 0
+}
+
+func (x *RoundTimeline) GetYourBet() int64 {
+	if x != nil {
+		return x.YourBet
+	}
+	return 0
+}
+
+func (x *RoundTimeline) GetRivalBet() int64 {
+	if x != nil {
+		return x.RivalBet
+	}
+	return 0
+}
+
+func (x *RoundTimeline) GetYourDisclose() int64 {
+	if x != nil {
+		return x.YourDisclose
+	}
+	return 0
+}
+
+func (x *RoundTimeline) GetRivalDisclose() int64 {
+	if x != nil {
+		return x.RivalDisclose
+	}
+	return 0
+}
+
+func (x *RoundTimeline) GetResolved() int64 {
+	if x != nil {
+		return x.Resolved
+	}
+	return 0
+}
+
+type SpectateRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Round string `protobuf:"bytes,1,opt,name=round,proto3" json:"round,omitempty"` // round id
+	Token string `protobuf:"bytes,2,opt,name=token,proto3" json:"token,omitempty"` // spectator token, it is not needed for the public access
+}
+
+func (x *SpectateRequest) Reset() {
+	*x = SpectateRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SpectateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpectateRequest) ProtoMessage() {}
+
+func (x *SpectateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpectateRequest.ProtoReflect.Descriptor instead.
+func (*SpectateRequest) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SpectateRequest) GetRound() string {
+	if x != nil {
+		return x.Round
+	}
+	return ""
+}
+
+func (x *SpectateRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+// SpectateResponse is the spectator's view of round, the gestures are shown only in finished round
+type SpectateResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Round    string             `protobuf:"bytes,1,opt,name=round,proto3" json:"round,omitempty"` // round id
+	Game     string             `protobuf:"bytes,2,opt,name=game,proto3" json:"game,omitempty"`   // game name, empty - rps
+	State    string             `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"` // round phase
+	Timeline *SpectatorTimeline `protobuf:"bytes,4,opt,name=timeline,proto3" json:"timeline,omitempty"`
+	Bet1     string             `protobuf:"bytes,5,opt,name=bet1,proto3" json:"bet1,omitempty"`     // gesture of player1
+	Bet2     string             `protobuf:"bytes,6,opt,name=bet2,proto3" json:"bet2,omitempty"`     // gesture of player2
+	Winner   string             `protobuf:"bytes,7,opt,name=winner,proto3" json:"winner,omitempty"` // first|second|draw
+}
+
+func (x *SpectateResponse) Reset() {
+	*x = SpectateResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SpectateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpectateResponse) ProtoMessage() {}
+
+func (x *SpectateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpectateResponse.ProtoReflect.Descriptor instead.
+func (*SpectateResponse) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SpectateResponse) GetRound() string {
+	if x != nil {
+		return x.Round
+	}
+	return ""
+}
+
+func (x *SpectateResponse) GetGame() string {
+	if x != nil {
+		return x.Game
+	}
+	return ""
+}
+
+func (x *SpectateResponse) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *SpectateResponse) GetTimeline() *SpectatorTimeline {
+	if x != nil {
+		return x.Timeline
+	}
+	return nil
+}
+
+func (x *SpectateResponse) GetBet1() string {
+	if x != nil {
+		return x.Bet1
+	}
+	return ""
+}
+
+func (x *SpectateResponse) GetBet2() string {
+	if x != nil {
+		return x.Bet2
+	}
+	return ""
+}
+
+func (x *SpectateResponse) GetWinner() string {
+	if x != nil {
+		return x.Winner
+	}
+	return ""
+}
+
+// SpectatorTimeline is the server times of round events (Unix time in milliseconds, 0 - the event didn't happen)
+type SpectatorTimeline struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Created   int64 `protobuf:"varint,1,opt,name=created,proto3" json:"created,omitempty"`
+	Attached  int64 `protobuf:"varint,2,opt,name=attached,proto3" json:"attached,omitempty"`
+	Bet1      int64 `protobuf:"varint,3,opt,name=bet1,proto3" json:"bet1,omitempty"`
+	Bet2      int64 `protobuf:"varint,4,opt,name=bet2,proto3" json:"bet2,omitempty"`
+	Disclose1 int64 `protobuf:"varint,5,opt,name=disclose1,proto3" json:"disclose1,omitempty"`
+	Disclose2 int64 `protobuf:"varint,6,opt,name=disclose2,proto3" json:"disclose2,omitempty"`
+	Resolved  int64 `protobuf:"varint,7,opt,name=resolved,proto3" json:"resolved,omitempty"`
+}
+
+func (x *SpectatorTimeline) Reset() {
+	*x = SpectatorTimeline{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ssp_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SpectatorTimeline) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpectatorTimeline) ProtoMessage() {}
+
+func (x *SpectatorTimeline) ProtoReflect() protoreflect.Message {
+	mi := &file_ssp_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpectatorTimeline.ProtoReflect.Descriptor instead.
+func (*SpectatorTimeline) Descriptor() ([]byte, []int) {
+	return file_ssp_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SpectatorTimeline) GetCreated() int64 {
+	if x != nil {
+		return x.Created
+	}
+	return 0
+}
+
+func (x *SpectatorTimeline) GetAttached() int64 {
+	if x != nil {
+		return x.Attached
+	}
+	return 0
+}
+
+func (x *SpectatorTimeline) GetBet1() int64 {
+	if x != nil {
+		return x.Bet1
+	}
+	return 0
+}
+
+func (x *SpectatorTimeline) GetBet2() int64 {
+	if x != nil {
+		return x.Bet2
+	}
+	return 0
+}
+
+func (x *SpectatorTimeline) GetDisclose1() int64 {
+	if x != nil {
+		return x.Disclose1
+	}
+	return 0
+}
+
+func (x *SpectatorTimeline) GetDisclose2() int64 {
+	if x != nil {
+		return x.Disclose2
+	}
+	return 0
+}
+
+func (x *SpectatorTimeline) GetResolved() int64 {
+	if x != nil {
+		return x.Resolved
+	}
+	return 0
+}
+
+var File_ssp_proto protoreflect.FileDescriptor
+
+var file_ssp_proto_rawDesc = []byte{
+	0x0a, 0x09, 0x73, 0x73, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x03, 0x73, 0x73, 0x70,
+	0x22, 0x5d, 0x0a, 0x0f, 0x4e, 0x65, 0x77, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x67,
+	0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x67, 0x61, 0x6d, 0x65, 0x12,
+	0x1e, 0x0a, 0x0a, 0x73, 0x70, 0x65, 0x63, 0x74, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x70, 0x65, 0x63, 0x74, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x22,
+	0x6f, 0x0a, 0x10, 0x4e, 0x65, 0x77, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x70, 0x65,
+	0x63, 0x74, 0x61, 0x74, 0x6f, 0x72, 0x5f, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0e, 0x73, 0x70, 0x65, 0x63, 0x74, 0x61, 0x74, 0x6f, 0x72, 0x54, 0x6f, 0x6b,
+	0x65, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x70, 0x73, 0x65, 0x75, 0x64, 0x6f, 0x6e, 0x79, 0x6d, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x70, 0x73, 0x65, 0x75, 0x64, 0x6f, 0x6e, 0x79, 0x6d,
+	0x22, 0x3d, 0x0a, 0x0d, 0x41, 0x74, 0x74, 0x61, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65,
+	0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x22,
+	0x7e, 0x0a, 0x0a, 0x42, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a,
+	0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x72, 0x6f,
+	0x75, 0x6e, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x62,
+	0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x62, 0x65, 0x74, 0x12, 0x16, 0x0a,
+	0x06, 0x73, 0x65, 0x61, 0x6c, 0x65, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73,
+	0x65, 0x61, 0x6c, 0x65, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x67, 0x65, 0x73, 0x74, 0x75, 0x72, 0x65,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x67, 0x65, 0x73, 0x74, 0x75, 0x72, 0x65, 0x22,
+	0x69, 0x0a, 0x0f, 0x44, 0x69, 0x73, 0x63, 0x6c, 0x6f, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6c, 0x61, 0x79,
+	0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72,
+	0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x63, 0x72, 0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x73, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x62, 0x65, 0x74, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x62, 0x65, 0x74, 0x22, 0x3d, 0x0a, 0x0d, 0x52, 0x65,
+	0x73, 0x75, 0x6c, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x72,
+	0x6f, 0x75, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x72, 0x6f, 0x75, 0x6e,
+	0x64, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x22, 0x91, 0x01, 0x0a, 0x0d, 0x52, 0x6f,
+	0x75, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x63, 0x72, 0x65,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12,
+	0x2e, 0x0a, 0x08, 0x74, 0x69, 0x6d, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x12, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x54, 0x69, 0x6d,
+	0x65, 0x6c, 0x69, 0x6e, 0x65, 0x52, 0x08, 0x74, 0x69, 0x6d, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x12,
+	0x1c, 0x0a, 0x09, 0x70, 0x73, 0x65, 0x75, 0x64, 0x6f, 0x6e, 0x79, 0x6d, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x09, 0x70, 0x73, 0x65, 0x75, 0x64, 0x6f, 0x6e, 0x79, 0x6d, 0x22, 0xe5, 0x01,
+	0x0a, 0x0d, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x12,
+	0x18, 0x0a, 0x07, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x07, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x74, 0x74,
+	0x61, 0x63, 0x68, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x61, 0x74, 0x74,
+	0x61, 0x63, 0x68, 0x65, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x79, 0x6f, 0x75, 0x72, 0x5f, 0x62, 0x65,
+	0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x79, 0x6f, 0x75, 0x72, 0x42, 0x65, 0x74,
+	0x12, 0x1b, 0x0a, 0x09, 0x72, 0x69, 0x76, 0x61, 0x6c, 0x5f, 0x62, 0x65, 0x74, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x08, 0x72, 0x69, 0x76, 0x61, 0x6c, 0x42, 0x65, 0x74, 0x12, 0x23, 0x0a,
+	0x0d, 0x79, 0x6f, 0x75, 0x72, 0x5f, 0x64, 0x69, 0x73, 0x63, 0x6c, 0x6f, 0x73, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x79, 0x6f, 0x75, 0x72, 0x44, 0x69, 0x73, 0x63, 0x6c, 0x6f,
+	0x73, 0x65, 0x12, 0x25, 0x0a, 0x0e, 0x72, 0x69, 0x76, 0x61, 0x6c, 0x5f, 0x64, 0x69, 0x73, 0x63,
+	0x6c, 0x6f, 0x73, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d, 0x72, 0x69, 0x76, 0x61,
+	0x6c, 0x44, 0x69, 0x73, 0x63, 0x6c, 0x6f, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73,
+	0x6f, 0x6c, 0x76, 0x65, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x72, 0x65, 0x73,
+	0x6f, 0x6c, 0x76, 0x65, 0x64, 0x22, 0x3d, 0x0a, 0x0f, 0x53, 0x70, 0x65, 0x63, 0x74, 0x61, 0x74,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6f, 0x75, 0x6e,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x12, 0x14,
+	0x0a, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74,
+	0x6f, 0x6b, 0x65, 0x6e, 0x22, 0xc6, 0x01, 0x0a, 0x10, 0x53, 0x70, 0x65, 0x63, 0x74, 0x61, 0x74,
+	0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6f, 0x75,
+	0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x72, 0x6f, 0x75, 0x6e, 0x64, 0x12,
+	0x12, 0x0a, 0x04, 0x67, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x67,
+	0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x32, 0x0a, 0x08, 0x74, 0x69, 0x6d,
+	0x65, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x73, 0x73,
+	0x70, 0x2e, 0x53, 0x70, 0x65, 0x63, 0x74, 0x61, 0x74, 0x6f, 0x72, 0x54, 0x69, 0x6d, 0x65, 0x6c,
+	0x69, 0x6e, 0x65, 0x52, 0x08, 0x74, 0x69, 0x6d, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x12, 0x12, 0x0a,
+	0x04, 0x62, 0x65, 0x74, 0x31, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x62, 0x65, 0x74,
+	0x31, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x65, 0x74, 0x32, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x62, 0x65, 0x74, 0x32, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x69, 0x6e, 0x6e, 0x65, 0x72, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x77, 0x69, 0x6e, 0x6e, 0x65, 0x72, 0x22, 0xc9, 0x01,
+	0x0a, 0x11, 0x53, 0x70, 0x65, 0x63, 0x74, 0x61, 0x74, 0x6f, 0x72, 0x54, 0x69, 0x6d, 0x65, 0x6c,
+	0x69, 0x6e, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x12, 0x1a, 0x0a,
+	0x08, 0x61, 0x74, 0x74, 0x61, 0x63, 0x68, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x08, 0x61, 0x74, 0x74, 0x61, 0x63, 0x68, 0x65, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x65, 0x74,
+	0x31, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x62, 0x65, 0x74, 0x31, 0x12, 0x12, 0x0a,
+	0x04, 0x62, 0x65, 0x74, 0x32, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x62, 0x65, 0x74,
+	0x32, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x69, 0x73, 0x63, 0x6c, 0x6f, 0x73, 0x65, 0x31, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x64, 0x69, 0x73, 0x63, 0x6c, 0x6f, 0x73, 0x65, 0x31, 0x12,
+	0x1c, 0x0a, 0x09, 0x64, 0x69, 0x73, 0x63, 0x6c, 0x6f, 0x73, 0x65, 0x32, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x09, 0x64, 0x69, 0x73, 0x63, 0x6c, 0x6f, 0x73, 0x65, 0x32, 0x12, 0x1a, 0x0a,
+	0x08, 0x72, 0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x08, 0x72, 0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65, 0x64, 0x32, 0xf8, 0x02, 0x0a, 0x04, 0x47, 0x61,
+	0x6d, 0x65, 0x12, 0x37, 0x0a, 0x08, 0x4e, 0x65, 0x77, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x12, 0x14,
+	0x2e, 0x73, 0x73, 0x70, 0x2e, 0x4e, 0x65, 0x77, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x4e, 0x65, 0x77, 0x52, 0x6f,
+	0x75, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x30, 0x0a, 0x06, 0x41,
+	0x74, 0x74, 0x61, 0x63, 0x68, 0x12, 0x12, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x41, 0x74, 0x74, 0x61,
+	0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x73, 0x73, 0x70, 0x2e,
+	0x52, 0x6f, 0x75, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2a, 0x0a,
+	0x03, 0x42, 0x65, 0x74, 0x12, 0x0f, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x42, 0x65, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x52, 0x6f, 0x75, 0x6e,
+	0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x34, 0x0a, 0x08, 0x44, 0x69, 0x73,
+	0x63, 0x6c, 0x6f, 0x73, 0x65, 0x12, 0x14, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x44, 0x69, 0x73, 0x63,
+	0x6c, 0x6f, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x73, 0x73,
+	0x70, 0x2e, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x30, 0x0a, 0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x12, 0x2e, 0x73, 0x73, 0x70, 0x2e,
+	0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e,
+	0x73, 0x73, 0x70, 0x2e, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x36, 0x0a, 0x0a, 0x57, 0x61, 0x74, 0x63, 0x68, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x12,
+	0x12, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x52, 0x6f, 0x75, 0x6e, 0x64, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x39, 0x0a, 0x08, 0x53, 0x70, 0x65,
+	0x63, 0x74, 0x61, 0x74, 0x65, 0x12, 0x14, 0x2e, 0x73, 0x73, 0x70, 0x2e, 0x53, 0x70, 0x65, 0x63,
+	0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x73, 0x73,
+	0x70, 0x2e, 0x53, 0x70, 0x65, 0x63, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x30, 0x01, 0x42, 0x09, 0x5a, 0x07, 0x2e, 0x2f, 0x3b, 0x6d, 0x61, 0x69, 0x6e, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_ssp_proto_rawDescOnce sync.Once
+	file_ssp_proto_rawDescData = file_ssp_proto_rawDesc
+)
+
+func file_ssp_proto_rawDescGZIP() []byte {
+	file_ssp_proto_rawDescOnce.Do(func() {
+		file_ssp_proto_rawDescData = protoimpl.X.CompressGZIP(file_ssp_proto_rawDescData)
+	})
+	return file_ssp_proto_rawDescData
+}
+
+var file_ssp_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_ssp_proto_goTypes = []interface{}{
+	(*NewRoundRequest)(nil),   // 0: ssp.NewRoundRequest
+	(*NewRoundResponse)(nil),  // 1: ssp.NewRoundResponse
+	(*AttachRequest)(nil),     // 2: ssp.AttachRequest
+	(*BetRequest)(nil),        // 3: ssp.BetRequest
+	(*DiscloseRequest)(nil),   // 4: ssp.DiscloseRequest
+	(*ResultRequest)(nil),     // 5: ssp.ResultRequest
+	(*RoundResponse)(nil),     // 6: ssp.RoundResponse
+	(*RoundTimeline)(nil),     // 7: ssp.RoundTimeline
+	(*SpectateRequest)(nil),   // 8: ssp.SpectateRequest
+	(*SpectateResponse)(nil),  // 9: ssp.SpectateResponse
+	(*SpectatorTimeline)(nil), // 10: ssp.SpectatorTimeline
+}
+var file_ssp_proto_depIdxs = []int32{
+	7,  // 0: ssp.RoundResponse.timeline:type_name -> ssp.RoundTimeline
+	10, // 1: ssp.SpectateResponse.timeline:type_name -> ssp.SpectatorTimeline
+	0,  // 2: ssp.Game.NewRound:input_type -> ssp.NewRoundRequest
+	2,  // 3: ssp.Game.Attach:input_type -> ssp.AttachRequest
+	3,  // 4: ssp.Game.Bet:input_type -> ssp.BetRequest
+	4,  // 5: ssp.Game.Disclose:input_type -> ssp.DiscloseRequest
+	5,  // 6: ssp.Game.Result:input_type -> ssp.ResultRequest
+	5,  // 7: ssp.Game.WatchRound:input_type -> ssp.ResultRequest
+	8,  // 8: ssp.Game.Spectate:input_type -> ssp.SpectateRequest
+	1,  // 9: ssp.Game.NewRound:output_type -> ssp.NewRoundResponse
+	6,  // 10: ssp.Game.Attach:output_type -> ssp.RoundResponse
+	6,  // 11: ssp.Game.Bet:output_type -> ssp.RoundResponse
+	6,  // 12: ssp.Game.Disclose:output_type -> ssp.RoundResponse
+	6,  // 13: ssp.Game.Result:output_type -> ssp.RoundResponse
+	6,  // 14: ssp.Game.WatchRound:output_type -> ssp.RoundResponse
+	9,  // 15: ssp.Game.Spectate:output_type -> ssp.SpectateResponse
+	9,  // [9:16] is the sub-list for method output_type
+	2,  // [2:9] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_ssp_proto_init() }
+func file_ssp_proto_init() {
+	if File_ssp_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_ssp_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NewRoundRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NewRoundResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AttachRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BetRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DiscloseRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ResultRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RoundResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RoundTimeline); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SpectateRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SpectateResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_ssp_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SpectatorTimeline); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_ssp_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ssp_proto_goTypes,
+		DependencyIndexes: file_ssp_proto_depIdxs,
+		MessageInfos:      file_ssp_proto_msgTypes,
+	}.Build()
+	File_ssp_proto = out.File
+	file_ssp_proto_rawDesc = nil
+	file_ssp_proto_goTypes = nil
+	file_ssp_proto_depIdxs = nil
+}
@@ -0,0 +1,400 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: ssp.proto
+
+package main
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Game_NewRound_FullMethodName   = "/ssp.Game/NewRound"
+	Game_Attach_FullMethodName     = "/ssp.Game/Attach"
+	Game_Bet_FullMethodName        = "/ssp.Game/Bet"
+	Game_Disclose_FullMethodName   = "/ssp.Game/Disclose"
+	Game_Result_FullMethodName     = "/ssp.Game/Result"
+	Game_WatchRound_FullMethodName = "/ssp.Game/WatchRound"
+	Game_Spectate_FullMethodName   = "/ssp.Game/Spectate"
+)
+
+// GameClient is the client API for Game service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GameClient interface {
+	// NewRound starts a new round
+	NewRound(ctx context.Context, in *NewRoundRequest, opts ...grpc.CallOption) (*NewRoundResponse, error)
+	// Attach attaches the second player to existing round
+	Attach(ctx context.Context, in *AttachRequest, opts ...grpc.CallOption) (*RoundResponse, error)
+	// Bet places the hidden bet of player
+	Bet(ctx context.Context, in *BetRequest, opts ...grpc.CallOption) (*RoundResponse, error)
+	// Disclose discloses the bet of player
+	Disclose(ctx context.Context, in *DiscloseRequest, opts ...grpc.CallOption) (*RoundResponse, error)
+	// Result returns the round result
+	Result(ctx context.Context, in *ResultRequest, opts ...grpc.CallOption) (*RoundResponse, error)
+	// WatchRound streams the round result every time it changes until the round is finished
+	WatchRound(ctx context.Context, in *ResultRequest, opts ...grpc.CallOption) (Game_WatchRoundClient, error)
+	// Spectate streams the spectator's view of round every time it changes until the round is finished
+	Spectate(ctx context.Context, in *SpectateRequest, opts ...grpc.CallOption) (Game_SpectateClient, error)
+}
+
+type gameClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGameClient(cc grpc.ClientConnInterface) GameClient {
+	return &gameClient{cc}
+}
+
+func (c *gameClient) NewRound(ctx context.Context, in *NewRoundRequest, opts ...grpc.CallOption) (*NewRoundResponse, error) {
+	out := new(NewRoundResponse)
+	err := c.cc.Invoke(ctx, Game_NewRound_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gameClient) Attach(ctx context.Context, in *AttachRequest, opts ...grpc.CallOption) (*RoundResponse, error) {
+	out := new(RoundResponse)
+	err := c.cc.Invoke(ctx, Game_Attach_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gameClient) Bet(ctx context.Context, in *BetRequest, opts ...grpc.CallOption) (*RoundResponse, error) {
+	out := new(RoundResponse)
+	err := c.cc.Invoke(ctx, Game_Bet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gameClient) Disclose(ctx context.Context, in *DiscloseRequest, opts ...grpc.CallOption) (*RoundResponse, error) {
+	out := new(RoundResponse)
+	err := c.cc.Invoke(ctx, Game_Disclose_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gameClient) Result(ctx context.Context, in *ResultRequest, opts ...grpc.CallOption) (*RoundResponse, error) {
+	out := new(RoundResponse)
+	err := c.cc.Invoke(ctx, Game_Result_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gameClient) WatchRound(ctx context.Context, in *ResultRequest, opts ...grpc.CallOption) (Game_WatchRoundClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Game_ServiceDesc.Streams[0], Game_WatchRound_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gameWatchRoundClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Game_WatchRoundClient interface {
+	Recv() (*RoundResponse, error)
+	grpc.ClientStream
+}
+
+type gameWatchRoundClient struct {
+	grpc.ClientStream
+}
+
+func (x *gameWatchRoundClient) Recv() (*RoundResponse, error) {
+	m := new(RoundResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gameClient) Spectate(ctx context.Context, in *SpectateRequest, opts ...grpc.CallOption) (Game_SpectateClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Game_ServiceDesc.Streams[1], Game_Spectate_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gameSpectateClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Game_SpectateClient interface {
+	Recv() (*SpectateResponse, error)
+	grpc.ClientStream
+}
+
+type gameSpectateClient struct {
+	grpc.ClientStream
+}
+
+func (x *gameSpectateClient) Recv() (*SpectateResponse, error) {
+	m := new(SpectateResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GameServer is the server API for Game service.
+// All implementations must embed UnimplementedGameServer
+// for forward compatibility
+type GameServer interface {
+	// NewRound starts a new round
+	NewRound(context.Context, *NewRoundRequest) (*NewRoundResponse, error)
+	// Attach attaches the second player to existing round
+	Attach(context.Context, *AttachRequest) (*RoundResponse, error)
+	// Bet places the hidden bet of player
+	Bet(context.Context, *BetRequest) (*RoundResponse, error)
+	// Disclose discloses the bet of player
+	Disclose(context.Context, *DiscloseRequest) (*RoundResponse, error)
+	// Result returns the round result
+	Result(context.Context, *ResultRequest) (*RoundResponse, error)
+	// WatchRound streams the round result every time it changes until the round is finished
+	WatchRound(*ResultRequest, Game_WatchRoundServer) error
+	// Spectate streams the spectator's view of round every time it changes until the round is finished
+	Spectate(*SpectateRequest, Game_SpectateServer) error
+	mustEmbedUnimplementedGameServer()
+}
+
+// UnimplementedGameServer must be embedded to have forward compatible implementations.
+type UnimplementedGameServer struct {
+}
+
+func (UnimplementedGameServer) NewRound(context.Context, *NewRoundRequest) (*NewRoundResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method NewRound not implemented")
+}
+func (UnimplementedGameServer) Attach(context.Context, *AttachRequest) (*RoundResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Attach not implemented")
+}
+func (UnimplementedGameServer) Bet(context.Context, *BetRequest) (*RoundResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Bet not implemented")
+}
+func (UnimplementedGameServer) Disclose(context.Context, *DiscloseRequest) (*RoundResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Disclose not implemented")
+}
+func (UnimplementedGameServer) Result(context.Context, *ResultRequest) (*RoundResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Result not implemented")
+}
+func (UnimplementedGameServer) WatchRound(*ResultRequest, Game_WatchRoundServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRound not implemented")
+}
+func (UnimplementedGameServer) Spectate(*SpectateRequest, Game_SpectateServer) error {
+	return status.Errorf(codes.Unimplemented, "method Spectate not implemented")
+}
+func (UnimplementedGameServer) mustEmbedUnimplementedGameServer() {}
+
+// UnsafeGameServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GameServer will
+// result in compilation errors.
+type UnsafeGameServer interface {
+	mustEmbedUnimplementedGameServer()
+}
+
+func RegisterGameServer(s grpc.ServiceRegistrar, srv GameServer) {
+	s.RegisterService(&Game_ServiceDesc, srv)
+}
+
+func _Game_NewRound_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NewRoundRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GameServer).NewRound(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Game_NewRound_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GameServer).NewRound(ctx, req.(*NewRoundRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Game_Attach_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AttachRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GameServer).Attach(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Game_Attach_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GameServer).Attach(ctx, req.(*AttachRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Game_Bet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GameServer).Bet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Game_Bet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GameServer).Bet(ctx, req.(*BetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Game_Disclose_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DiscloseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GameServer).Disclose(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Game_Disclose_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GameServer).Disclose(ctx, req.(*DiscloseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Game_Result_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GameServer).Result(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Game_Result_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GameServer).Result(ctx, req.(*ResultRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Game_WatchRound_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ResultRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GameServer).WatchRound(m, &gameWatchRoundServer{stream})
+}
+
+type Game_WatchRoundServer interface {
+	Send(*RoundResponse) error
+	grpc.ServerStream
+}
+
+type gameWatchRoundServer struct {
+	grpc.ServerStream
+}
+
+func (x *gameWatchRoundServer) Send(m *RoundResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Game_Spectate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SpectateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GameServer).Spectate(m, &gameSpectateServer{stream})
+}
+
+type Game_SpectateServer interface {
+	Send(*SpectateResponse) error
+	grpc.ServerStream
+}
+
+type gameSpectateServer struct {
+	grpc.ServerStream
+}
+
+func (x *gameSpectateServer) Send(m *SpectateResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Game_ServiceDesc is the grpc.ServiceDesc for Game service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Game_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ssp.Game",
+	HandlerType: (*GameServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "NewRound",
+			Handler:    _Game_NewRound_Handler,
+		},
+		{
+			MethodName: "Attach",
+			Handler:    _Game_Attach_Handler,
+		},
+		{
+			MethodName: "Bet",
+			Handler:    _Game_Bet_Handler,
+		},
+		{
+			MethodName: "Disclose",
+			Handler:    _Game_Disclose_Handler,
+		},
+		{
+			MethodName: "Result",
+			Handler:    _Game_Result_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRound",
+			Handler:       _Game_WatchRound_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Spectate",
+			Handler:       _Game_Spectate_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ssp.proto",
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
@@ -14,6 +15,23 @@ type Database interface {
 	Retrieve(string) (*Round, error)
 }
 
+// RoundLister is an interface of the persistence layer that can list all stored rounds
+type RoundLister interface {
+	ForEachRound(func(id string) error) error
+}
+
+// historyKey returns the key of the list with last stored versions of round. It is the audit trail for the
+// restoring of quarantined rounds.
+func historyKey(id string) string {
+	return "history:" + id
+}
+
+// historyLength is the number of round versions kept in the audit trail
+const historyLength = 10
+
+// roundKeys is the pattern of keys that store rounds (round ids are UUIDs)
+const roundKeys = "????????-????-????-????-????????????"
+
 // redisDB is a Redis implementation of Database interface
 type redisDB struct {
 	r redis.UniversalClient
@@ -30,10 +48,18 @@ func NewDatabase(opt redis.UniversalOptions) (Database, error) {
 	return DB, nil
 }
 
-// Store stores data to database
+// Store stores data to database and adds it to the round history
 func (db *redisDB) Store(round *Round) error {
+	round.DrainEvents() // the events are not kept in this storage mode
 	data, _ := json.Marshal(round)
-	return db.r.Set(round.ID, data, time.Hour*8760).Err()
+	_, err := db.r.Pipelined(func(p redis.Pipeliner) error {
+		p.Set(round.ID, data, time.Hour*8760)
+		p.LPush(historyKey(round.ID), data)
+		p.LTrim(historyKey(round.ID), 0, historyLength-1)
+		p.Expire(historyKey(round.ID), time.Hour*8760)
+		return nil
+	})
+	return err
 }
 
 // Retrieve reads the data from database
@@ -48,3 +74,67 @@ func (db *redisDB) Retrieve(id string) (*Round, error) {
 	}
 	return round, nil
 }
+
+// ForEachRound calls fn for each stored round till fn returns an error
+func (db *redisDB) ForEachRound(fn func(id string) error) error {
+	scan := func(c redis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := c.Scan(cursor, roundKeys, 100).Result()
+			if err != nil {
+				return err
+			}
+			for _, id := range keys {
+				if err := fn(id); err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	if cluster, ok := db.r.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(func(c *redis.Client) error { return scan(c) })
+	}
+	return scan(db.r)
+}
+
+// casScript replaces the value of key when it is not changed after reading. It returns 1 when the value is
+// replaced and 0 when it is changed concurrently.
+// KEYS: key; ARGV: read value, new value, expiry in milliseconds.
+var casScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// maxUpdateAttempts is the number of attempts to update the value that is changed concurrently
+const maxUpdateAttempts = 10
+
+// errConcurrentUpdate is returned when the value can't be updated because of concurrent changes
+var errConcurrentUpdate = errors.New("too many concurrent updates")
+
+// casUpdate reads the value of key, makes the new value by update and stores it when the value is not changed
+// concurrently. Otherwise update is repeated for the new read value. The value is not stored when update
+// returns nil.
+func casUpdate(r redis.UniversalClient, key string, exp time.Duration, update func(data []byte) ([]byte, error)) error {
+	for i := 0; i < maxUpdateAttempts; i++ {
+		data, err := r.Get(key).Bytes()
+		if err != nil {
+			return err
+		}
+		changed, err := update(data)
+		if err != nil || changed == nil {
+			return err
+		}
+		stored, err := casScript.Run(r, []string{key}, data, changed, exp.Milliseconds()).Int()
+		if err != nil || stored == 1 {
+			return err
+		}
+	}
+	return errConcurrentUpdate
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/go-redis/redis"
@@ -30,3 +31,29 @@ func Test1_Storage(t *testing.T) {
 	_, err = db.Retrieve("Non-existing_key")
 	require.Error(t, err)
 }
+
+func Test2_StorageList(t *testing.T) {
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+
+	db, err := NewDatabase(redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword})
+	require.NoError(t, err)
+
+	r := NewRound("u1")
+	require.NoError(t, db.Store(r))
+
+	found := false
+	err = db.(RoundLister).ForEachRound(func(id string) error {
+		found = found || id == r.ID
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, found)
+
+	err = db.(RoundLister).ForEachRound(func(id string) error {
+		return errors.New("stop")
+	})
+	require.Error(t, err)
+}
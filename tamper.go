@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// TamperEvent is the record of detected falsification of stored round or of its restoring
+type TamperEvent struct {
+	Round  string `json:"round"`          // round id
+	Time   int64  `json:"time"`           // detection time (Unix time in milliseconds)
+	Reason string `json:"reason"`         // what was detected or done
+	Blob   []byte `json:"blob,omitempty"` // the offending stored round data
+}
+
+// TamperStore is an interface of the storage of tamper events and quarantined rounds
+type TamperStore interface {
+	// Quarantine moves the stored round data to quarantine and records the tamper event with it.
+	// The provided blob is used when the round data is not stored as one value.
+	Quarantine(id, reason string, blob []byte) (*TamperEvent, error)
+	// Quarantined reports whether the round is in quarantine
+	Quarantined(id string) (bool, error)
+	// Release removes the round from quarantine and records the event with reason
+	Release(id, reason string) error
+	// Events returns the tamper events of round (newest first), events of all rounds are returned when id is empty
+	Events(id string) ([]TamperEvent, error)
+	// History returns the last stored versions of round (newest first)
+	History(id string) ([][]byte, error)
+}
+
+// tamper is the store of tamper events. Falsified rounds are not quarantined when it is nil.
+var tamper TamperStore
+
+// tamperHooks are called for each tamper event
+var tamperHooks []func(e TamperEvent)
+
+// tamperEvents is the metric of detected falsifications
+var tamperEvents = expvar.NewInt("tamper_events")
+
+// errQuarantined is returned for requests to quarantined rounds
+var errQuarantined = errors.New("round is quarantined")
+
+const (
+	tamperEventsKey  = "tamper:events" // list of tamper events
+	tamperEventsSize = 1000            // number of kept tamper events
+	reasonSignature  = "signature mismatch"
+	reasonRestored   = "restored"
+)
+
+// quarantineKey returns the key of quarantined round data
+func quarantineKey(id string) string {
+	return "quarantine:" + id
+}
+
+// redisTamper is a Redis implementation of TamperStore interface
+type redisTamper struct {
+	r redis.UniversalClient
+}
+
+// NewTamperStore returns a new instance of TamperStore interface implementing the storage via Redis
+func NewTamperStore(opt redis.UniversalOptions) (TamperStore, error) {
+	s := &redisTamper{redis.NewUniversalClient(&opt)}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Quarantine moves the round data to quarantine key. The round keys are not in one slot of Redis cluster,
+// so the data is copied and removed instead of renaming.
+func (s *redisTamper) Quarantine(id, reason string, blob []byte) (*TamperEvent, error) {
+	stored, err := s.r.Get(id).Bytes()
+	switch {
+	case err == nil:
+		blob = stored
+	case err != redis.Nil:
+		return nil, err
+	}
+	if err := s.r.Set(quarantineKey(id), blob, time.Hour*8760).Err(); err != nil {
+		return nil, err
+	}
+	if err := s.r.Del(id).Err(); err != nil {
+		return nil, err
+	}
+	e := &TamperEvent{Round: id, Time: time.Now().UnixMilli(), Reason: reason, Blob: blob}
+	return e, s.record(e)
+}
+
+// Quarantined checks the quarantine key of round
+func (s *redisTamper) Quarantined(id string) (bool, error) {
+	n, err := s.r.Exists(quarantineKey(id)).Result()
+	return n > 0, err
+}
+
+// Release removes the quarantine key of round
+func (s *redisTamper) Release(id, reason string) error {
+	if err := s.r.Del(quarantineKey(id)).Err(); err != nil {
+		return err
+	}
+	return s.record(&TamperEvent{Round: id, Time: time.Now().UnixMilli(), Reason: reason})
+}
+
+// Events returns the tamper events
+func (s *redisTamper) Events(id string) ([]TamperEvent, error) {
+	list, err := s.r.LRange(tamperEventsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := []TamperEvent{}
+	for _, data := range list {
+		e := TamperEvent{}
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return nil, err
+		}
+		if id == "" || e.Round == id {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// History returns the round history written by Database
+func (s *redisTamper) History(id string) ([][]byte, error) {
+	list, err := s.r.LRange(historyKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, len(list))
+	for i, data := range list {
+		res[i] = []byte(data)
+	}
+	return res, nil
+}
+
+// record adds the event to the list of tamper events
+func (s *redisTamper) record(e *TamperEvent) error {
+	data, _ := json.Marshal(e)
+	_, err := s.r.Pipelined(func(p redis.Pipeliner) error {
+		p.LPush(tamperEventsKey, data)
+		p.LTrim(tamperEventsKey, 0, tamperEventsSize-1)
+		return nil
+	})
+	return err
+}
+
+// reportTamper handles the falsified round: it quarantines the round, drops it from the memory cache,
+// refunds the escrowed stakes, counts the event and calls the alert hooks
+func reportTamper(round *Round) {
+	tamperEvents.Add(1)
+	log.Printf("round: %s - ALERT: %s", round.ID, reasonSignature)
+	if tamper == nil {
+		return
+	}
+	round.mx.Lock()
+	blob, _ := json.Marshal(round)
+	round.mx.Unlock()
+	e, err := tamper.Quarantine(round.ID, reasonSignature, blob)
+	if err != nil {
+		log.Printf("round: %s - quarantine error: %v", round.ID, err)
+		return
+	}
+	evictRound(round.ID)
+	refundStakes(round)
+	for _, hook := range tamperHooks {
+		go hook(*e)
+	}
+}
+
+// webhook returns the tamper hook that posts the event as JSON to url
+func webhook(url string) func(e TamperEvent) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func(e TamperEvent) {
+		data, _ := json.Marshal(e)
+		resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			log.Printf("tamper webhook error: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("tamper webhook error: %s", resp.Status)
+		}
+	}
+}
+
+// restoreMx serializes the restoring of rounds
+var restoreMx sync.Mutex
+
+// restoreRound stores the newest version of round with valid signature from the audit trail
+// and removes the round from quarantine
+func restoreRound(id string) (*Round, error) {
+	restoreMx.Lock()
+	defer restoreMx.Unlock()
+	history, err := tamper.History(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range history {
+		round := &Round{}
+		if json.Unmarshal(data, round) != nil || round.ID != id || !round.Valid() {
+			continue
+		}
+		if err := db.Store(round); err != nil {
+			return nil, err
+		}
+		return round, tamper.Release(id, reasonRestored)
+	}
+	return nil, fmt.Errorf("round %s has no valid version in the audit trail", id)
+}
+
+// admin allows the request to handler only with the administrator's bearer token.
+// Administrator's endpoints are disabled when the token is empty.
+func admin(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if token == "" {
+			http.NotFound(w, req)
+			return
+		}
+		auth := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+// Tamper realizes the administrator's requests to tamper events:
+// GET /admin/tamper - all tamper events,
+// GET /admin/tamper/{id} - events, quarantine state and audit trail of round,
+// POST /admin/tamper/{id}/restore - restore the round from audit trail.
+func Tamper(w http.ResponseWriter, req *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/admin/tamper"), "/"), "/")
+	switch {
+	case len(path) == 1 && req.Method == "GET":
+		events, err := tamper.Events(path[0])
+		if err != nil {
+			storageError(fmt.Errorf("Tamper events error: %w", err), w)
+			return
+		}
+		if path[0] == "" {
+			sendResponse(w, struct {
+				Events []TamperEvent `json:"events"`
+			}{events})
+			return
+		}
+		quarantined, err := tamper.Quarantined(path[0])
+		if err != nil {
+			storageError(fmt.Errorf("Tamper events error: %w", err), w)
+			return
+		}
+		history, err := tamper.History(path[0])
+		if err != nil {
+			storageError(fmt.Errorf("Tamper events error: %w", err), w)
+			return
+		}
+		sendResponse(w, struct {
+			Quarantined bool          `json:"quarantined"`
+			Events      []TamperEvent `json:"events"`
+			History     [][]byte      `json:"history"`
+		}{quarantined, events, history})
+	case len(path) == 2 && path[0] != "" && path[1] == "restore" && req.Method == "POST":
+		round, err := restoreRound(path[0])
+		if err != nil {
+			log.Printf("round: %s - restore error: %v", path[0], err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("round: %s - restored from audit trail", round.ID)
+		sendResponse(w, struct {
+			Response string `json:"response"`
+		}{"round restored"})
+	default:
+		http.NotFound(w, req)
+	}
+}
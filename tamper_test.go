@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_AttachFalsificated(t *testing.T) {
+	tr := NewRound("u1")
+	tr.Player1 = tr.roundSaltedHash("u3")
+
+	require.Equal(t, msgFalsificated, tr.Attach("u2"))
+	require.False(t, tr.Valid())
+	require.Equal(t, "", tr.Player2)
+}
+
+func Test2_TamperQuarantine(t *testing.T) {
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+	opt := redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword}
+
+	d, err := NewDatabase(opt)
+	require.NoError(t, err)
+	ts, err := NewTamperStore(opt)
+	require.NoError(t, err)
+
+	prevDB, prevTamper, prevHooks := db, tamper, tamperHooks
+	defer func() { db, tamper, tamperHooks = prevDB, prevTamper, prevHooks }()
+	db, tamper = NewCache(d, time.Minute, time.Minute), ts
+
+	alerts := make(chan TamperEvent, 1)
+	tamperHooks = []func(TamperEvent){func(e TamperEvent) { alerts <- e }}
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		e := TamperEvent{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&e))
+		alerts <- e
+	}))
+	defer hook.Close()
+	tamperHooks = append(tamperHooks, webhook(hook.URL))
+
+	round, err := startRound("u1", RoundOptions{})
+	require.NoError(t, err)
+	_, res, err := play(round.ID, true, func(r *Round) string { return r.Attach("u2") })
+	require.NoError(t, err)
+	require.Equal(t, "place Your bet, please", res)
+
+	// falsify the stored round and drop it from memory cache
+	forged := &Round{}
+	blob, _ := json.Marshal(round)
+	require.NoError(t, json.Unmarshal(blob, forged))
+	forged.Player2 = forged.roundSaltedHash("u3")
+	blob, _ = json.Marshal(forged)
+	require.NoError(t, d.(*redisDB).r.Set(round.ID, blob, time.Hour).Err())
+	db.(*Cache).Evict(round.ID)
+
+	count := tamperEvents.Value()
+	_, res, err = play(round.ID, true, func(r *Round) string { return r.Result("u1") })
+	require.NoError(t, err)
+	require.Equal(t, msgFalsificated, res)
+	require.Equal(t, count+1, tamperEvents.Value())
+	for i := 0; i < 2; i++ {
+		e := <-alerts
+		require.Equal(t, round.ID, e.Round)
+		require.Equal(t, blob, e.Blob)
+	}
+
+	quarantined, err := ts.Quarantined(round.ID)
+	require.NoError(t, err)
+	require.True(t, quarantined)
+	_, _, err = play(round.ID, false, func(r *Round) string { return r.Result("u1") })
+	require.ErrorIs(t, err, errQuarantined)
+
+	events, err := ts.Events(round.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, reasonSignature, events[0].Reason)
+
+	restored, err := restoreRound(round.ID)
+	require.NoError(t, err)
+	require.Equal(t, round.Signature, restored.Signature)
+	quarantined, err = ts.Quarantined(round.ID)
+	require.NoError(t, err)
+	require.False(t, quarantined)
+
+	db.(*Cache).Evict(round.ID)
+	_, res, err = play(round.ID, false, func(r *Round) string { return r.Result("u1") })
+	require.NoError(t, err)
+	require.Equal(t, "place Your bet, please", res)
+
+	_, err = restoreRound("not_existing")
+	require.Error(t, err)
+
+	// the round signed by the removed server key is not quarantined
+	useKeyRing(t, map[string]string{"other": "key"}, "other")
+	db.(*Cache).Evict(round.ID)
+	count = tamperEvents.Value()
+	_, res, err = play(round.ID, true, func(r *Round) string { return r.Result("u1") })
+	require.NoError(t, err)
+	require.Equal(t, msgUnknownKey, res)
+	require.Equal(t, count, tamperEvents.Value())
+	quarantined, err = ts.Quarantined(round.ID)
+	require.NoError(t, err)
+	require.False(t, quarantined)
+}
+
+func Test3_TamperAdmin(t *testing.T) {
+	handler := admin("token", func(w http.ResponseWriter, req *http.Request) {})
+
+	for token, code := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "token": http.StatusOK} {
+		req := httptest.NewRequest("GET", "/admin/tamper", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		require.Equal(t, code, w.Code, token)
+	}
+
+	w := httptest.NewRecorder()
+	admin("", handler)(w, httptest.NewRequest("GET", "/admin/tamper", bytes.NewReader(nil)))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// TeamRound is a round of stone scissors paper between two teams of 2 or 3 players. Every team member places
+// the hidden bet and discloses it as in the two-player Round. The team's gesture is decided by the decision rule:
+// 'majority' - the most frequent gesture of team, the captain's gesture wins a tie,
+// 'captain' - the gesture of captain (the first member of team).
+// Then the team gestures are resolved by the normal rules.
+type TeamRound struct {
+	mx        sync.Mutex // guard for async updates
+	ID        string     `json:"id"`                  // round id
+	Size      int        `json:"size"`                // number of players in team
+	Decision  string     `json:"decision"`            // decision rule of team gesture
+	Teams     [2]Team    `json:"teams"`               // first and second teams
+	State     State      `json:"state"`               // round state
+	Winner    int        `json:"winner"`              // 'nobody' - not finished, 'first'|'second'|'draw' - winning team
+	Signature string     `json:"signature"`           // round signature (calculated without itself)
+	KeyID     string     `json:"keyid,omitempty"`     // id of server key used for the signature
+	HashKeyID string     `json:"hashkeyid,omitempty"` // id of server key used for the players' hashes
+}
+
+// Team is the team of TeamRound
+type Team struct {
+	Members []Seat  `json:"members"`       // team members, the first one is the captain
+	Bet     Gesture `json:"bet,omitempty"` // team's gesture
+}
+
+const (
+	// decision rules of team gesture
+	decisionMajority = "majority"
+	decisionCaptain  = "captain"
+)
+
+// NewTeamRound returns new open TeamRound for teams of size players. The player is the captain of the first team.
+func NewTeamRound(player string, size int, decision string) (*TeamRound, error) {
+	if size != 2 && size != 3 {
+		return nil, fmt.Errorf("team size has to be 2 or 3")
+	}
+	if decision == "" {
+		decision = decisionMajority
+	}
+	if decision != decisionMajority && decision != decisionCaptain {
+		return nil, fmt.Errorf("unknown decision: %q", decision)
+	}
+	r := &TeamRound{
+		ID:        uuid.NewString(),
+		Size:      size,
+		Decision:  decision,
+		State:     StateOpen,
+		HashKeyID: ring.active,
+	}
+	r.Teams[0].Members = []Seat{{Player: r.hash(player)}}
+	r.Teams[1].Members = []Seat{}
+	r.signing().reSign()
+	return r, nil
+}
+
+// teamTransitions are the allowed transitions between team round states
+var teamTransitions = map[State][]State{
+	StateOpen:       {StateBetting},
+	StateBetting:    {StateDisclosing},
+	StateDisclosing: {StateFinished},
+}
+
+// transition applies the change of round data and moves the round to the state to. Nothing is changed when
+// the transition is not allowed: it returns the error in this case.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *TeamRound) transition(to State, change func()) error {
+	if !allowed(teamTransitions, r.State, to) {
+		return fmt.Errorf("team round %s: transition from %s to %s is not allowed", r.ID, r.State, to)
+	}
+	change()
+	r.State = to
+	return nil
+}
+
+// hash returns the salted hash of obj made with the server key of players' hashes
+func (r *TeamRound) hash(obj interface{}) string {
+	return keyHash(r.HashKeyID, r.ID, obj)
+}
+
+// signing returns the signature of team round
+func (r *TeamRound) signing() signing {
+	return signing{id: r.ID, obj: r, keyID: &r.KeyID, hashKeyID: r.HashKeyID, signature: &r.Signature}
+}
+
+// member returns the team index and member index of player or -1, -1 when the player is not in teams.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *TeamRound) member(player string) (int, int) {
+	h := r.hash(player)
+	for t := range r.Teams {
+		for m, tm := range r.Teams[t].Members {
+			if h != "" && tm.Player == h {
+				return t, m
+			}
+		}
+	}
+	return -1, -1
+}
+
+// check returns the member of player or the error message when the round can't be played by player
+func (r *TeamRound) check(player string) (*Seat, int, string) {
+	if res := r.signing().err(); res != "" {
+		return nil, -1, res
+	}
+	t, m := r.member(player)
+	if t < 0 {
+		return nil, -1, msgUnauthorized
+	}
+	return &r.Teams[t].Members[m], t, ""
+}
+
+// Join adds the player to the team (1 or 2). The first player of the second team is its captain.
+func (r *TeamRound) Join(player string, team int) string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if res := r.signing().err(); res != "" {
+		return res
+	}
+	if t, _ := r.member(player); t >= 0 {
+		return "You have already joined this round"
+	}
+	if team != 1 && team != 2 {
+		return "team has to be 1 or 2"
+	}
+	if r.State != StateOpen || len(r.Teams[team-1].Members) == r.Size {
+		return "this team is already full"
+	}
+	join := func() { r.Teams[team-1].Members = append(r.Teams[team-1].Members, Seat{Player: r.hash(player)}) }
+	if len(r.Teams[0].Members)+len(r.Teams[1].Members)+1 < 2*r.Size {
+		join()
+	} else if err := r.transition(StateBetting, join); err != nil {
+		log.Println(err)
+		return "this team is already full"
+	}
+	r.signing().reSign()
+	return r.result(player)
+}
+
+// Bet makes the member's hidden bet
+func (r *TeamRound) Bet(hiddenBet, player string) string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	m, _, res := r.check(player)
+	if res != "" {
+		return res
+	}
+	if !validCommitment(hiddenBet) {
+		return "unsupported commitment format"
+	}
+	if r.State != StateBetting || m.HiddenBet != "" {
+		return r.result(player)
+	}
+	place := func() { m.HiddenBet = hiddenBet }
+	if r.all(func(tm *Seat) bool { return tm == m || tm.HiddenBet != "" }) {
+		// the last hidden bet
+		if err := r.transition(StateDisclosing, place); err != nil {
+			log.Println(err)
+			return r.result(player)
+		}
+	} else {
+		place()
+	}
+	r.signing().reSign()
+	return r.result(player)
+}
+
+// Disclose discloses the member's bet
+func (r *TeamRound) Disclose(secret, bet, player string) string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	m, _, res := r.check(player)
+	if res != "" {
+		return res
+	}
+	if r.State != StateDisclosing || m.Bet != nothing {
+		return r.result(player)
+	}
+	if res := m.disclose(r.ID, secret, bet); res != "" {
+		return res
+	}
+	if r.all(func(tm *Seat) bool { return tm.Bet != nothing }) {
+		// the last disclosure: find the winner
+		err := r.transition(StateFinished, func() {
+			for t := range r.Teams {
+				r.Teams[t].Bet = r.teamGesture(r.Teams[t].Members)
+			}
+			r.Winner = rules[r.Teams[0].Bet][r.Teams[1].Bet]
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	r.signing().reSign()
+	return r.result(player)
+}
+
+// Result returns the round result for player
+func (r *TeamRound) Result(player string) string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if _, _, res := r.check(player); res != "" {
+		return res
+	}
+	return r.result(player)
+}
+
+// Pseudonym returns the player's pseudonym that binds the v2 commitments, it is empty when the player is not in teams
+func (r *TeamRound) Pseudonym(player string) string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if t, m := r.member(player); t >= 0 {
+		return r.Teams[t].Members[m].Player
+	}
+	return ""
+}
+
+// teamGesture returns the team's gesture by the decision rule
+func (r *TeamRound) teamGesture(members []Seat) Gesture {
+	captain := members[0].Bet
+	if r.Decision == decisionCaptain {
+		return captain
+	}
+	votes := map[Gesture]int{}
+	for _, m := range members {
+		votes[m.Bet]++
+	}
+	best := captain
+	for g, v := range votes {
+		if v > votes[best] {
+			best = g
+		}
+	}
+	return best
+}
+
+// all checks that the condition is true for all members of both teams.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *TeamRound) all(cond func(tm *Seat) bool) bool {
+	for t := range r.Teams {
+		for m := range r.Teams[t].Members {
+			if !cond(&r.Teams[t].Members[m]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// result describes the round state for player.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *TeamRound) result(player string) string {
+	t, m := r.member(player)
+	me := r.Teams[t].Members[m]
+	switch {
+	case r.State == StateOpen:
+		return fmt.Sprintf("wait for teams to be filled (%d and %d of %d)",
+			len(r.Teams[0].Members), len(r.Teams[1].Members), r.Size)
+	case r.State == StateBetting && me.HiddenBet == "":
+		return "place Your bet, please"
+	case r.State == StateBetting:
+		return "wait for other players to place their bets"
+	case r.State == StateDisclosing && me.Bet == nothing:
+		return "disclose your bet, please"
+	case r.State == StateDisclosing:
+		return "wait for other players to disclose their bets"
+	}
+	resp := "draw"
+	if r.Winner == first && t == 0 || r.Winner == second && t == 1 {
+		resp = "Your team won"
+	} else if r.Winner != draw {
+		resp = "Your team lose"
+	}
+	return fmt.Sprintf("%s: your team's bet: %s, the rival team's bet: %s", resp, r.Teams[t].Bet, r.Teams[1-t].Bet)
+}
+
+// TeamStore is an interface of the persistence layer of team rounds
+type TeamStore interface {
+	StoreTeamRound(*TeamRound) error
+	RetrieveTeamRound(id string) (*TeamRound, error)
+	// UpdateTeamRound retrieves the team round, makes the move and stores the changed round when it is not
+	// changed concurrently, otherwise the move is repeated for the new round. The round is not stored when
+	// the move reports the falsification or the unknown server key.
+	UpdateTeamRound(id string, move func(r *TeamRound) string) (*TeamRound, string, error)
+}
+
+// teams is the storage of team rounds
+var teams TeamStore
+
+// redisTeams is a Redis implementation of TeamStore interface
+type redisTeams struct {
+	r redis.UniversalClient
+}
+
+// NewTeamStore returns a new instance of TeamStore interface implementing the persistence layer via Redis
+func NewTeamStore(opt redis.UniversalOptions) (TeamStore, error) {
+	s := &redisTeams{redis.NewUniversalClient(&opt)}
+	// try to ping database
+	if err := s.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StoreTeamRound stores the team round
+func (s *redisTeams) StoreTeamRound(r *TeamRound) error {
+	r.mx.Lock()
+	data, _ := json.Marshal(r)
+	r.mx.Unlock()
+	return s.r.Set("team:"+r.ID, data, time.Hour*8760).Err()
+}
+
+// RetrieveTeamRound reads the team round
+func (s *redisTeams) RetrieveTeamRound(id string) (*TeamRound, error) {
+	data, err := s.r.Get("team:" + id).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	r := &TeamRound{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateTeamRound makes the move of team round with the compare-and-set of the stored round
+func (s *redisTeams) UpdateTeamRound(id string, move func(r *TeamRound) string) (r *TeamRound, res string, err error) {
+	err = casUpdate(s.r, "team:"+id, time.Hour*8760, func(data []byte) ([]byte, error) {
+		r = &TeamRound{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return nil, err
+		}
+		res = move(r)
+		if res == msgFalsificated || res == msgUnknownKey {
+			return nil, nil
+		}
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		return json.Marshal(r)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return r, res, nil
+}
+
+// playTeam retrieves the team round and makes the move. The changed round is stored when store is true.
+func playTeam(id string, store bool, move func(r *TeamRound) string) (*TeamRound, string, error) {
+	if store {
+		r, res, err := teams.UpdateTeamRound(id, move)
+		if err != nil {
+			return nil, "", fmt.Errorf("Team round update error: %w", err)
+		}
+		return r, res, nil
+	}
+	r, err := teams.RetrieveTeamRound(id)
+	if err != nil {
+		return nil, "", fmt.Errorf("Team round retrieve error: %w", err)
+	}
+	return r, move(r), nil
+}
+
+// TeamRequests realizes the requests for team rounds:
+// /team/new, /team/join, /team/bet, /team/disclose and /team/result
+func TeamRequests(w http.ResponseWriter, req *http.Request) {
+	input := struct {
+		Round    string `json:"round"`
+		Player   string `json:"player"`
+		Size     int    `json:"size"`
+		Decision string `json:"decision"`
+		Team     int    `json:"team"`
+		Bet      string `json:"bet"`
+		Secret   string `json:"secret"`
+	}{}
+	if err := getInput(req, &input); err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := strings.TrimPrefix(req.URL.Path, "/team/")
+	missed := input.Player == "" ||
+		action != "new" && input.Round == "" ||
+		action == "join" && input.Team == 0 ||
+		(action == "bet" || action == "disclose") && input.Bet == "" ||
+		action == "disclose" && input.Secret == ""
+	if missed {
+		errMsg := fmt.Sprintf("Some mandatory fields are missed: %+v", input)
+		log.Println(errMsg)
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	var move func(r *TeamRound) string
+	switch action {
+	case "new":
+		r, err := NewTeamRound(input.Player, input.Size, input.Decision)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := teams.StoreTeamRound(r); err != nil {
+			storageError(fmt.Errorf("Team round store error: %w", err), w)
+			return
+		}
+		sendResponse(w, struct {
+			Round     string `json:"round"`
+			Pseudonym string `json:"pseudonym"`
+		}{r.ID, r.Teams[0].Members[0].Player})
+		log.Printf("new team round: %s for %d vs %d started by %s", r.ID, r.Size, r.Size, input.Player)
+		return
+	case "join":
+		move = func(r *TeamRound) string { return r.Join(input.Player, input.Team) }
+	case "bet":
+		move = func(r *TeamRound) string { return r.Bet(input.Bet, input.Player) }
+	case "disclose":
+		move = func(r *TeamRound) string { return r.Disclose(input.Secret, input.Bet, input.Player) }
+	case "result":
+		move = func(r *TeamRound) string { return r.Result(input.Player) }
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	r, res, err := playTeam(input.Round, action != "result", move)
+	if err != nil {
+		storageError(err, w)
+		return
+	}
+	pseudonym := ""
+	if action == "join" {
+		pseudonym = r.Pseudonym(input.Player)
+	}
+	sendResponse(w, struct {
+		Response  string `json:"response"`
+		Pseudonym string `json:"pseudonym,omitempty"`
+	}{res, pseudonym})
+	log.Printf("team round: %s:%s - %s result: %s", r.ID, input.Player, action, res)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// playTeamRound makes the bets and disclosures of players and returns their results
+func playTeamRound(t *testing.T, r *TeamRound, bets map[string]string) map[string]string {
+	for player, bet := range bets {
+		r.Bet(saltedHash(player+" secret", bet), player)
+	}
+	for player, bet := range bets {
+		r.Disclose(player+" secret", bet, player)
+	}
+	res := map[string]string{}
+	for player := range bets {
+		res[player] = r.Result(player)
+	}
+	return res
+}
+
+func Test1_TeamRoundMajority(t *testing.T) {
+	_, err := NewTeamRound("a1", 4, "")
+	require.Error(t, err)
+	_, err = NewTeamRound("a1", 2, "vote")
+	require.Error(t, err)
+
+	r, err := NewTeamRound("a1", 3, "")
+	require.NoError(t, err)
+	require.Equal(t, decisionMajority, r.Decision)
+	require.Equal(t, "wait for teams to be filled (1 and 0 of 3)", r.Result("a1"))
+	require.Equal(t, "You have already joined this round", r.Join("a1", 2))
+	require.Equal(t, "team has to be 1 or 2", r.Join("a2", 3))
+	require.Equal(t, "wait for teams to be filled (2 and 0 of 3)", r.Join("a2", 1))
+	r.Join("a3", 1)
+	require.Equal(t, "this team is already full", r.Join("a4", 1))
+	r.Join("b1", 2)
+	r.Join("b2", 2)
+	require.Equal(t, "place Your bet, please", r.Join("b3", 2))
+	require.Equal(t, msgUnauthorized, r.Result("a4"))
+
+	require.Equal(t, "wait for other players to place their bets", r.Bet(saltedHash("a1 secret", "stone"), "a1"))
+	// captain's bet is decided by majority: paper
+	res := playTeamRound(t, r, map[string]string{
+		"a1": "stone", "a2": "paper", "a3": "paper",
+		"b1": "stone", "b2": "scissors", "b3": "stone",
+	})
+	require.Equal(t, "Your team won: your team's bet: paper, the rival team's bet: stone", res["a1"])
+	require.Equal(t, "Your team lose: your team's bet: stone, the rival team's bet: paper", res["b2"])
+	require.Equal(t, StateFinished, r.State)
+	require.Equal(t, first, r.Winner)
+	// the finished round isn't changed by the transition
+	require.Error(t, r.transition(StateBetting, func() { r.Winner = draw }))
+	require.Equal(t, first, r.Winner)
+
+	r.Teams[1].Bet = scissors
+	require.Equal(t, msgFalsificated, r.Result("a1"))
+}
+
+func Test2_TeamRoundCaptain(t *testing.T) {
+	r, err := NewTeamRound("a1", 2, decisionCaptain)
+	require.NoError(t, err)
+	r.Join("b1", 2)
+	r.Join("a2", 1)
+	r.Join("b2", 2)
+
+	r.Bet(saltedHash("a1 secret", "stone"), "a1")
+	r.Bet(saltedHash("a2 secret", "paper"), "a2")
+	r.Bet(saltedHash("b1 secret", "stone"), "b1")
+	require.Equal(t, "disclose your bet, please", r.Bet(saltedHash("b2 secret", "paper"), "b2"))
+	require.Equal(t, "unknown bet", r.Disclose("a1 secret", "rock", "a1"))
+	require.Equal(t, "Your bet is incorrect", r.Disclose("a1 secret", "paper", "a1"))
+	r.Disclose("a1 secret", "stone", "a1")
+	require.Equal(t, "wait for other players to disclose their bets", r.Result("a1"))
+	r.Disclose("a2 secret", "paper", "a2")
+	r.Disclose("b1 secret", "stone", "b1")
+	require.Equal(t, "draw: your team's bet: stone, the rival team's bet: stone", r.Disclose("b2 secret", "paper", "b2"))
+
+	// majority tie is broken by the captain
+	r.Decision = decisionMajority
+	require.Equal(t, stone, r.teamGesture(r.Teams[0].Members))
+}
+
+func Test3_TeamService(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	data, err := request("team/new", []byte(`{"player":"a1","size":2,"decision":"captain"}`))
+	require.NoError(t, err)
+	created := struct {
+		Round string `json:"round"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &created))
+
+	for player, team := range map[string]int{"a2": 1, "b1": 2, "b2": 2} {
+		_, err = request("team/join", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"team":%d}`,
+			created.Round, player, team)))
+		require.NoError(t, err)
+	}
+	bets := map[string]string{"a1": "scissors", "a2": "stone", "b1": "paper", "b2": "paper"}
+	for player, bet := range bets {
+		_, err = request("team/bet", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q}`,
+			created.Round, player, saltedHash(player, bet))))
+		require.NoError(t, err)
+	}
+	for player, bet := range bets {
+		_, err = request("team/disclose", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"bet":%q,"secret":%q}`,
+			created.Round, player, bet, player)))
+		require.NoError(t, err)
+	}
+	data, err = request("team/result", []byte(fmt.Sprintf(`{"round":%q,"player":"a2"}`, created.Round)))
+	require.NoError(t, err)
+	require.Equal(t, `{"response":"Your team won: your team's bet: scissors, the rival team's bet: paper"}`, string(data))
+
+	data, err = request("team/new", []byte(`{"player":"a1","size":5}`))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "team size has to be 2 or 3")
+
+	_, err = NewTeamStore(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}})
+	require.Error(t, err)
+
+	// the concurrent joins are not lost
+	data, err = request("team/new", []byte(`{"player":"a1","size":3}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &created))
+	wg := sync.WaitGroup{}
+	for player, team := range map[string]int{"a2": 1, "a3": 1, "b1": 2, "b2": 2, "b3": 2} {
+		wg.Add(1)
+		go func(player string, team int) {
+			defer wg.Done()
+			_, err := request("team/join", []byte(fmt.Sprintf(`{"round":%q,"player":%q,"team":%d}`,
+				created.Round, player, team)))
+			require.NoError(t, err)
+		}(player, team)
+	}
+	wg.Wait()
+	r, err := teams.RetrieveTeamRound(created.Round)
+	require.NoError(t, err)
+	require.Len(t, r.Teams[0].Members, 3)
+	require.Len(t, r.Teams[1].Members, 3)
+	require.Equal(t, StateBetting, r.State)
+}
@@ -0,0 +1,71 @@
+package main
+
+import "time"
+
+// now returns the current server time. It is a variable to make the time predictable in tests.
+var now = time.Now
+
+// Timeline is the server times (Unix time in milliseconds) of round events. The events of legacy rounds
+// that happened before the timeline was added are not set.
+type Timeline struct {
+	Created   int64 `json:"created,omitempty"`   // round is started
+	Attached  int64 `json:"attached,omitempty"`  // second player is attached
+	Bet1      int64 `json:"bet1,omitempty"`      // player1 placed the hidden bet
+	Bet2      int64 `json:"bet2,omitempty"`      // player2 placed the hidden bet
+	Disclose1 int64 `json:"disclose1,omitempty"` // player1's bet is disclosed
+	Disclose2 int64 `json:"disclose2,omitempty"` // player2's bet is disclosed
+	Resolved  int64 `json:"resolved,omitempty"`  // round got the result
+}
+
+// PlayerTimeline is the round timeline from the point of view of one player
+type PlayerTimeline struct {
+	Created       int64 `json:"created,omitempty"`
+	Attached      int64 `json:"attached,omitempty"`
+	YourBet       int64 `json:"your_bet,omitempty"`
+	RivalBet      int64 `json:"rival_bet,omitempty"`
+	YourDisclose  int64 `json:"your_disclose,omitempty"`
+	RivalDisclose int64 `json:"rival_disclose,omitempty"`
+	Resolved      int64 `json:"resolved,omitempty"`
+}
+
+// timeline returns the round timeline, it creates the timeline for legacy rounds.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) timeline() *Timeline {
+	if r.Times == nil {
+		r.Times = &Timeline{}
+	}
+	return r.Times
+}
+
+// copyTimeline returns the copy of round timeline that can be used without the round lock.
+// It is not protected against data racing and have to be called after mx.Lock()
+func (r *Round) copyTimeline() *Timeline {
+	if r.Times == nil {
+		return nil
+	}
+	t := *r.Times
+	return &t
+}
+
+// nowMilli returns the current server time as Unix time in milliseconds
+func nowMilli() int64 {
+	return now().UnixMilli()
+}
+
+// PlayerTimeline returns the timeline of round for player. It returns nil when the round has no timeline
+// or when the player can't get it.
+func (r *Round) PlayerTimeline(player string) *PlayerTimeline {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.Times == nil || r.check(player) != "" {
+		return nil
+	}
+	t := r.Times
+	pt := &PlayerTimeline{Created: t.Created, Attached: t.Attached, Resolved: t.Resolved}
+	if r.Player1 == r.roundSaltedHash(player) {
+		pt.YourBet, pt.RivalBet, pt.YourDisclose, pt.RivalDisclose = t.Bet1, t.Bet2, t.Disclose1, t.Disclose2
+	} else {
+		pt.YourBet, pt.RivalBet, pt.YourDisclose, pt.RivalDisclose = t.Bet2, t.Bet1, t.Disclose2, t.Disclose1
+	}
+	return pt
+}
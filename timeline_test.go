@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test1_Timeline(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	defer func(prev func() time.Time) { now = prev }(now)
+	ms := int64(1000)
+	now = func() time.Time {
+		ms++
+		return time.UnixMilli(ms)
+	}
+
+	tr := NewRound(player1)
+	tr.Attach(player2)
+	tr.Bet(tr.saltedHash("my 2 secret", []byte("stone")), player2)
+	tr.Bet(tr.saltedHash("my secret", []byte("paper")), player1)
+	tr.Disclose("my secret", "paper", player1)
+	tr.Disclose("my 2 secret", "stone", player2)
+
+	require.Equal(t, &Timeline{
+		Created:   1001,
+		Attached:  1002,
+		Bet2:      1003,
+		Bet1:      1004,
+		Disclose1: 1005,
+		Disclose2: 1006,
+		Resolved:  1007,
+	}, tr.Times)
+
+	require.Equal(t, &PlayerTimeline{
+		Created:       1001,
+		Attached:      1002,
+		YourBet:       1003,
+		RivalBet:      1004,
+		YourDisclose:  1006,
+		RivalDisclose: 1005,
+		Resolved:      1007,
+	}, tr.PlayerTimeline(player2))
+	require.Equal(t, int64(1004), tr.PlayerTimeline(player1).YourBet)
+	require.Nil(t, tr.PlayerTimeline("player3"))
+
+	transcript, res := tr.Transcript()
+	require.Empty(t, res)
+	require.Equal(t, tr.Times, transcript.Timeline)
+}
+
+func Test2_TimelineLegacy(t *testing.T) {
+	player1 := "player1"
+	player2 := "player2"
+
+	tr := NewRound(player1)
+	tr.Attach(player2)
+
+	// the round stored before the timeline was added
+	tr.Times = nil
+	tr.reSing()
+	data, _ := json.Marshal(tr)
+	require.NotContains(t, string(data), `"timeline"`)
+	legacy := &Round{}
+	require.NoError(t, json.Unmarshal(data, legacy))
+	require.Nil(t, legacy.PlayerTimeline(player1))
+
+	require.Equal(t, "wait for the rival to place its bet", legacy.Bet(tr.saltedHash("my secret", []byte("paper")), player1))
+	require.NotZero(t, legacy.Times.Bet1)
+	require.Zero(t, legacy.Times.Created)
+	require.True(t, legacy.Valid())
+}
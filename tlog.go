@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// The transparency log is the append-only Merkle tree (RFC 6962) of transcripts of resolved rounds.
+// The leaf hash is sha256(0x00 || entry) and the node hash is sha256(0x01 || left || right).
+
+// TreeHead is the signed tree head of the transparency log
+type TreeHead struct {
+	TreeSize  int64  `json:"tree_size"` // number of entries in the log
+	RootHash  []byte `json:"root_hash"` // Merkle tree root hash
+	Timestamp int64  `json:"timestamp"` // signing time (Unix time in milliseconds)
+	KeyID     string `json:"kid"`       // id of the signing key
+	Signature []byte `json:"signature"` // Ed25519 signature of the tree head
+}
+
+// TransparencyLog is an interface of the transparency log storage
+type TransparencyLog interface {
+	// Append adds the transcript to log once per round. It returns the index of log entry.
+	Append(t *Transcript) (int64, error)
+	// Size returns the number of entries
+	Size() (int64, error)
+	// Node returns the hash of complete subtree of 2^level leaves that starts from the leaf index<<level.
+	// The leaf hashes are the nodes of level 0.
+	Node(level uint, index int64) ([]byte, error)
+	// Entry returns the index and the entry of round
+	Entry(round string) (int64, []byte, error)
+	// TreeHead returns the signed tree head of size, it returns redis.Nil when the head of size isn't signed yet
+	TreeHead(size int64) (*TreeHead, error)
+	// StoreTreeHead stores the signed tree head once per tree size. It returns the stored head of the same size.
+	StoreTreeHead(h *TreeHead) (*TreeHead, error)
+	// Queue stores the transcript to be appended, it is removed from the queue by Append
+	Queue(t *Transcript) error
+	// Queued returns the queued transcripts
+	Queued() ([]*Transcript, error)
+}
+
+// tlog is the transparency log fed by resolved rounds. Rounds are not logged when it is nil.
+var tlog TransparencyLog
+
+const (
+	sthDomain = "stone_scissors_paper/sth/v1"
+
+	tlogRetryInterval = time.Minute // how often the failed appends are retried
+)
+
+// tlogRetry is the queue of transcripts that failed to be queued in Redis and appended to the transparency log
+var tlogRetry = struct {
+	sync.Mutex
+	transcripts map[string]*Transcript // by round id
+}{transcripts: map[string]*Transcript{}}
+
+// redisLog is a Redis implementation of TransparencyLog interface
+type redisLog struct {
+	r redis.UniversalClient
+}
+
+// the keys have the same hash tag to be in one slot of Redis cluster
+const (
+	tlogEntries = "{tlog}:entries" // list of entries
+	tlogHashes  = "{tlog}:hashes"  // list of leaf hashes
+	tlogIndex   = "{tlog}:index"   // hash of entry indexes by round id
+	tlogNodes   = "{tlog}:nodes"   // hash of complete subtree hashes by "<level>:<index>"
+	tlogHeads   = "{tlog}:heads"   // hash of signed tree heads by tree size
+	tlogQueue   = "{tlog}:queue"   // hash of transcripts to append by round id
+)
+
+// appendScript appends entry and leaf hash atomically when the round is not logged yet and removes the round
+// from the queue
+var appendScript = redis.NewScript(`
+redis.call('HDEL', KEYS[4], ARGV[1])
+local idx = redis.call('HGET', KEYS[3], ARGV[1])
+if idx then
+	return tonumber(idx)
+end
+local n = redis.call('RPUSH', KEYS[1], ARGV[2])
+redis.call('RPUSH', KEYS[2], ARGV[3])
+redis.call('HSET', KEYS[3], ARGV[1], n - 1)
+return n - 1
+`)
+
+// NewTransparencyLog returns a new instance of TransparencyLog interface implementing the storage via Redis
+func NewTransparencyLog(opt redis.UniversalOptions) (TransparencyLog, error) {
+	l := &redisLog{redis.NewUniversalClient(&opt)}
+	// try to ping database
+	if err := l.r.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append adds the transcript to log. The hashes of subtrees completed by the entry are cached.
+func (l *redisLog) Append(t *Transcript) (int64, error) {
+	entry, _ := json.Marshal(t)
+	idx, err := appendScript.Run(l.r, []string{tlogEntries, tlogHashes, tlogIndex, tlogQueue}, t.Round, entry, leafHash(entry)).Int64()
+	if err != nil {
+		return 0, err
+	}
+	for level := uint(1); (idx+1)%(1<<level) == 0; level++ {
+		if _, err := l.Node(level, idx>>level); err != nil {
+			// the node is calculated again when it is needed
+			log.Printf("transparency log node %d:%d error: %v", level, idx>>level, err)
+			break
+		}
+	}
+	return idx, nil
+}
+
+// Queue stores the transcript JSON in the hash of queued transcripts
+func (l *redisLog) Queue(t *Transcript) error {
+	entry, _ := json.Marshal(t)
+	return l.r.HSet(tlogQueue, t.Round, entry).Err()
+}
+
+// Queued reads the hash of queued transcripts
+func (l *redisLog) Queued() ([]*Transcript, error) {
+	list, err := l.r.HGetAll(tlogQueue).Result()
+	if err != nil {
+		return nil, err
+	}
+	queued := make([]*Transcript, 0, len(list))
+	for round, data := range list {
+		t := &Transcript{}
+		if err := json.Unmarshal([]byte(data), t); err != nil {
+			return nil, fmt.Errorf("wrong queued transcript %s: %w", round, err)
+		}
+		queued = append(queued, t)
+	}
+	return queued, nil
+}
+
+// Size returns the number of entries
+func (l *redisLog) Size() (int64, error) {
+	return l.r.LLen(tlogHashes).Result()
+}
+
+// Node returns the hash of complete subtree from cache. The missed hash is calculated from its children and cached:
+// the complete subtree is never changed.
+func (l *redisLog) Node(level uint, index int64) ([]byte, error) {
+	if level == 0 {
+		return l.r.LIndex(tlogHashes, index).Bytes()
+	}
+	field := fmt.Sprintf("%d:%d", level, index)
+	if h, err := l.r.HGet(tlogNodes, field).Bytes(); err != redis.Nil {
+		return h, err
+	}
+	left, err := l.Node(level-1, 2*index)
+	if err != nil {
+		return nil, err
+	}
+	right, err := l.Node(level-1, 2*index+1)
+	if err != nil {
+		return nil, err
+	}
+	h := nodeHash(left, right)
+	if err := l.r.HSet(tlogNodes, field, h).Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Entry returns the index and the entry of round
+func (l *redisLog) Entry(round string) (int64, []byte, error) {
+	idx, err := l.r.HGet(tlogIndex, round).Int64()
+	if err != nil {
+		return 0, nil, err
+	}
+	entry, err := l.r.LIndex(tlogEntries, idx).Bytes()
+	if err != nil {
+		return 0, nil, err
+	}
+	return idx, entry, nil
+}
+
+// TreeHead returns the signed tree head of size
+func (l *redisLog) TreeHead(size int64) (*TreeHead, error) {
+	data, err := l.r.HGet(tlogHeads, strconv.FormatInt(size, 10)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	h := &TreeHead{}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// StoreTreeHead stores the signed tree head, the head signed concurrently for the same size is kept
+func (l *redisLog) StoreTreeHead(h *TreeHead) (*TreeHead, error) {
+	data, _ := json.Marshal(h)
+	if err := l.r.HSetNX(tlogHeads, strconv.FormatInt(h.TreeSize, 10), data).Err(); err != nil {
+		return nil, err
+	}
+	return l.TreeHead(h.TreeSize)
+}
+
+// leafHash returns the hash of log entry
+func leafHash(entry []byte) []byte {
+	h := sha256.Sum256(append([]byte{0}, entry...))
+	return h[:]
+}
+
+// nodeHash returns the hash of inner node
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// split returns the largest power of 2 smaller than n
+func split(n int64) int64 {
+	k := int64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// nodeSource returns the hash of complete subtree of 2^level leaves that starts from the leaf index<<level
+type nodeSource func(level uint, index int64) ([]byte, error)
+
+// leavesSource returns the source of subtree hashes calculated from leaves
+func leavesSource(leaves [][]byte) nodeSource {
+	var node nodeSource
+	node = func(level uint, index int64) ([]byte, error) {
+		if level == 0 {
+			return leaves[index], nil
+		}
+		left, _ := node(level-1, 2*index)
+		right, _ := node(level-1, 2*index+1)
+		return nodeHash(left, right), nil
+	}
+	return node
+}
+
+// rootHash returns Merkle tree hash of leaves
+func rootHash(leaves [][]byte) []byte {
+	h, _ := treeHash(leavesSource(leaves), 0, int64(len(leaves)))
+	return h
+}
+
+// treeHash returns Merkle tree hash of n leaves starting from the leaf start. Each left subtree of the tree
+// is complete, so only O(log n) nodes are requested from src.
+func treeHash(src nodeSource, start, n int64) ([]byte, error) {
+	switch {
+	case n == 0:
+		h := sha256.Sum256(nil)
+		return h[:], nil
+	case n&(n-1) == 0: // the complete subtree
+		level := uint(bits.TrailingZeros64(uint64(n)))
+		return src(level, start>>level)
+	}
+	k := split(n)
+	left, err := treeHash(src, start, k)
+	if err != nil {
+		return nil, err
+	}
+	right, err := treeHash(src, start+k, n-k)
+	if err != nil {
+		return nil, err
+	}
+	return nodeHash(left, right), nil
+}
+
+// inclusionProof returns the audit path of leaf m in the tree of n leaves starting from the leaf start
+func inclusionProof(src nodeSource, m, start, n int64) ([][]byte, error) {
+	if n <= 1 {
+		return [][]byte{}, nil
+	}
+	k := split(n)
+	if m < k {
+		path, err := inclusionProof(src, m, start, k)
+		if err != nil {
+			return nil, err
+		}
+		right, err := treeHash(src, start+k, n-k)
+		return append(path, right), err
+	}
+	path, err := inclusionProof(src, m-k, start+k, n-k)
+	if err != nil {
+		return nil, err
+	}
+	left, err := treeHash(src, start, k)
+	return append(path, left), err
+}
+
+// consistencyProof returns the proof that the tree of first m leaves is the prefix of the tree of n leaves
+func consistencyProof(src nodeSource, m, n int64) ([][]byte, error) {
+	if m <= 0 || m >= n {
+		return [][]byte{}, nil
+	}
+	return subProof(src, m, 0, n, true)
+}
+
+func subProof(src nodeSource, m, start, n int64, complete bool) ([][]byte, error) {
+	if m == n {
+		if complete {
+			return [][]byte{}, nil
+		}
+		h, err := treeHash(src, start, n)
+		return [][]byte{h}, err
+	}
+	k := split(n)
+	if m <= k {
+		proof, err := subProof(src, m, start, k, complete)
+		if err != nil {
+			return nil, err
+		}
+		right, err := treeHash(src, start+k, n-k)
+		return append(proof, right), err
+	}
+	proof, err := subProof(src, m-k, start+k, n-k, false)
+	if err != nil {
+		return nil, err
+	}
+	left, err := treeHash(src, start, k)
+	return append(proof, left), err
+}
+
+// VerifyInclusion checks the audit path of leaf with index in the tree of size with root hash (RFC 9162, 2.1.3.2)
+func VerifyInclusion(leaf []byte, index, size int64, path [][]byte, root []byte) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+// VerifyConsistency checks the consistency proof between two tree heads (RFC 9162, 2.1.4.2)
+func VerifyConsistency(size1, size2 int64, root1, root2 []byte, proof [][]byte) bool {
+	switch {
+	case size1 < 0 || size1 > size2:
+		return false
+	case size1 == size2:
+		return len(proof) == 0 && bytes.Equal(root1, root2)
+	case size1 == 0:
+		return len(proof) == 0
+	case len(proof) == 0:
+		return false
+	}
+	if size1&(size1-1) == 0 { // size1 is an exact power of 2
+		proof = append([][]byte{root1}, proof...)
+	}
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(fr, root1) && bytes.Equal(sr, root2)
+}
+
+// treeHeadData returns the signed data of tree head
+func treeHeadData(h *TreeHead) []byte {
+	data := make([]byte, 16, 16+len(sthDomain)+len(h.RootHash))
+	binary.BigEndian.PutUint64(data, uint64(h.TreeSize))
+	binary.BigEndian.PutUint64(data[8:], uint64(h.Timestamp))
+	data = append(data, h.RootHash...)
+	return append([]byte(sthDomain), data...)
+}
+
+// SignedTreeHead returns the current tree head signed by the transcript key. The head is signed once per tree size
+// and stored, so the same head is returned till the log is changed.
+func SignedTreeHead(l TransparencyLog) (*TreeHead, error) {
+	size, err := l.Size()
+	if err != nil {
+		return nil, err
+	}
+	if h, err := l.TreeHead(size); err != redis.Nil {
+		return h, err
+	}
+	root, err := treeHash(l.Node, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := transcriptKey(ring.active)
+	h := &TreeHead{
+		TreeSize:  size,
+		RootHash:  root,
+		Timestamp: time.Now().UnixMilli(),
+		KeyID:     ring.active,
+	}
+	h.Signature = ed25519.Sign(key, treeHeadData(h))
+	return l.StoreTreeHead(h)
+}
+
+// VerifyTreeHead checks the signature of tree head
+func VerifyTreeHead(h *TreeHead, pub ed25519.PublicKey) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, treeHeadData(h), h.Signature)
+}
+
+// InclusionProof returns the index, entry and audit path of the round in the tree of size.
+// The current tree size is used when size is 0.
+func InclusionProof(l TransparencyLog, round string, size int64) (int64, []byte, [][]byte, int64, error) {
+	idx, entry, err := l.Entry(round)
+	if err != nil {
+		return 0, nil, nil, 0, err
+	}
+	current, err := l.Size()
+	if err != nil {
+		return 0, nil, nil, 0, err
+	}
+	if size == 0 {
+		size = current
+	}
+	if idx >= size || size > current {
+		return 0, nil, nil, 0, errors.New("the round is not included in the tree of requested size")
+	}
+	path, err := inclusionProof(l.Node, idx, 0, size)
+	if err != nil {
+		return 0, nil, nil, 0, err
+	}
+	return idx, entry, path, size, nil
+}
+
+// ConsistencyProof returns the consistency proof between trees of size1 and size2
+func ConsistencyProof(l TransparencyLog, size1, size2 int64) ([][]byte, error) {
+	if size1 <= 0 || size2 < size1 {
+		return nil, errors.New("wrong tree sizes")
+	}
+	current, err := l.Size()
+	if err != nil {
+		return nil, err
+	}
+	if current < size2 {
+		return nil, errors.New("the tree of requested size doesn't exist")
+	}
+	return consistencyProof(l.Node, size1, size2)
+}
+
+// appendTranscript appends the transcript of resolved round to the transparency log. The transcript is queued
+// in Redis before the append, so the failed append is retried by tlogJob after the restart of service too.
+// The transcript that can't be queued in Redis is queued in memory.
+func appendTranscript(t *Transcript) {
+	queued := tlog.Queue(t)
+	if queued != nil {
+		log.Printf("round: %s - transparency log queue error: %v", t.Round, queued)
+	}
+	idx, err := tlog.Append(t)
+	if err != nil {
+		log.Printf("round: %s - transparency log error: %v, the append will be retried", t.Round, err)
+		if queued != nil {
+			tlogRetry.Lock()
+			tlogRetry.transcripts[t.Round] = t
+			tlogRetry.Unlock()
+		}
+		return
+	}
+	log.Printf("round: %s - appended to transparency log with index %d", t.Round, idx)
+}
+
+// tlogJob retries the failed appends to the transparency log every tlogRetryInterval until stop is closed
+func tlogJob(stop <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(tlogRetryInterval):
+		case <-stop:
+			return
+		}
+		retryAppends()
+	}
+}
+
+// retryAppends appends the transcripts queued in memory and in Redis to the transparency log
+func retryAppends() {
+	if tlog == nil {
+		return
+	}
+	tlogRetry.Lock()
+	queued := tlogRetry.transcripts
+	tlogRetry.transcripts = map[string]*Transcript{}
+	tlogRetry.Unlock()
+	for _, t := range queued {
+		appendTranscript(t)
+	}
+	stored, err := tlog.Queued()
+	if err != nil {
+		log.Printf("transparency log queue error: %v", err)
+		return
+	}
+	for _, t := range stored {
+		appendTranscript(t)
+	}
+}
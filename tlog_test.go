@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = leafHash([]byte(fmt.Sprintf("entry %d", i)))
+	}
+	return leaves
+}
+
+func Test_rootHash(t *testing.T) {
+	// test vector from RFC 6962 reference implementation
+	entries := [][]byte{{}, {0x00}, {0x10}, {0x20, 0x21}, {0x30, 0x31}, {0x40, 0x41, 0x42, 0x43},
+		{0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57},
+		{0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f}}
+	leaves := [][]byte{}
+	for _, e := range entries {
+		leaves = append(leaves, leafHash(e))
+	}
+	require.Equal(t, "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328", hex.EncodeToString(rootHash(leaves)))
+	require.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", hex.EncodeToString(rootHash(nil)))
+}
+
+func Test_merkleProofs(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		leaves := testLeaves(n)
+		root := rootHash(leaves)
+		for m := 0; m < n; m++ {
+			path, err := inclusionProof(leavesSource(leaves), int64(m), 0, int64(n))
+			require.NoError(t, err)
+			require.True(t, VerifyInclusion(leaves[m], int64(m), int64(n), path, root), "n=%d m=%d", n, m)
+			require.False(t, VerifyInclusion(leaves[(m+1)%n], int64(m), int64(n), path, root) && n > 1, "n=%d m=%d", n, m)
+
+			if m == 0 {
+				continue
+			}
+			proof, err := consistencyProof(leavesSource(leaves), int64(m), int64(n))
+			require.NoError(t, err)
+			oldRoot := rootHash(leaves[:m])
+			require.True(t, VerifyConsistency(int64(m), int64(n), oldRoot, root, proof), "n=%d m=%d", n, m)
+			require.False(t, VerifyConsistency(int64(m), int64(n), root, root, proof), "n=%d m=%d", n, m)
+			if len(proof) > 0 {
+				require.False(t, VerifyConsistency(int64(m), int64(n), oldRoot, root, proof[1:]), "n=%d m=%d", n, m)
+			}
+		}
+		require.True(t, VerifyConsistency(int64(n), int64(n), root, root, nil))
+		require.False(t, VerifyInclusion(leaves[0], int64(n), int64(n), nil, root))
+	}
+	require.False(t, VerifyConsistency(2, 1, nil, nil, nil))
+}
+
+func Test_TransparencyLog(t *testing.T) {
+	_, err := NewTransparencyLog(redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}})
+	require.Error(t, err)
+
+	envSet(t) // load .env file for local test environment
+
+	config, err := newConfig()
+	require.NoError(t, err)
+
+	l, err := NewTransparencyLog(redis.UniversalOptions{Addrs: config.RedisAddrs, Password: config.RedisPassword})
+	require.NoError(t, err)
+
+	sth1, err := SignedTreeHead(l)
+	require.NoError(t, err)
+	require.True(t, VerifyTreeHead(sth1, publicTranscriptKey(sth1.KeyID)))
+
+	tr := finishedRound(t)
+	transcript, _ := tr.Transcript()
+	idx, err := l.Append(transcript)
+	require.NoError(t, err)
+	// the round is logged only once
+	idx2, err := l.Append(transcript)
+	require.NoError(t, err)
+	require.Equal(t, idx, idx2)
+
+	sth2, err := SignedTreeHead(l)
+	require.NoError(t, err)
+	require.Equal(t, sth1.TreeSize+1, sth2.TreeSize)
+	// the head is signed once per tree size and it is built from the cached subtrees
+	sth, err := SignedTreeHead(l)
+	require.NoError(t, err)
+	require.Equal(t, sth2, sth)
+	sth, err = l.TreeHead(sth2.TreeSize)
+	require.NoError(t, err)
+	require.Equal(t, sth2, sth)
+	hashes, err := l.(*redisLog).r.LRange(tlogHashes, 0, -1).Result()
+	require.NoError(t, err)
+	leaves := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		leaves[i] = []byte(h)
+	}
+	require.Equal(t, rootHash(leaves), sth2.RootHash)
+	require.True(t, VerifyTreeHead(sth2, publicTranscriptKey(sth2.KeyID)))
+	sth2.TreeSize++
+	require.False(t, VerifyTreeHead(sth2, publicTranscriptKey(sth2.KeyID)))
+	sth2.TreeSize--
+
+	i, entry, path, size, err := InclusionProof(l, tr.ID, 0)
+	require.NoError(t, err)
+	require.Equal(t, idx, i)
+	require.Equal(t, sth2.TreeSize, size)
+	require.True(t, VerifyInclusion(leafHash(entry), i, size, path, sth2.RootHash))
+	logged := &Transcript{}
+	require.NoError(t, json.Unmarshal(entry, logged))
+	require.Equal(t, transcript, logged)
+
+	_, _, _, _, err = InclusionProof(l, tr.ID, sth1.TreeSize)
+	require.Error(t, err)
+	_, _, _, _, err = InclusionProof(l, "not_existing", 0)
+	require.ErrorIs(t, err, redis.Nil)
+
+	if sth1.TreeSize > 0 {
+		proof, err := ConsistencyProof(l, sth1.TreeSize, sth2.TreeSize)
+		require.NoError(t, err)
+		require.True(t, VerifyConsistency(sth1.TreeSize, sth2.TreeSize, sth1.RootHash, sth2.RootHash, proof))
+	}
+	_, err = ConsistencyProof(l, 0, sth2.TreeSize)
+	require.Error(t, err)
+	_, err = ConsistencyProof(l, 1, sth2.TreeSize+1)
+	require.Error(t, err)
+
+	// the failed append is retried
+	defer func() { tlog = nil }()
+	tlog = &redisLog{redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{"wrong.adr:000"}})}
+	transcript, _ = finishedRound(t).Transcript()
+	appendTranscript(transcript)
+	require.Contains(t, tlogRetry.transcripts, transcript.Round)
+	tlog = l
+	retryAppends()
+	require.NotContains(t, tlogRetry.transcripts, transcript.Round)
+	_, _, err = l.Entry(transcript.Round)
+	require.NoError(t, err)
+
+	// the queue of failed appends is kept in Redis, so it survives the restart of service
+	transcript, _ = finishedRound(t).Transcript()
+	require.NoError(t, l.Queue(transcript))
+	queued, err := l.Queued()
+	require.NoError(t, err)
+	require.Contains(t, queued, transcript)
+	retryAppends()
+	_, _, err = l.Entry(transcript.Round)
+	require.NoError(t, err)
+	queued, err = l.Queued()
+	require.NoError(t, err)
+	require.NotContains(t, queued, transcript)
+}
+
+func Test_serviceTransparencyLog(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+	defer func() { tlog = nil }()
+
+	get := func(url string, v interface{}) int {
+		resp, err := http.Get("http://localhost:8080" + url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.Unmarshal(data, v))
+		}
+		return resp.StatusCode
+	}
+
+	sth1 := &TreeHead{}
+	require.Equal(t, http.StatusOK, get("/log/sth", sth1))
+
+	// play the round through the service
+	data, err := request("new", []byte(`{"player":"player1"}`))
+	require.NoError(t, err)
+	round := struct {
+		Round string `json:"round"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &round))
+	id := round.Round
+	request("attach", []byte(`{"player":"player2","round":"`+id+`"}`))
+	request("bet", []byte(`{"player":"player1","round":"`+id+`","bet":"`+saltedHash("s1", "paper")+`"}`))
+	request("bet", []byte(`{"player":"player2","round":"`+id+`","bet":"`+saltedHash("s2", "paper")+`"}`))
+	require.Equal(t, http.StatusNotFound, get("/log/inclusion?round="+id, nil))
+	request("disclose", []byte(`{"player":"player1","round":"`+id+`","bet":"paper","secret":"s1"}`))
+	data, _ = request("disclose", []byte(`{"player":"player2","round":"`+id+`","bet":"paper","secret":"s2"}`))
+	require.Equal(t, `{"response":"draw: your bet: paper, the rival's bet: paper"}`, string(data))
+	// repeated disclose doesn't change the log
+	request("disclose", []byte(`{"player":"player2","round":"`+id+`","bet":"paper","secret":"s2"}`))
+
+	sth2 := &TreeHead{}
+	require.Equal(t, http.StatusOK, get("/log/sth", sth2))
+	require.Equal(t, sth1.TreeSize+1, sth2.TreeSize)
+	require.True(t, VerifyTreeHead(sth2, publicTranscriptKey(sth2.KeyID)))
+
+	incl := struct {
+		LeafIndex int64    `json:"leaf_index"`
+		TreeSize  int64    `json:"tree_size"`
+		Entry     []byte   `json:"entry"`
+		AuditPath [][]byte `json:"audit_path"`
+	}{}
+	require.Equal(t, http.StatusOK, get(fmt.Sprintf("/log/inclusion?round=%s&tree_size=%d", id, sth2.TreeSize), &incl))
+	require.True(t, VerifyInclusion(leafHash(incl.Entry), incl.LeafIndex, incl.TreeSize, incl.AuditPath, sth2.RootHash))
+
+	if sth1.TreeSize > 0 {
+		cons := struct {
+			Consistency [][]byte `json:"consistency"`
+		}{}
+		require.Equal(t, http.StatusOK, get(fmt.Sprintf("/log/consistency?first=%d&second=%d", sth1.TreeSize, sth2.TreeSize), &cons))
+		require.True(t, VerifyConsistency(sth1.TreeSize, sth2.TreeSize, sth1.RootHash, sth2.RootHash, cons.Consistency))
+	}
+
+	sth := &TreeHead{}
+	require.Equal(t, http.StatusOK, get(fmt.Sprintf("/log/sth?tree_size=%d", sth2.TreeSize), sth))
+	require.Equal(t, sth2, sth)
+	require.Equal(t, http.StatusNotFound, get(fmt.Sprintf("/log/sth?tree_size=%d", sth2.TreeSize+100), nil))
+
+	require.Equal(t, http.StatusBadRequest, get("/log/consistency?first=2&second=1", nil))
+	require.Equal(t, http.StatusBadRequest, get("/log/consistency?first=x&second=1", nil))
+	require.Equal(t, http.StatusBadRequest, get("/log/inclusion", nil))
+	require.Equal(t, http.StatusNotFound, get("/log/unknown", nil))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Transcript is the publicly verifiable record of finished round
+type Transcript struct {
+	Round       string     `json:"round"`                // round id
+	Player1     string     `json:"player1"`              // hash of player1's token
+	Player2     string     `json:"player2"`              // hash of player2's token
+	Mode1       string     `json:"mode1"`                // bet mode of player1
+	Mode2       string     `json:"mode2"`                // bet mode of player2
+	Commitment1 string     `json:"commitment1"`          // hidden bet of player1
+	Commitment2 string     `json:"commitment2"`          // hidden bet of player2
+	Bet1        string     `json:"bet1"`                 // open bet of player1 as it was disclosed
+	Bet2        string     `json:"bet2"`                 // open bet of player2 as it was disclosed
+	Secret1     string     `json:"secret1"`              // secret of player1
+	Secret2     string     `json:"secret2"`              // secret of player2
+	Winner      string     `json:"winner"`               // 'first'|'second'|'draw'
+	Game        string     `json:"game,omitempty"`       // game name, empty - stone scissors paper
+	IssuedAt    int64      `json:"iat"`                  // transcript issue time (Unix time)
+	Timeline    *Timeline  `json:"timeline,omitempty"`   // server times of round events
+	Pairs       *Pairs     `json:"pairs,omitempty"`      // the first stage of "minus one" round
+	Points1     int        `json:"points1,omitempty"`    // points scored by player1
+	Points2     int        `json:"points2,omitempty"`    // points scored by player2
+	House       *HouseSeed `json:"house,omitempty"`      // seed of the house bot's bet (player2)
+	Substitute  bool       `json:"substitute,omitempty"` // player2 is the fallback bot
+}
+
+// JWS is the JWS flattened JSON serialization (RFC 7515) of signed transcript
+type JWS struct {
+	Protected string `json:"protected"` // BASE64URL of JWS header
+	Payload   string `json:"payload"`   // BASE64URL of transcript
+	Signature string `json:"signature"` // BASE64URL of Ed25519 signature
+}
+
+// jwsHeader is the JWS protected header
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+const (
+	transcriptDomain = "stone_scissors_paper/transcript/v1"
+	transcriptType   = "ssp-transcript+json"
+)
+
+// winners are the names of winner selection
+var winners = map[int]string{first: "first", second: "second", draw: "draw"}
+
+// transcriptKey returns the Ed25519 key for transcripts derived from the server key keyID
+func transcriptKey(keyID string) (ed25519.PrivateKey, bool) {
+	key, ok := ring.keys[keyID]
+	if !ok {
+		return nil, false
+	}
+	seed := sha256.Sum256([]byte(transcriptDomain + key))
+	return ed25519.NewKeyFromSeed(seed[:]), true
+}
+
+// Transcript returns the transcript of finished round. It returns the error message when the transcript can't be made.
+func (r *Round) Transcript() (*Transcript, string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if res := r.signatureError(); res != "" {
+		return nil, res
+	}
+
+	if r.Winner == nobody {
+		return nil, "round is not finished"
+	}
+
+	bet1, bet2 := r.Bet1.String(), r.Bet2.String()
+	if r.Disclosed1 != "" {
+		bet1 = r.Disclosed1
+	}
+	if r.Disclosed2 != "" {
+		bet2 = r.Disclosed2
+	}
+
+	return &Transcript{
+		Round:       r.ID,
+		Player1:     r.Player1,
+		Player2:     r.Player2,
+		Mode1:       r.Mode1,
+		Mode2:       r.Mode2,
+		Commitment1: r.HiddenBet1,
+		Commitment2: r.HiddenBet2,
+		Bet1:        bet1,
+		Bet2:        bet2,
+		Secret1:     r.Secret1,
+		Secret2:     r.Secret2,
+		Winner:      winners[r.Winner],
+		Game:        r.Game,
+		IssuedAt:    now().Unix(),
+		Timeline:    r.copyTimeline(),
+		Pairs:       r.Pairs,
+		Points1:     r.Points1,
+		Points2:     r.Points2,
+		House:       r.House,
+		Substitute:  r.Substitute,
+	}, ""
+}
+
+// SignTranscript signs the transcript by the transcript key derived from the active server key
+func SignTranscript(t *Transcript) *JWS {
+	key, _ := transcriptKey(ring.active)
+	header, _ := json.Marshal(jwsHeader{Alg: "EdDSA", Kid: ring.active, Typ: transcriptType})
+	payload, _ := json.Marshal(t)
+	jws := &JWS{
+		Protected: encode64(header),
+		Payload:   encode64(payload),
+	}
+	jws.Signature = encode64(ed25519.Sign(key, []byte(jws.Protected+"."+jws.Payload)))
+	return jws
+}
+
+// VerifyTranscript checks the signature of transcript and the round result. The v2 commitments are checked
+// with the players' pseudonyms of transcript. It returns the verified transcript.
+func VerifyTranscript(data []byte, pub ed25519.PublicKey) (*Transcript, error) {
+	jws := &JWS{}
+	if err := json.Unmarshal(data, jws); err != nil {
+		return nil, fmt.Errorf("wrong JWS format: %w", err)
+	}
+	bHeader, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, fmt.Errorf("wrong JWS header: %w", err)
+	}
+	header := jwsHeader{}
+	if err := json.Unmarshal(bHeader, &header); err != nil {
+		return nil, fmt.Errorf("wrong JWS header: %w", err)
+	}
+	if header.Alg != "EdDSA" || header.Typ != transcriptType {
+		return nil, fmt.Errorf("unsupported JWS: alg=%s, typ=%s", header.Alg, header.Typ)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(jws.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("wrong JWS signature: %w", err)
+	}
+	if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, []byte(jws.Protected+"."+jws.Payload), sig) {
+		return nil, errors.New("transcript signature is not valid")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("wrong JWS payload: %w", err)
+	}
+	t := &Transcript{}
+	if err := json.Unmarshal(payload, t); err != nil {
+		return nil, fmt.Errorf("wrong transcript: %w", err)
+	}
+	commitments := []struct{ commitment, bet, secret, player string }{
+		{t.Commitment1, t.Bet1, t.Secret1, t.Player1},
+		{t.Commitment2, t.Bet2, t.Secret2, t.Player2},
+	}
+	if t.Game == gameMinusOne {
+		if t.Pairs == nil {
+			return nil, errors.New("pairs of minus-one round are missed")
+		}
+		commitments = append(commitments,
+			struct{ commitment, bet, secret, player string }{t.Pairs.HiddenBet1, t.Pairs.Bet1, t.Pairs.Secret1, t.Player1},
+			struct{ commitment, bet, secret, player string }{t.Pairs.HiddenBet2, t.Pairs.Bet2, t.Pairs.Secret2, t.Player2})
+	}
+	for _, c := range commitments {
+		if !matchCommitment(t.Round, c.commitment, c.secret, c.bet, c.player) {
+			return nil, fmt.Errorf("bet %s doesn't match commitment %s", c.bet, c.commitment)
+		}
+	}
+	game, err := gameByName(t.Game)
+	if err != nil {
+		return nil, err
+	}
+	b1, err1 := parseMove(game, t.Bet1)
+	b2, err2 := parseMove(game, t.Bet2)
+	if t.Game == gameMinusOne && err1 == nil && err2 == nil {
+		b1, b2, err1 = minusOneMoves(t.Pairs.Bet1, t.Pairs.Bet2, b1, b2)
+	}
+	if err1 != nil || err2 != nil || winners[game.Winner(b1, b2)] != t.Winner {
+		return nil, fmt.Errorf("winner %s doesn't match bets %s and %s", t.Winner, t.Bet1, t.Bet2)
+	}
+	// the house bot's secret is the seed of hash chain with the HMAC of round, its bet is derived from them
+	if t.House != nil {
+		seed, ok := houseSeed(t.Secret2, t.House.Mac)
+		if !ok {
+			return nil, fmt.Errorf("house secret %s doesn't match mac %s", t.Secret2, t.House.Mac)
+		}
+		if houseMove(game, seed, t.House.Mac, t.Round) != b2 {
+			return nil, fmt.Errorf("house bet %s doesn't match seed %s", t.Bet2, seed)
+		}
+	}
+	if p1, p2 := game.Points(b1, b2); p1 != t.Points1 || p2 != t.Points2 {
+		return nil, fmt.Errorf("points %d:%d don't match bets %s and %s", t.Points1, t.Points2, t.Bet1, t.Bet2)
+	}
+	return t, nil
+}
+
+// verifyCmd realizes the command line subcommand: verify <transcript file> <public key>
+func verifyCmd(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: stone_scissors_paper verify <transcript file> <public key>")
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	pub, err := base64.RawURLEncoding.DecodeString(args[1])
+	if err != nil {
+		return fmt.Errorf("wrong public key: %w", err)
+	}
+	t, err := VerifyTranscript(data, pub)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("round %s is verified: %s: %s vs %s, issued at %s\n",
+		t.Round, t.Winner, t.Bet1, t.Bet2, time.Unix(t.IssuedAt, 0).UTC().Format(time.RFC3339))
+	return nil
+}
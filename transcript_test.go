@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func finishedRound(t *testing.T) *Round {
+	tr := NewRound("player1")
+	tr.Attach("player2")
+	tr.Bet(tr.saltedHash("my secret", []byte("paper")), "player1")
+	tr.Bet(commitmentV2("sha256", tr.ID, tr.Pseudonym("player2"), "stone", "my 2 secret"), "player2")
+	tr.Disclose("my secret", "paper", "player1")
+	require.Equal(t, "You lose: your bet: stone, the rival's bet: paper", tr.Disclose("my 2 secret", "stone", "player2"))
+	return tr
+}
+
+func publicTranscriptKey(keyID string) ed25519.PublicKey {
+	key, _ := transcriptKey(keyID)
+	return key.Public().(ed25519.PublicKey)
+}
+
+func Test_Transcript(t *testing.T) {
+	useKeyRing(t, map[string]string{"": "salt", "k1": "key1"}, "k1")
+	defer func(prev func() time.Time) { now = prev }(now)
+	now = func() time.Time { return time.Unix(1234, 0) }
+
+	tr := NewRound("player1")
+	_, res := tr.Transcript()
+	require.Equal(t, "round is not finished", res)
+
+	tr = finishedRound(t)
+	transcript, res := tr.Transcript()
+	require.Equal(t, "", res)
+	require.Equal(t, "paper", transcript.Bet1)
+	require.Equal(t, "stone", transcript.Bet2)
+	require.Equal(t, "my secret", transcript.Secret1)
+	require.Equal(t, "my 2 secret", transcript.Secret2)
+	require.Equal(t, "first", transcript.Winner)
+	require.Equal(t, modeCommit, transcript.Mode1)
+	require.Equal(t, int64(1234), transcript.IssuedAt)
+	// the transcript has its own copy of timeline
+	require.Equal(t, tr.Times, transcript.Timeline)
+	require.NotSame(t, tr.Times, transcript.Timeline)
+
+	data, _ := json.Marshal(SignTranscript(transcript))
+
+	verified, err := VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.NoError(t, err)
+	require.Equal(t, transcript, verified)
+
+	// another key
+	_, err = VerifyTranscript(data, publicTranscriptKey(""))
+	require.Error(t, err)
+	_, err = VerifyTranscript(data, nil)
+	require.Error(t, err)
+
+	// changed transcript
+	transcript.Winner = "second"
+	jws := SignTranscript(transcript)
+	jws.Payload = SignTranscript(&Transcript{Round: tr.ID, Winner: "first"}).Payload
+	data, _ = json.Marshal(jws)
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.Error(t, err)
+
+	// signed transcript with wrong result
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.EqualError(t, err, "winner second doesn't match bets paper and stone")
+
+	transcript.Winner = "first"
+	transcript.Secret1 = "wrong secret"
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.Error(t, err)
+
+	// the points are checked even when both are zero
+	transcript.Secret1 = "my secret"
+	transcript.Points1, transcript.Points2 = 0, 0
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.EqualError(t, err, "points 0:0 don't match bets paper and stone")
+	transcript.Points1 = 1
+
+	// the v2 commitment is bound to the player's pseudonym
+	transcript.Player2 = transcript.Player1
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.EqualError(t, err, "bet stone doesn't match commitment "+transcript.Commitment2)
+
+	_, err = VerifyTranscript([]byte("{~"), publicTranscriptKey("k1"))
+	require.Error(t, err)
+
+	// the legacy commitment is made from the bet as it was disclosed
+	tr2 := NewRound("player1")
+	tr2.Attach("player2")
+	tr2.Bet(tr2.saltedHash("my secret", []byte("Paper")), "player1")
+	tr2.Bet(tr2.saltedHash("my 2 secret", []byte("stone")), "player2")
+	tr2.Disclose("my secret", "Paper", "player1")
+	tr2.Disclose("my 2 secret", "stone", "player2")
+	transcript, res = tr2.Transcript()
+	require.Equal(t, "", res)
+	require.Equal(t, "Paper", transcript.Bet1)
+	require.Equal(t, "stone", transcript.Bet2)
+	data, _ = json.Marshal(SignTranscript(transcript))
+	_, err = VerifyTranscript(data, publicTranscriptKey("k1"))
+	require.NoError(t, err)
+
+	// falsificated round
+	tr.Bet1 = scissors
+	_, res = tr.Transcript()
+	require.Equal(t, msgFalsificated, res)
+}
+
+func Test_verifyCmd(t *testing.T) {
+	tr := finishedRound(t)
+	transcript, _ := tr.Transcript()
+	data, _ := json.Marshal(SignTranscript(transcript))
+	file := filepath.Join(t.TempDir(), "transcript.json")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+
+	require.NoError(t, verifyCmd([]string{file, encode64(publicTranscriptKey(ring.active))}))
+	require.Error(t, verifyCmd([]string{file}))
+	require.Error(t, verifyCmd([]string{file, "wrong key"}))
+	require.Error(t, verifyCmd([]string{file + "x", encode64(publicTranscriptKey(ring.active))}))
+}
+
+func Test_serviceTranscript(t *testing.T) {
+	envSet(t) // load .env file for test environment
+	defer stopService(startService(t))
+
+	get := func(url string) (int, []byte) {
+		resp, err := http.Get("http://localhost:8080" + url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, data
+	}
+
+	tr := NewRound("player1")
+	require.NoError(t, db.Store(tr))
+	status, _ := get("/rounds/" + tr.ID + "/transcript")
+	require.Equal(t, http.StatusConflict, status)
+
+	tr = finishedRound(t)
+	require.NoError(t, db.Store(tr))
+	status, data := get("/rounds/" + tr.ID + "/transcript")
+	require.Equal(t, http.StatusOK, status)
+
+	status, keysData := get("/keys")
+	require.Equal(t, http.StatusOK, status)
+	keys := struct {
+		Transcript []struct {
+			ID     string `json:"id"`
+			Public string `json:"public"`
+		} `json:"transcript"`
+	}{}
+	require.NoError(t, json.Unmarshal(keysData, &keys))
+	require.Equal(t, ring.active, keys.Transcript[0].ID)
+
+	file := filepath.Join(t.TempDir(), "transcript.json")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+	require.NoError(t, verifyCmd([]string{file, keys.Transcript[0].Public}))
+
+	status, _ = get("/rounds/" + tr.ID + "/unknown")
+	require.Equal(t, http.StatusNotFound, status)
+	status, _ = get("/rounds/" + tr.ID)
+	require.Equal(t, http.StatusNotFound, status)
+	status, _ = get("/rounds/not_existing/transcript")
+	require.Equal(t, http.StatusInternalServerError, status)
+
+	resp, err := http.Post("http://localhost:8080/rounds/"+tr.ID+"/transcript", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}